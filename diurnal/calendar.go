@@ -0,0 +1,423 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// scopeKind orders the kinds of scope from least to most specific.
+type scopeKind int
+
+const (
+	scopeDefault scopeKind = iota
+	scopeWeekdays
+	scopeRange
+	scopeHoliday
+	scopeDate
+)
+
+const dateLayout = "2006-01-02"
+
+// date is a day of the calendar, wherever it is.
+type date struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+// dateOf returns the date of t in the location of t.
+func dateOf(t time.Time) date {
+	y, m, d := t.Date()
+	return date{y, m, d}
+}
+
+func parseDate(s string) (date, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return date{}, fmt.Errorf("unable to parse date %s: %v", s, err)
+	}
+	return dateOf(t), nil
+}
+
+// start returns the time at which the day begins in UTC.
+func (d date) start() time.Time {
+	return time.Date(d.year, d.month, d.day, 0, 0, 0, 0, time.UTC)
+}
+
+func (d date) addDays(n int) date {
+	return dateOf(d.start().AddDate(0, 0, n))
+}
+
+func (d date) before(o date) bool {
+	return d.start().Before(o.start())
+}
+
+func (d date) String() string {
+	return d.start().Format(dateLayout)
+}
+
+// scope selects the days a rule applies to.
+type scope struct {
+	kind scopeKind
+	// weekdays is set for scopeWeekdays.
+	weekdays [7]bool
+	// from and to are the first and last day of a scopeRange, or the day of a scopeDate.
+	from, to date
+}
+
+// parseScope parses a comma separated list of weekdays or weekday ranges ("sat,sun",
+// "mon-fri"), "holiday", a date ("2015-12-25") or a range of dates
+// ("2015-12-24..2016-01-01"), which includes both ends.
+func parseScope(s string) (scope, error) {
+	switch {
+	case s == "holiday":
+		return scope{kind: scopeHoliday}, nil
+	case strings.Contains(s, ".."):
+		parts := strings.SplitN(s, "..", 2)
+		from, err := parseDate(parts[0])
+		if err != nil {
+			return scope{}, err
+		}
+		to, err := parseDate(parts[1])
+		if err != nil {
+			return scope{}, err
+		}
+		if to.before(from) {
+			return scope{}, fmt.Errorf("date range %s ends before it starts", s)
+		}
+		return scope{kind: scopeRange, from: from, to: to}, nil
+	case len(s) > 0 && '0' <= s[0] && s[0] <= '9':
+		d, err := parseDate(s)
+		if err != nil {
+			return scope{}, err
+		}
+		return scope{kind: scopeDate, from: d, to: d}, nil
+	}
+	sc := scope{kind: scopeWeekdays}
+	for _, part := range strings.Split(s, ",") {
+		ends := strings.SplitN(part, "-", 2)
+		first, err := parseWeekday(ends[0])
+		if err != nil {
+			return scope{}, err
+		}
+		last := first
+		if len(ends) == 2 {
+			if last, err = parseWeekday(ends[1]); err != nil {
+				return scope{}, err
+			}
+		}
+		// ranges may wrap around the end of the week, as in "fri-mon"
+		for d := first; ; d = (d + 1) % 7 {
+			sc.weekdays[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return sc, nil
+}
+
+// parseWeekday accepts the English name of a weekday or its first three letters.
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(s)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || s == name[:3] {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", s)
+}
+
+// days is the number of days the scope covers, per week for weekdays. Of two scopes of
+// the same kind, the one covering fewer days is more specific.
+func (s scope) days() int {
+	switch s.kind {
+	case scopeWeekdays:
+		n := 0
+		for _, set := range s.weekdays {
+			if set {
+				n++
+			}
+		}
+		return n
+	case scopeRange, scopeDate:
+		return int(s.to.start().Sub(s.from.start())/dayPeriod) + 1
+	}
+	return 0
+}
+
+func (s scope) matches(d date, cal *calendar) bool {
+	switch s.kind {
+	case scopeDefault:
+		return true
+	case scopeWeekdays:
+		return s.weekdays[d.start().Weekday()]
+	case scopeHoliday:
+		_, ok := cal.holiday(d)
+		return ok
+	case scopeRange, scopeDate:
+		return !d.before(s.from) && !s.to.before(d)
+	}
+	return false
+}
+
+// moreSpecific reports whether s should be preferred over o for a day both match.
+func (s scope) moreSpecific(o scope) bool {
+	if s.kind != o.kind {
+		return s.kind > o.kind
+	}
+	return s.days() < o.days()
+}
+
+// rule is a table of replica counts for the days of its scope.
+type rule struct {
+	scope      scope
+	timeCounts []timeCount
+	// text is the rule as given by the user, for logging.
+	text string
+}
+
+// parseRule parses a rule of the form "scope times counts", for example
+// "sat,sun 00:00Z,12:00Z 2,4". The times and counts are as in -times and -counts.
+func parseRule(s string, parse timeParser) (rule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return rule{}, fmt.Errorf("rule %q must have a scope, times and counts separated by spaces", s)
+	}
+	sc, err := parseScope(fields[0])
+	if err != nil {
+		return rule{}, err
+	}
+	tc, err := parseTimeCountsWith(fields[1], fields[2], parse)
+	if err != nil {
+		return rule{}, err
+	}
+	return rule{scope: sc, timeCounts: tc, text: s}, nil
+}
+
+// calendar holds the holidays which rules scoped to "holiday" apply to.
+type calendar struct {
+	dates map[date]string
+	// yearly holidays fall on the same day every year; the year of the dates is 0.
+	yearly map[date]string
+}
+
+func (c *calendar) holiday(d date) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	if name, ok := c.dates[d]; ok {
+		return name, true
+	}
+	name, ok := c.yearly[date{0, d.month, d.day}]
+	return name, ok
+}
+
+func loadCalendar(path string) (*calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseICalendar(f)
+}
+
+// parseICalendar reads the holidays from the VEVENTs of an iCalendar (RFC 5545) file.
+// Every day from DTSTART up to, but not including, DTEND is a holiday, and events
+// with RRULE:FREQ=YEARLY repeat every year. Times of day and other recurrences are
+// not supported.
+func parseICalendar(r io.Reader) (*calendar, error) {
+	cal := &calendar{dates: map[date]string{}, yearly: map[date]string{}}
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		inEvent  bool
+		summary  string
+		rrule    string
+		from, to *date
+	)
+	for i, line := range lines {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		name, value := line[:colon], line[colon+1:]
+		if semi := strings.Index(name, ";"); semi >= 0 {
+			name = name[:semi]
+		}
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if value == "VEVENT" {
+				inEvent, summary, rrule, from, to = true, "", "", nil, nil
+			}
+		case "SUMMARY":
+			summary = value
+		case "RRULE":
+			rrule = value
+		case "DTSTART", "DTEND":
+			if !inEvent {
+				continue
+			}
+			if len(value) < 8 {
+				return nil, fmt.Errorf("line %d: unable to parse %s %q", i+1, name, value)
+			}
+			d, err := parseDate(value[:4] + "-" + value[4:6] + "-" + value[6:8])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			if strings.ToUpper(name) == "DTSTART" {
+				from = &d
+			} else {
+				// DTEND is exclusive for whole days, but a date-time ends on its own day.
+				if !strings.Contains(value, "T") {
+					d = d.addDays(-1)
+				}
+				to = &d
+			}
+		case "END":
+			if value != "VEVENT" || !inEvent {
+				continue
+			}
+			inEvent = false
+			if from == nil {
+				return nil, fmt.Errorf("line %d: event %q has no DTSTART", i+1, summary)
+			}
+			last := *from
+			if to != nil && from.before(*to) {
+				last = *to
+			}
+			yearly := strings.Contains(strings.ToUpper(rrule), "FREQ=YEARLY")
+			if len(rrule) > 0 && !yearly {
+				return nil, fmt.Errorf("line %d: event %q has an unsupported RRULE %q", i+1, summary, rrule)
+			}
+			for d := *from; !last.before(d); d = d.addDays(1) {
+				if yearly {
+					cal.yearly[date{0, d.month, d.day}] = summary
+				} else {
+					cal.dates[d] = summary
+				}
+			}
+		}
+	}
+	return cal, nil
+}
+
+// unfoldLines splits an iCalendar file into lines, joining lines which were folded
+// by starting their continuation with a space or tab.
+func unfoldLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// schedule decides the replica count at any moment from a set of rules. The first
+// rule applies to every day, so a day always has a rule.
+type schedule struct {
+	rules    []rule
+	calendar *calendar
+	// location is where the days of the schedule begin and end.
+	location *time.Location
+}
+
+func newSchedule(def []timeCount, rules []rule, cal *calendar, loc *time.Location) *schedule {
+	return &schedule{
+		rules:    append([]rule{{timeCounts: def, text: "default"}}, rules...),
+		calendar: cal,
+		location: loc,
+	}
+}
+
+// ruleFor returns the most specific rule matching d. Of equally specific rules, the
+// one given first wins.
+func (s *schedule) ruleFor(d date) *rule {
+	best := &s.rules[0]
+	for i := range s.rules[1:] {
+		r := &s.rules[i+1]
+		if r.scope.matches(d, s.calendar) && r.scope.moreSpecific(best.scope) {
+			best = r
+		}
+	}
+	return best
+}
+
+// dateOf returns the day of the schedule t falls on.
+func (s *schedule) dateOf(t time.Time) date {
+	return dateOf(t.In(s.location))
+}
+
+// day returns when d begins, and the times of its rule as the time passed since then.
+// These differ from the times of day when the clocks change during d. Times skipped
+// by the clocks going forward all fall on the moment they do.
+func (s *schedule) day(d date) (time.Time, []timeCount) {
+	start := wallTime(d, 0, s.location)
+	var tc []timeCount
+	for _, c := range s.ruleFor(d).timeCounts {
+		tc = append(tc, timeCount{wallTime(d, c.time, s.location).Sub(start), c.count})
+	}
+	return start, tc
+}
+
+// countAt returns the replica count scheduled at t. Before the first time of a day's
+// rule, the last count of the previous day holds.
+func (s *schedule) countAt(t time.Time) int {
+	d := s.dateOf(t)
+	start, tc := s.day(d)
+	offset := t.Sub(start)
+	pos := findPos(tc, 0, offset)
+	switch {
+	case tc[pos].time <= offset:
+		// every time of the day has passed
+		return tc[len(tc)-1].count
+	case pos > 0:
+		return tc[pos-1].count
+	}
+	prev := s.ruleFor(d.addDays(-1)).timeCounts
+	return prev[len(prev)-1].count
+}
+
+// next returns the first time after t at which a count is scheduled, and the count.
+// Of several counts scheduled at the same time, the last one given is returned.
+func (s *schedule) next(t time.Time) (time.Time, int) {
+	d := s.dateOf(t)
+	start, tc := s.day(d)
+	pos := findPos(tc, 0, t.Sub(start))
+	if tc[pos].time <= t.Sub(start) {
+		start, tc = s.day(d.addDays(1))
+		pos = 0
+	}
+	for pos+1 < len(tc) && tc[pos+1].time == tc[pos].time {
+		pos++
+	}
+	return start.Add(tc[pos].time), tc[pos].count
+}
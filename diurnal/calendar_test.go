@@ -0,0 +1,223 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParseDate(s string) date {
+	d, err := parseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func mustParseRule(s string) rule {
+	r, err := parseRule(s, parseTimeRelative)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func TestParseScope(t *testing.T) {
+	cases := []struct {
+		input string
+		kind  scopeKind
+		days  int
+		err   bool
+	}{
+		{"sat,sun", scopeWeekdays, 2, false},
+		{"Monday-fri", scopeWeekdays, 5, false},
+		{"fri-mon", scopeWeekdays, 4, false},
+		{"sun-sun", scopeWeekdays, 1, false},
+		{"holiday", scopeHoliday, 0, false},
+		{"2015-12-25", scopeDate, 1, false},
+		{"2015-12-24..2016-01-01", scopeRange, 9, false},
+		{"2016-01-01..2015-12-24", 0, 0, true},
+		{"2015-13-01", 0, 0, true},
+		{"mon-funday", 0, 0, true},
+		{"", 0, 0, true},
+	}
+	for i, test := range cases {
+		sc, err := parseScope(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if sc.kind != test.kind || sc.days() != test.days {
+			t.Errorf("case %d: expected kind %d covering %d days, got kind %d covering %d days", i, test.kind, test.days, sc.kind, sc.days())
+		}
+	}
+}
+
+const testICalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20151225\r\n" +
+	"DTEND;VALUE=DATE:20151227\r\n" +
+	"SUMMARY:Christmas\r\n" +
+	"  break\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20150101\r\n" +
+	"RRULE:FREQ=YEARLY\r\n" +
+	"SUMMARY:New Year's Day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20151126T000000Z\r\n" +
+	"DTEND:20151126T235959Z\r\n" +
+	"SUMMARY:Thanksgiving\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICalendar(t *testing.T) {
+	cal, err := parseICalendar(strings.NewReader(testICalendar))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		day  string
+		name string
+		ok   bool
+	}{
+		{"2015-12-24", "", false},
+		{"2015-12-25", "Christmas break", true},
+		{"2015-12-26", "Christmas break", true},
+		{"2015-12-27", "", false},
+		{"2015-01-01", "New Year's Day", true},
+		{"2020-01-01", "New Year's Day", true},
+		{"2020-01-02", "", false},
+		{"2015-11-26", "Thanksgiving", true},
+		{"2015-11-27", "", false},
+	}
+	for i, test := range cases {
+		name, ok := cal.holiday(mustParseDate(test.day))
+		if name != test.name || ok != test.ok {
+			t.Errorf("case %d: expected %q, %v got %q, %v", i, test.name, test.ok, name, ok)
+		}
+	}
+
+	if _, err := parseICalendar(strings.NewReader("BEGIN:VEVENT\nDTSTART:20150101\nRRULE:FREQ=WEEKLY\nEND:VEVENT\n")); err == nil {
+		t.Errorf("expected error for a weekly event")
+	}
+	if _, err := parseICalendar(strings.NewReader("BEGIN:VEVENT\nSUMMARY:nothing\nEND:VEVENT\n")); err == nil {
+		t.Errorf("expected error for an event without DTSTART")
+	}
+}
+
+func testSchedule() *schedule {
+	cal, err := parseICalendar(strings.NewReader(testICalendar))
+	if err != nil {
+		panic(err)
+	}
+	def, err := parseTimeCounts("06:00Z,18:00Z", "10,5")
+	if err != nil {
+		panic(err)
+	}
+	return newSchedule(def, []rule{
+		mustParseRule("sat,sun 08:00Z 3"),
+		mustParseRule("sun 12:00Z 4"),
+		mustParseRule("holiday 00:00Z 1"),
+		mustParseRule("2015-12-20..2015-12-31 06:00Z 7"),
+		mustParseRule("2015-12-26 10:00Z 2"),
+		mustParseRule("2015-12-21..2015-12-22 06:00Z 8"),
+		mustParseRule("2015-12-21..2015-12-22 06:00Z 9"),
+		mustParseRule("mon-fri 06:00Z,18:00Z 11,6"),
+	}, cal, time.UTC)
+}
+
+func TestRuleFor(t *testing.T) {
+	s := testSchedule()
+	cases := []struct {
+		day  string
+		rule string
+	}{
+		// Wednesday
+		{"2015-12-02", "mon-fri 06:00Z,18:00Z 11,6"},
+		{"2015-12-05", "sat,sun 08:00Z 3"},
+		// fewer weekdays wins
+		{"2015-12-06", "sun 12:00Z 4"},
+		{"2015-11-26", "holiday 00:00Z 1"},
+		{"2015-12-23", "2015-12-20..2015-12-31 06:00Z 7"},
+		// the shorter range wins, then the first given
+		{"2015-12-21", "2015-12-21..2015-12-22 06:00Z 8"},
+		// holidays beat ranges
+		{"2015-12-25", "holiday 00:00Z 1"},
+		// dates beat holidays
+		{"2015-12-26", "2015-12-26 10:00Z 2"},
+		{"2016-01-01", "holiday 00:00Z 1"},
+	}
+	for i, test := range cases {
+		// resolution must not depend on anything but the day
+		for j := 0; j < 3; j++ {
+			if r := s.ruleFor(mustParseDate(test.day)); r.text != test.rule {
+				t.Errorf("case %d: expected rule %q got %q", i, test.rule, r.text)
+			}
+		}
+	}
+
+	def := newSchedule([]timeCount{{0, 1}}, nil, nil, time.UTC)
+	if r := def.ruleFor(mustParseDate("2015-12-25")); r.text != "default" {
+		t.Errorf("expected the default rule, got %q", r.text)
+	}
+}
+
+func TestCountAtAndNext(t *testing.T) {
+	s := testSchedule()
+	at := func(s string) time.Time {
+		return timeMustParse(time.RFC3339, s)
+	}
+	cases := []struct {
+		now       string
+		count     int
+		next      string
+		nextCount int
+	}{
+		// Friday
+		{"2015-12-04T05:00:00Z", 6, "2015-12-04T06:00:00Z", 11},
+		{"2015-12-04T06:00:00Z", 11, "2015-12-04T18:00:00Z", 6},
+		{"2015-12-04T19:00:00Z", 6, "2015-12-05T08:00:00Z", 3},
+		// the count of Friday evening holds until Saturday's first time
+		{"2015-12-05T07:59:59Z", 6, "2015-12-05T08:00:00Z", 3},
+		{"2015-12-05T20:00:00Z", 3, "2015-12-06T12:00:00Z", 4},
+		{"2015-12-06T13:00:00Z", 4, "2015-12-07T06:00:00Z", 11},
+		{"2015-12-25T00:00:00Z", 1, "2015-12-26T10:00:00Z", 2},
+		{"2015-12-26T09:00:00Z", 1, "2015-12-26T10:00:00Z", 2},
+		{"2015-12-27T05:00:00Z", 2, "2015-12-27T06:00:00Z", 7},
+	}
+	for i, test := range cases {
+		now := at(test.now)
+		if count := s.countAt(now); count != test.count {
+			t.Errorf("case %d: expected count %d got %d", i, test.count, count)
+		}
+		next, count := s.next(now)
+		if !next.Equal(at(test.next)) || count != test.nextCount {
+			t.Errorf("case %d: expected next %s, %d got %v, %d", i, test.next, test.nextCount, next, count)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/labels"
+
+	"github.com/ghodss/yaml"
+)
+
+// scheduleConfig is the schedule file, which describes every target diurnal scales.
+//
+//	holidays: /etc/diurnal/holidays.ics
+//	targets:
+//	- name: redis
+//	  namespace: default
+//	  selector: name=redis-slave
+//	  times:
+//	  - {time: "00:00Z", count: 6}
+//	  - {time: "12:00Z", count: 10}
+//	  rules:
+//	  - scope: sat,sun
+//	    times:
+//	    - {time: "00:00Z", count: 4}
+type scheduleConfig struct {
+	// Holidays is an iCalendar file listing the days that rules scoped to holiday
+	// apply to. It replaces -holidays.
+	Holidays string         `json:"holidays,omitempty"`
+	Targets  []targetConfig `json:"targets"`
+}
+
+type targetConfig struct {
+	// Name identifies the target when the schedule is reloaded.
+	Name string `json:"name"`
+	// Namespace defaults to $POD_NAMESPACE.
+	Namespace string `json:"namespace,omitempty"`
+	// Selector selects the objects to scale, as in -labels.
+	Selector string `json:"selector"`
+	// Resource and APIVersion replace -resource and -api-version.
+	Resource   string `json:"resource,omitempty"`
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Timezone is as in -timezone, which it replaces.
+	Timezone string        `json:"timezone,omitempty"`
+	Times    []entryConfig `json:"times"`
+	Rules    []ruleConfig  `json:"rules,omitempty"`
+	// Ramp replaces -ramp and its settings.
+	Ramp *rampConfig `json:"ramp,omitempty"`
+	// Signal replaces -signal and its settings.
+	Signal *signalConfig `json:"signal,omitempty"`
+}
+
+type signalConfig struct {
+	// Type is as in -signal.
+	Type      string `json:"type"`
+	URL       string `json:"url,omitempty"`
+	CPUTarget int    `json:"cpuTarget,omitempty"`
+	// Interval is a duration such as 1m.
+	Interval string `json:"interval,omitempty"`
+}
+
+type rampConfig struct {
+	// Mode is as in -ramp.
+	Mode string `json:"mode"`
+	// Window is a duration such as 30m.
+	Window string `json:"window,omitempty"`
+	Steps  int    `json:"steps,omitempty"`
+	Rate   int    `json:"rate,omitempty"`
+}
+
+type entryConfig struct {
+	// Time is a time of day as in -times.
+	Time  string `json:"time"`
+	Count int    `json:"count"`
+	// Max makes Count the floor of a band of counts, for a signal to decide within.
+	Max int `json:"max,omitempty"`
+}
+
+type ruleConfig struct {
+	// Scope is as in -rule.
+	Scope string        `json:"scope"`
+	Times []entryConfig `json:"times"`
+}
+
+// timeCounts returns the parsed table of entries, of their ceilings if ceiling is set.
+func timeCounts(entries []entryConfig, parse timeParser, ceiling bool) ([]timeCount, error) {
+	var times, counts []string
+	for _, e := range entries {
+		times = append(times, e.Time)
+		count := e.Count
+		if ceiling && e.Max > 0 {
+			if e.Max < e.Count {
+				return nil, fmt.Errorf("the max of %v is below its count", e)
+			}
+			count = e.Max
+		}
+		counts = append(counts, fmt.Sprint(count))
+	}
+	return parseTimeCountsWith(strings.Join(times, ","), strings.Join(counts, ","), parse)
+}
+
+func (e entryConfig) String() string {
+	if e.Max > 0 {
+		return fmt.Sprintf("%s=%d-%d", e.Time, e.Count, e.Max)
+	}
+	return fmt.Sprintf("%s=%d", e.Time, e.Count)
+}
+
+// banded reports whether any of entries has a max.
+func banded(entries []entryConfig) bool {
+	for _, e := range entries {
+		if e.Max > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseScheduleConfig parses a schedule file into Scalers, which are not started.
+// Holidays are read from -holidays unless the file names its own calendar.
+func parseScheduleConfig(data []byte) ([]*Scaler, error) {
+	var config scheduleConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	path := *holidays
+	if len(config.Holidays) > 0 {
+		path = config.Holidays
+	}
+	var cal *calendar
+	if len(path) > 0 {
+		var err error
+		if cal, err = loadCalendar(path); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.Targets) == 0 {
+		return nil, errors.New("the schedule has no targets")
+	}
+	scalers := []*Scaler{}
+	seen := map[string]bool{}
+	for _, t := range config.Targets {
+		if len(t.Name) == 0 {
+			return nil, errors.New("every target must have a name")
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("target %s is listed twice", t.Name)
+		}
+		seen[t.Name] = true
+		s, err := t.scaler(cal)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %v", t.Name, err)
+		}
+		scalers = append(scalers, s)
+	}
+	return scalers, nil
+}
+
+func (t *targetConfig) scaler(cal *calendar) (*Scaler, error) {
+	ns := t.Namespace
+	if len(ns) == 0 {
+		ns = namespace
+	}
+	if len(ns) == 0 {
+		return nil, errors.New("no namespace given and POD_NAMESPACE is not set")
+	}
+	selector, err := labels.Parse(t.Selector)
+	if err != nil {
+		return nil, err
+	}
+	zone := *timezone
+	if len(t.Timezone) > 0 {
+		zone = t.Timezone
+	}
+	loc, parse, err := zoneFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	def, err := timeCounts(t.Times, parse, false)
+	if err != nil {
+		return nil, err
+	}
+	ceilingDef, err := timeCounts(t.Times, parse, true)
+	if err != nil {
+		return nil, err
+	}
+	hasBands := banded(t.Times)
+	var floorRules, ceilingRules []rule
+	for _, rc := range t.Rules {
+		sc, err := parseScope(rc.Scope)
+		if err != nil {
+			return nil, err
+		}
+		text := fmt.Sprintf("%s %v", rc.Scope, rc.Times)
+		tc, err := timeCounts(rc.Times, parse, false)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rc.Scope, err)
+		}
+		floorRules = append(floorRules, rule{scope: sc, timeCounts: tc, text: text})
+		if tc, err = timeCounts(rc.Times, parse, true); err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rc.Scope, err)
+		}
+		ceilingRules = append(ceilingRules, rule{scope: sc, timeCounts: tc, text: text})
+		hasBands = hasBands || banded(rc.Times)
+	}
+	r, err := newRamp(*rampMode, *rampWindow, *rampSteps, *rampPerMinute)
+	if t.Ramp != nil {
+		var window time.Duration
+		if len(t.Ramp.Window) > 0 {
+			if window, err = time.ParseDuration(t.Ramp.Window); err != nil {
+				return nil, err
+			}
+		}
+		r, err = newRamp(t.Ramp.Mode, window, t.Ramp.Steps, t.Ramp.Rate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sig, err := newSignal(*signalKind, *signalURL, *signalCPUTarget)
+	interval := *signalInterval
+	if t.Signal != nil {
+		if len(t.Signal.Interval) > 0 {
+			if interval, err = time.ParseDuration(t.Signal.Interval); err != nil {
+				return nil, err
+			}
+		}
+		cpuTarget := t.Signal.CPUTarget
+		if cpuTarget == 0 {
+			cpuTarget = *signalCPUTarget
+		}
+		sig, err = newSignal(t.Signal.Type, t.Signal.URL, cpuTarget)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sig != nil && interval <= 0 {
+		return nil, errors.New("the signal interval must be positive")
+	}
+	resource, version := *resource, *apiVersion
+	if len(t.Resource) > 0 {
+		resource = t.Resource
+		// the API version of -resource is not that of another resource
+		version = "v1"
+	}
+	if len(t.APIVersion) > 0 {
+		version = t.APIVersion
+	}
+	w, err := newWorkload(resource, version)
+	if err != nil {
+		return nil, err
+	}
+	scaler := &Scaler{
+		name:      t.Name,
+		namespace: ns,
+		selector:  selector,
+		workload:  w,
+		schedule:  newSchedule(def, floorRules, cal, loc),
+		signal:    sig,
+		interval:  interval,
+		resync:    *reconcileInterval,
+		ramp:      r,
+	}
+	if hasBands {
+		scaler.ceiling = newSchedule(ceilingDef, ceilingRules, cal, loc)
+	}
+	return scaler, nil
+}
+
+// source is where the schedule file is read from.
+type source interface {
+	read() ([]byte, error)
+	String() string
+}
+
+// fileSource reads the schedule from a file.
+type fileSource string
+
+func (f fileSource) read() ([]byte, error) {
+	return ioutil.ReadFile(string(f))
+}
+
+func (f fileSource) String() string {
+	return string(f)
+}
+
+// configMapSource reads the schedule from a key of a ConfigMap.
+type configMapSource struct {
+	namespace string
+	name      string
+	key       string
+}
+
+// parseConfigMapSource parses "namespace/name" or "name", which is in $POD_NAMESPACE.
+func parseConfigMapSource(s, key string) (*configMapSource, error) {
+	src := &configMapSource{namespace: namespace, name: s, key: key}
+	if i := strings.Index(s, "/"); i >= 0 {
+		src.namespace, src.name = s[:i], s[i+1:]
+	}
+	if len(src.namespace) == 0 || len(src.name) == 0 {
+		return nil, fmt.Errorf("ConfigMap %q must be namespace/name, or name if POD_NAMESPACE is set", s)
+	}
+	return src, nil
+}
+
+func (c *configMapSource) read() ([]byte, error) {
+	// The client has no ConfigMap type, so the object is decoded here.
+	body, err := client.Get().Namespace(c.namespace).Resource("configmaps").Name(c.name).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+	var configMap struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(body, &configMap); err != nil {
+		return nil, err
+	}
+	data, ok := configMap.Data[c.key]
+	if !ok {
+		return nil, fmt.Errorf("%v has no key %s", c, c.key)
+	}
+	return []byte(data), nil
+}
+
+func (c *configMapSource) String() string {
+	return fmt.Sprintf("ConfigMap %s/%s", c.namespace, c.name)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseScheduleConfig(t *testing.T) {
+	namespace = "pod-ns"
+	defer func() { namespace = "" }()
+
+	cases := []struct {
+		config     string
+		names      []string
+		namespaces []string
+		rules      int
+		err        bool
+	}{
+		{`
+targets:
+- name: redis
+  selector: name=redis-slave
+  times:
+  - {time: "00:00Z", count: 6}
+  - {time: "12:00Z", count: 10}
+  rules:
+  - scope: sat,sun
+    times:
+    - {time: "00:00Z", count: 4}
+- name: web
+  namespace: frontend
+  selector: app=web,track=stable
+  times:
+  - {time: "0900-0500", count: 20}
+`, []string{"redis", "web"}, []string{"pod-ns", "frontend"}, 2, false},
+		{"targets: []", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, times: []}]", nil, nil, 0, true},
+		{"targets: [{selector: x=y, times: [{time: 00Z, count: 1}]}]", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, times: [{time: 25Z, count: 1}]}]", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, times: [{time: 00Z, count: -1}]}]", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, times: [{time: 00Z, count: 1}], rules: [{scope: someday, times: [{time: 00Z, count: 1}]}]}]", nil, nil, 0, true},
+		{`
+targets:
+- {name: a, selector: x=y, times: [{time: 00Z, count: 1}]}
+- {name: a, selector: x=z, times: [{time: 00Z, count: 1}]}
+`, nil, nil, 0, true},
+		{"holidays: /does/not/exist.ics\ntargets: [{name: a, selector: x=y, times: [{time: 00Z, count: 1}]}]", nil, nil, 0, true},
+		{"targets: {", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, times: [{time: 00Z, count: 1}], ramp: {mode: linear, window: 30m}}]", []string{"a"}, []string{"pod-ns"}, 1, false},
+		{"targets: [{name: a, selector: x=y, times: [{time: 00Z, count: 1}], ramp: {mode: linear}}]", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, times: [{time: 00Z, count: 1}], ramp: {mode: step, window: half an hour, steps: 2}}]", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, times: [{time: 00Z, count: 1, max: 5}], signal: {type: http, url: \"http://load/replicas\"}}]", []string{"a"}, []string{"pod-ns"}, 1, false},
+		{"targets: [{name: a, selector: x=y, times: [{time: 00Z, count: 5, max: 1}]}]", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, times: [{time: 00Z, count: 1}], signal: {type: http}}]", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, times: [{time: 00Z, count: 1}], signal: {type: cpu, interval: 0s}}]", nil, nil, 0, true},
+		{"targets: [{name: a, selector: x=y, resource: deployments, apiVersion: extensions/v1beta1, times: [{time: 00Z, count: 1}]}]", []string{"a"}, []string{"pod-ns"}, 1, false},
+	}
+	for i, test := range cases {
+		scalers, err := parseScheduleConfig([]byte(test.config))
+		if test.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(scalers) != len(test.names) {
+			t.Errorf("case %d: expected %d scalers got %d", i, len(test.names), len(scalers))
+			continue
+		}
+		for j, s := range scalers {
+			if s.name != test.names[j] || s.namespace != test.namespaces[j] {
+				t.Errorf("case %d: expected target %s in %s got %s in %s", i, test.names[j], test.namespaces[j], s.name, s.namespace)
+			}
+		}
+		if n := len(scalers[0].schedule.rules); n != test.rules {
+			t.Errorf("case %d: expected %d rules got %d", i, test.rules, n)
+		}
+	}
+}
+
+func TestParseConfigMapSource(t *testing.T) {
+	namespace = "pod-ns"
+	defer func() { namespace = "" }()
+
+	cases := []struct {
+		input     string
+		namespace string
+		name      string
+		err       bool
+	}{
+		{"schedule", "pod-ns", "schedule", false},
+		{"other/schedule", "other", "schedule", false},
+		{"other/", "", "", true},
+		{"", "", "", true},
+	}
+	for i, test := range cases {
+		src, err := parseConfigMapSource(test.input, "schedule.yaml")
+		if test.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if src.namespace != test.namespace || src.name != test.name {
+			t.Errorf("case %d: expected %s/%s got %s/%s", i, test.namespace, test.name, src.namespace, src.name)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// controller runs a Scaler for every target of the schedule, and reloads the schedule.
+type controller struct {
+	// lock guards the fields below, which the status server and leader election use.
+	lock sync.Mutex
+	// scalers are the running Scalers.
+	scalers map[string]*Scaler
+	// targets are the Scalers of the schedule, which run unless standby is set.
+	targets []*Scaler
+	// standby stops every Scaler while another replica of diurnal is the leader.
+	standby bool
+
+	// start and stop are replaced in tests.
+	start func(*Scaler) error
+	stop  func(*Scaler) error
+}
+
+func newController() *controller {
+	return &controller{
+		scalers: map[string]*Scaler{},
+		start:   (*Scaler).Start,
+		stop:    (*Scaler).Stop,
+	}
+}
+
+// sameTarget reports whether a and b scale the same objects on the same schedule.
+func sameTarget(a, b *Scaler) bool {
+	return a.namespace == b.namespace &&
+		a.selector.String() == b.selector.String() &&
+		reflect.DeepEqual(a.workload, b.workload) &&
+		reflect.DeepEqual(a.schedule, b.schedule) &&
+		reflect.DeepEqual(a.ceiling, b.ceiling) &&
+		reflect.DeepEqual(a.signal, b.signal) &&
+		a.interval == b.interval &&
+		reflect.DeepEqual(a.ramp, b.ramp)
+}
+
+// update makes scalers the Scalers of the schedule. Scalers of targets which did not
+// change keep running, those of removed or changed targets are stopped, and new ones
+// started.
+func (c *controller) update(scalers []*Scaler) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.targets = scalers
+	c.sync()
+}
+
+// setStandby stops every Scaler if standby is set, and starts them again otherwise.
+// A Scaler sets the count scheduled as soon as it starts.
+func (c *controller) setStandby(standby bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.standby = standby
+	c.sync()
+}
+
+// sync starts and stops Scalers so that the targets run, unless standby is set.
+func (c *controller) sync() {
+	wanted := map[string]*Scaler{}
+	if !c.standby {
+		for _, s := range c.targets {
+			wanted[s.name] = s
+		}
+	}
+	for _, name := range sortedNames(c.scalers) {
+		old := c.scalers[name]
+		if s, ok := wanted[name]; ok && sameTarget(old, s) {
+			continue
+		}
+		glog.Infof("stopping scaling of target %s", name)
+		if err := c.stop(old); err != nil {
+			glog.Errorf("target %s: %v", name, err)
+		}
+		delete(c.scalers, name)
+		forgetMetrics(name)
+	}
+	for _, name := range sortedNames(wanted) {
+		if _, ok := c.scalers[name]; ok {
+			continue
+		}
+		s := wanted[name]
+		glog.Infof("starting scaling of target %s", name)
+		if err := c.start(s); err != nil {
+			glog.Errorf("target %s: %v", name, err)
+			continue
+		}
+		c.scalers[name] = s
+	}
+}
+
+// reload reads and applies the schedule from src. An invalid schedule is logged and
+// the running Scalers are left alone.
+func (c *controller) reload(src source) {
+	data, err := src.read()
+	if err != nil {
+		glog.Errorf("unable to read the schedule from %v: %v", src, err)
+		return
+	}
+	scalers, err := parseScheduleConfig(data)
+	if err != nil {
+		glog.Errorf("invalid schedule in %v: %v", src, err)
+		return
+	}
+	c.update(scalers)
+}
+
+// watch reloads the schedule from src every interval until done is closed.
+func (c *controller) watch(src source, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.reload(src)
+		}
+	}
+}
+
+// stopAll stops every running Scaler.
+func (c *controller) stopAll() {
+	c.update(nil)
+}
+
+func sortedNames(scalers map[string]*Scaler) []string {
+	names := []string{}
+	for name := range scalers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
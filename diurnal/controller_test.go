@@ -0,0 +1,142 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestControllerUpdate(t *testing.T) {
+	namespace = "pod-ns"
+	defer func() { namespace = "" }()
+
+	c := newController()
+	var started, stopped []string
+	c.start = func(s *Scaler) error {
+		started = append(started, s.name)
+		return nil
+	}
+	c.stop = func(s *Scaler) error {
+		stopped = append(stopped, s.name)
+		return nil
+	}
+
+	cases := []struct {
+		config  string
+		started []string
+		stopped []string
+	}{
+		{`
+targets:
+- {name: a, selector: x=a, times: [{time: 00Z, count: 1}]}
+- {name: b, selector: x=b, times: [{time: 00Z, count: 1}]}
+`, []string{"a", "b"}, nil},
+		// nothing changed
+		{`
+targets:
+- {name: b, selector: x=b, times: [{time: 00Z, count: 1}]}
+- {name: a, selector: x=a, times: [{time: 00Z, count: 1}]}
+`, nil, nil},
+		// b's schedule changed, c is new
+		{`
+targets:
+- {name: a, selector: x=a, times: [{time: 00Z, count: 1}]}
+- {name: b, selector: x=b, times: [{time: 00Z, count: 2}]}
+- {name: c, selector: x=c, times: [{time: 00Z, count: 1}]}
+`, []string{"b", "c"}, []string{"b"}},
+		// a moved namespace, c's selector changed, b was removed
+		{`
+targets:
+- {name: a, namespace: other, selector: x=a, times: [{time: 00Z, count: 1}]}
+- {name: c, selector: x=d, times: [{time: 00Z, count: 1}]}
+`, []string{"a", "c"}, []string{"a", "b", "c"}},
+		// a rule was added to a
+		{`
+targets:
+- name: a
+  namespace: other
+  selector: x=a
+  times: [{time: 00Z, count: 1}]
+  rules: [{scope: sun, times: [{time: 00Z, count: 1}]}]
+- {name: c, selector: x=d, times: [{time: 00Z, count: 1}]}
+`, []string{"a"}, []string{"a"}},
+	}
+	for i, test := range cases {
+		started, stopped = nil, nil
+		scalers, err := parseScheduleConfig([]byte(test.config))
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		c.update(scalers)
+		if !reflect.DeepEqual(started, test.started) {
+			t.Errorf("case %d: expected to start %v, started %v", i, test.started, started)
+		}
+		if !reflect.DeepEqual(stopped, test.stopped) {
+			t.Errorf("case %d: expected to stop %v, stopped %v", i, test.stopped, stopped)
+		}
+	}
+
+	started, stopped = nil, nil
+	c.stopAll()
+	if !reflect.DeepEqual(stopped, []string{"a", "c"}) || len(c.scalers) != 0 {
+		t.Errorf("expected to stop everything, stopped %v", stopped)
+	}
+}
+
+func TestControllerReload(t *testing.T) {
+	namespace = "pod-ns"
+	defer func() { namespace = "" }()
+
+	f, err := ioutil.TempFile("", "diurnal")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(f.Name())
+	src := fileSource(f.Name())
+
+	c := newController()
+	c.start = func(*Scaler) error { return nil }
+	c.stop = func(*Scaler) error { return nil }
+
+	write := func(config string) {
+		if err := ioutil.WriteFile(f.Name(), []byte(config), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	write("targets: [{name: a, selector: x=a, times: [{time: 00Z, count: 1}]}]")
+	c.reload(src)
+	a := c.scalers["a"]
+	if a == nil {
+		t.Fatalf("expected a to be running")
+	}
+
+	// an invalid schedule leaves the Scalers alone
+	write("targets: [{name: a, selector: x=a, times: [{time: 99Z, count: 1}]}]")
+	c.reload(src)
+	if c.scalers["a"] != a {
+		t.Errorf("expected a to keep running after an invalid reload")
+	}
+
+	write("targets: [{name: b, selector: x=b, times: [{time: 00Z, count: 1}]}]")
+	c.reload(src)
+	if _, ok := c.scalers["a"]; ok || c.scalers["b"] == nil {
+		t.Errorf("expected only b to be running, got %v", sortedNames(c.scalers))
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -82,6 +83,11 @@ func parseTimeRelative(s string) (time.Duration, error) {
 }
 
 func parseTimeCounts(times string, counts string) ([]timeCount, error) {
+	return parseTimeCountsWith(times, counts, parseTimeRelative)
+}
+
+// parseTimeCountsWith is parseTimeCounts with times parsed by parse.
+func parseTimeCountsWith(times, counts string, parse timeParser) ([]timeCount, error) {
 	ts := strings.Split(times, ",")
 	cs := strings.Split(counts, ",")
 	if len(ts) != len(cs) {
@@ -89,7 +95,7 @@ func parseTimeCounts(times string, counts string) ([]timeCount, error) {
 	}
 	var tc []timeCount
 	for i := range ts {
-		t, err := parseTimeRelative(ts[i])
+		t, err := parse(ts[i])
 		if err != nil {
 			return nil, err
 		}
@@ -107,13 +113,52 @@ func parseTimeCounts(times string, counts string) ([]timeCount, error) {
 }
 
 type Scaler struct {
-	timeCounts []timeCount
-	selector   labels.Selector
-	start      time.Time
-	pos        int
-	done       chan struct{}
+	// name identifies the target in the schedule file.
+	name      string
+	namespace string
+	selector  labels.Selector
+	// workload is the kind of the objects scaled.
+	workload workload
+	schedule *schedule
+	// ceiling is the schedule of the most replicas the signal may ask for, if the
+	// schedule has bands. schedule is then the floor.
+	ceiling *schedule
+	// signal decides the count between floor and ceiling, read every interval.
+	signal   loadSignal
+	interval time.Duration
+	// resync is how often the count is set again, to undo changes by others.
+	resync time.Duration
+	// ramp spreads changes of the count over time, if set.
+	ramp *ramp
+	// lock guards current and last, which the status server reads.
+	lock sync.Mutex
+	// current is the count last set.
+	current int
+	// last is the result of the last scaling, if any.
+	last *scaleResult
+	// shift moves the schedule forward, so that the day begins at the time Start is
+	// called if -now is set.
+	shift time.Duration
+	// done is closed to stop the scaling loop, which closes stopped once it returns.
+	done    chan struct{}
+	stopped chan struct{}
+
+	// clock and set are replaced in tests.
+	clock clock
+	set   func(s *Scaler, count int)
+}
+
+// clock tells the time and waits for it to pass.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
 }
 
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
 var posError = errors.New("could not find position")
 
 func findPos(tc []timeCount, cur int, offset time.Duration) int {
@@ -128,60 +173,166 @@ func findPos(tc []timeCount, cur int, offset time.Duration) int {
 }
 
 func (s *Scaler) setCount(c int) {
-	glog.Infof("scaling to %d replicas", c)
-	rcList, err := client.ReplicationControllers(namespace).List(s.selector)
+	glog.Infof("scaling %s to %d replicas", s.name, c)
+	result := &scaleResult{Time: s.clock.Now(), Replicas: c}
+	defer s.recordResult(result)
+	objs, err := s.workload.list(s.namespace, s.selector)
 	if err != nil {
-		glog.Errorf("could not get replication controllers: %v", err)
+		glog.Errorf("could not get the objects to scale: %v", err)
+		result.fail(err)
 		return
 	}
-	for _, rc := range rcList.Items {
-		rc.Spec.Replicas = c
-		if _, err = client.ReplicationControllers(namespace).Update(&rc); err != nil {
-			glog.Errorf("unable to scale replication controller: %v", err)
+	result.Objects = len(objs)
+	for _, obj := range objs {
+		n, err := s.scaleObject(obj, c)
+		result.Actual += n
+		if err == errStopped {
+			return
+		}
+		if err != nil {
+			result.fail(err)
 		}
 	}
 }
 
-func (s *Scaler) timeOffset() time.Duration {
-	return time.Since(s.start) % dayPeriod
+// scheduleTime is the current time on the schedule.
+func (s *Scaler) scheduleTime() time.Time {
+	return s.clock.Now().Add(-s.shift)
 }
 
-func (s *Scaler) curpos(offset time.Duration) int {
-	return findPos(s.timeCounts, s.pos, offset)
+// apply sets the count c.
+func (s *Scaler) apply(c int) {
+	s.lock.Lock()
+	s.current = c
+	s.lock.Unlock()
+	s.set(s, c)
 }
 
+// nextChange returns the first time after t at which the floor or ceiling changes.
+func (s *Scaler) nextChange(t time.Time) time.Time {
+	next, _ := s.schedule.next(t)
+	if s.ceiling != nil {
+		if c, _ := s.ceiling.next(t); c.Before(next) {
+			next = c
+		}
+	}
+	return next
+}
+
+// desired returns the count to set at t on the schedule: what the signal asks for,
+// kept between the floor and ceiling scheduled at t. Without a signal it is the floor.
+// If the signal fails, the current count is kept between them.
+func (s *Scaler) desired(t time.Time) int {
+	floor := s.schedule.countAt(t)
+	if s.signal == nil {
+		return floor
+	}
+	ceiling := floor
+	if s.ceiling != nil {
+		ceiling = s.ceiling.countAt(t)
+	}
+	want, err := s.signal.replicas(s)
+	if err != nil {
+		glog.Errorf("unable to read the signal of %s: %v", s.name, err)
+		want = s.current
+	}
+	if want > ceiling {
+		want = ceiling
+	}
+	if want < floor {
+		want = floor
+	}
+	return want
+}
+
+// The events of the scaling loop.
+const (
+	// eventSchedule is a change of the floor or ceiling.
+	eventSchedule = iota
+	// eventRamp is a step of a ramp.
+	eventRamp
+	// eventPoll is a reading of the signal.
+	eventPoll
+	// eventReconcile sets the current count again.
+	eventReconcile
+)
+
 func (s *Scaler) scale() {
+	defer close(s.stopped)
+	// set initial count, which is not ramped to
+	s.apply(s.desired(s.scheduleTime()))
+
+	// pending are the remaining steps of a ramp. A change of the count which comes
+	// before they are done replaces them with a ramp of its own.
+	var pending []step
+	// polled is when the signal was last read, and reconciled when the count was set.
+	polled := s.scheduleTime()
+	reconciled := polled
 	for {
+		now := s.scheduleTime()
+		next, event := s.nextChange(now), eventSchedule
+		if len(pending) > 0 && pending[0].time.Before(next) {
+			next, event = pending[0].time, eventRamp
+		}
+		if poll := polled.Add(s.interval); s.signal != nil && poll.Before(next) {
+			next, event = poll, eventPoll
+		}
+		if resync := reconciled.Add(s.resync); s.resync > 0 && resync.Before(next) {
+			next, event = resync, eventReconcile
+		}
+		switch event {
+		case eventRamp:
+			glog.V(2).Infof("next ramping %s to %d replicas at %v", s.name, pending[0].count, next.Add(s.shift))
+		case eventPoll:
+			glog.V(2).Infof("next reading the signal of %s at %v", s.name, next.Add(s.shift))
+		case eventReconcile:
+			glog.V(4).Infof("next reconciling %s at %v", s.name, next.Add(s.shift))
+		default:
+			glog.V(2).Infof("next scaling %s at %v (rule %q)", s.name, next.Add(s.shift), s.schedule.ruleFor(s.schedule.dateOf(next)).text)
+		}
 		select {
 		case <-s.done:
 			return
-		default:
-			offset := s.timeOffset()
-			s.pos = s.curpos(offset)
-			if s.timeCounts[s.pos].time < offset {
-				time.Sleep(dayPeriod - offset)
+		case <-s.clock.After(next.Sub(now)):
+		}
+		reconciled = next
+		switch event {
+		case eventReconcile:
+			s.set(s, s.current)
+			continue
+		case eventSchedule, eventPoll:
+			count := s.desired(next)
+			polled = next
+			target := s.current
+			if len(pending) > 0 {
+				target = pending[len(pending)-1].count
+			}
+			if event == eventPoll && count == target {
 				continue
 			}
-			time.Sleep(s.timeCounts[s.pos].time - offset)
-			s.setCount(s.timeCounts[s.pos].count)
+			pending = s.ramp.plan(s.current, count, next)
 		}
+		s.apply(pending[0].count)
+		pending = pending[1:]
 	}
 }
 
+// Start sets the count scheduled now and keeps setting it as the schedule changes. A
+// Scaler which was stopped may be started again.
 func (s *Scaler) Start() error {
-	now := time.Now().UTC()
-	s.start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if s.clock == nil {
+		s.clock = realClock{}
+	}
+	if s.set == nil {
+		s.set = (*Scaler).setCount
+	}
 	if *startNow {
-		s.start = now
+		now := s.clock.Now()
+		s.shift = now.Sub(wallTime(s.schedule.dateOf(now), 0, s.schedule.location))
 	}
 
-	// set initial count
-	pos := s.curpos(s.timeOffset())
-	// add the len to avoid getting a negative index
-	pos = (pos - 1 + len(s.timeCounts)) % len(s.timeCounts)
-	s.setCount(s.timeCounts[pos].count)
-
 	s.done = make(chan struct{})
+	s.stopped = make(chan struct{})
 	go s.scale()
 	return nil
 }
@@ -196,30 +347,128 @@ func safeclose(c chan<- struct{}) (err error) {
 	return nil
 }
 
+// Stop stops scaling, and returns once the scaling loop has.
 func (s *Scaler) Stop() error {
 	if err := safeclose(s.done); err != nil {
 		return errors.New("already stopped scaling")
 	}
+	<-s.stopped
 	return nil
 }
 
 var (
 	counts     = flag.String("counts", "", "replica counts, must have at least one (csv)")
 	times      = flag.String("times", "", "times to set replica counts relative to UTC following ISO 8601 (csv)")
-	userLabels = flag.String("labels", "", "replication controller labels, syntax should follow https://godoc.org/k8s.io/kubernetes/pkg/labels#Parse")
-	startNow   = flag.Bool("now", false, "times are relative to now not 0:00 UTC (for demos)")
+	userLabels = flag.String("labels", "", "labels of the objects to scale, syntax should follow https://godoc.org/k8s.io/kubernetes/pkg/labels#Parse")
+	startNow   = flag.Bool("now", false, "times are relative to now not the start of the day (for demos)")
 	local      = flag.Bool("local", false, "set to true if running on local machine not within cluster")
 	localPort  = flag.Int("localport", 8001, "port that kubectl proxy is running on (local must be true)")
+	holidays   = flag.String("holidays", "", "iCalendar file listing the days that rules scoped to holiday apply to")
+	timezone   = flag.String("timezone", "", "IANA time zone, such as America/New_York, whose wall clock times and days follow; times may not have offsets if set")
+	rules      ruleList
+
+	resource   = flag.String("resource", "replicationcontrollers", "resource of the objects to scale, such as deployments or replicasets; anything but replication controllers is scaled through its scale subresource")
+	apiVersion = flag.String("api-version", "v1", "group and version of -resource, such as extensions/v1beta1")
+
+	scheduleFile      = flag.String("schedule-file", "", "YAML file describing every target and its schedule, in place of -labels, -times, -counts and -rule")
+	scheduleConfigMap = flag.String("schedule-configmap", "", "ConfigMap (namespace/name, or name in $POD_NAMESPACE) holding the schedule file, in place of -schedule-file")
+	scheduleKey       = flag.String("schedule-key", "schedule.yaml", "key of the schedule file in -schedule-configmap")
+	reloadInterval    = flag.Duration("reload-interval", 30*time.Second, "how often the schedule file or ConfigMap is checked for changes")
+
+	rampMode      = flag.String("ramp", rampNone, "how changes of the count are spread over time: none, linear (one replica at a time over -ramp-window), step (-ramp-steps steps over -ramp-window) or rate (-ramp-rate replicas per minute)")
+	rampWindow    = flag.Duration("ramp-window", 0, "time a linear or step ramp takes")
+	rampSteps     = flag.Int("ramp-steps", 0, "number of steps of a step ramp")
+	rampPerMinute = flag.Int("ramp-rate", 0, "largest change of the count per minute of a rate ramp")
+
+	signalKind      = flag.String("signal", signalNone, "what decides the count within a band of counts such as 3-10: none (the floor), http (the number -signal-url returns) or cpu (enough replicas to keep CPU usage at -signal-cpu-target)")
+	signalURL       = flag.String("signal-url", "", "URL returning the number of replicas needed, for an http signal")
+	signalCPUTarget = flag.Int("signal-cpu-target", 80, "percentage of the CPU requested by the pods they should use, for a cpu signal")
+	signalInterval  = flag.Duration("signal-interval", time.Minute, "how often the signal is read")
+
+	reconcileInterval = flag.Duration("reconcile-interval", time.Minute, "how often objects scaled by others are scaled back to the current count (0 to never)")
+
+	address = flag.String("address", ":8080", "address to serve /healthz, /status and /metrics on, empty to disable")
+
+	leaderElect         = flag.Bool("leader-elect", false, "elect a leader among the replicas of diurnal through the API server; only the leader scales")
+	leaderElectLock     = flag.String("leader-elect-lock", "diurnal", "name of the Endpoints object in $POD_NAMESPACE holding the lease of the leader")
+	leaderElectIdentity = flag.String("leader-elect-identity", "", "identity of this replica in the election (default the hostname)")
+	leaderElectLease    = flag.Duration("leader-elect-lease", 15*time.Second, "time without a renewal of the lease after which another replica takes over")
+	leaderElectRetry    = flag.Duration("leader-elect-retry", 2*time.Second, "how often the lease is renewed, or tried to be taken; requests for the lease give up after half of it")
 
 	namespace string = os.Getenv("POD_NAMESPACE")
 
 	client *kclient.Client
 )
 
+func init() {
+	flag.Var(&rules, "rule", "replica counts for some days, as \"scope times counts\" (may be repeated)")
+}
+
+// ruleList collects the -rule flags. They are parsed once -timezone is known.
+type ruleList []string
+
+func (l *ruleList) String() string {
+	return strings.Join(*l, "; ")
+}
+
+func (l *ruleList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 const usageNotes = `
 counts and times must both be set and be of equal length. Example usage:
   diurnal -labels name=redis-slave -times 00:00:00Z,06:00:00Z -counts 3,9
   diurnal -labels name=redis-slave -times 0600-0500,0900-0500,1700-0500,2200-0500 -counts 15,20,13,6
+
+times and counts apply to every day, unless a rule for the day replaces them. The
+scope of a rule is weekdays (sat,sun or mon-fri), holiday, a date (2015-12-25) or
+a range of dates (2015-12-24..2016-01-01). Days begin at 0:00 UTC, or midnight
+in timezone. Of the rules
+matching a day, a date beats a holiday, which beats a range of dates, which beats
+weekdays; otherwise the rule covering fewer days wins, then the rule given first.
+  diurnal -labels name=redis-slave -times 00:00Z,12:00Z -counts 6,10 \
+    -rule "sat,sun 00:00Z 4" -rule "holiday 00:00Z 3" -holidays holidays.ics
+
+With timezone, times are read off the wall clock of the zone and move with its
+daylight saving time. A time skipped when the clocks go forward takes effect when
+they do, and a time repeated when they go back only takes effect the first time.
+  diurnal -labels name=redis-slave -timezone America/New_York -times 06:00,22:00 -counts 20,6
+
+A ramp spreads each change of the count over time, starting at its time. A change
+due before the ramp is done starts a new ramp from the count reached so far.
+  diurnal -labels name=redis-slave -times 06:00Z,22:00Z -counts 20,6 -ramp linear -ramp-window 30m
+
+A count may be a band, such as 3-10, within which a signal of the load decides the
+count. Without a signal, the floor of the band is used.
+  diurnal -labels name=redis-slave -times 06:00Z,22:00Z -counts 10-30,3-30 -signal cpu
+
+Replication controllers are scaled by default. Other objects with a scale
+subresource, such as deployments and replica sets, are scaled with resource and
+api-version.
+  diurnal -labels app=web -resource deployments -api-version extensions/v1beta1 -times 06:00Z,22:00Z -counts 20,6
+
+Objects scaled by others are scaled back every reconcile-interval. To scale one by
+hand, annotate it with diurnal.alpha.kubernetes.io/paused-until and the time, in
+RFC 3339 format, until which diurnal should leave it alone.
+
+To scale several targets, describe them in a schedule file, which is reloaded
+every reload-interval. Targets which did not change keep scaling undisturbed.
+  diurnal -schedule-file schedule.yaml
+  diurnal -schedule-configmap diurnal-schedule
+
+The state of every target, its schedule for the day, current and next count and the
+result of the last scaling, is served as JSON on /status of address, next to
+/healthz and Prometheus metrics on /metrics.
+
+Several replicas of diurnal can run for availability with leader-elect. Only the
+leader, which holds a lease in an Endpoints object, scales. Another replica takes
+over within leader-elect-lease and leader-elect-retry of the leader failing, and
+sets the counts scheduled at once.
+  diurnal -leader-elect -schedule-configmap diurnal-schedule
+
+To see the counts a schedule would set over some time, without scaling anything:
+  diurnal preview -labels name=redis-slave -times 06:00Z,22:00Z -counts 20,6 -for 48h
 `
 
 func usage() {
@@ -229,6 +478,12 @@ func usage() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "preview" {
+		if err := preview(os.Args[2:]); err != nil {
+			glog.Fatal(err)
+		}
+		return
+	}
 	flag.Usage = usage
 	flag.Parse()
 
@@ -248,22 +503,6 @@ func main() {
 	}
 	client, err = kclient.New(cfg)
 
-	selector, err := labels.Parse(*userLabels)
-	if err != nil {
-		glog.Fatal(err)
-	}
-	tc, err := parseTimeCounts(*times, *counts)
-	if err != nil {
-		glog.Fatal(err)
-	}
-	if namespace == "" {
-		glog.Fatal("POD_NAMESPACE is not set. Set to the namespace of the replication controller if running locally.")
-	}
-	scaler := Scaler{timeCounts: tc, selector: selector}
-	if err != nil {
-		glog.Fatal(err)
-	}
-
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan,
 		syscall.SIGHUP,
@@ -271,13 +510,151 @@ func main() {
 		syscall.SIGQUIT,
 		syscall.SIGTERM)
 
+	ctrl := newController()
+	if len(*address) > 0 {
+		go ctrl.serve(*address)
+	}
+	if *leaderElect {
+		// nothing is scaled until this replica leads
+		ctrl.setStandby(true)
+		identity := *leaderElectIdentity
+		if len(identity) == 0 {
+			if identity, err = os.Hostname(); err != nil {
+				glog.Fatal(err)
+			}
+		}
+		e, err := newElector(namespace, *leaderElectLock, identity, *leaderElectLease, *leaderElectRetry, func(leading bool) {
+			ctrl.setStandby(!leading)
+		})
+		if err != nil {
+			glog.Fatal(err)
+		}
+		// a step makes at most two requests, so it ends within a retry
+		if e.client, err = electionClient(cfg, *leaderElectRetry/2); err != nil {
+			glog.Fatal(err)
+		}
+		done, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			e.run(done)
+			close(stopped)
+		}()
+		// once scaling stopped, the lease is released for another replica to take
+		defer func() {
+			close(done)
+			<-stopped
+		}()
+	}
+	var src source
+	if len(*scheduleConfigMap) > 0 {
+		if src, err = parseConfigMapSource(*scheduleConfigMap, *scheduleKey); err != nil {
+			glog.Fatal(err)
+		}
+	} else if len(*scheduleFile) > 0 {
+		src = fileSource(*scheduleFile)
+	}
+
 	glog.Info("starting scaling")
-	if err := scaler.Start(); err != nil {
-		glog.Fatal(err)
+	if src != nil {
+		data, err := src.read()
+		if err != nil {
+			glog.Fatal(err)
+		}
+		scalers, err := parseScheduleConfig(data)
+		if err != nil {
+			glog.Fatalf("invalid schedule in %v: %v", src, err)
+		}
+		ctrl.update(scalers)
+		done := make(chan struct{})
+		defer close(done)
+		go ctrl.watch(src, *reloadInterval, done)
+	} else {
+		scaler, err := flagScaler()
+		if err != nil {
+			glog.Fatal(err)
+		}
+		ctrl.update([]*Scaler{scaler})
 	}
 	<-sigChan
 	glog.Info("stopping scaling")
-	if err := scaler.Stop(); err != nil {
-		glog.Fatal(err)
+	ctrl.stopAll()
+}
+
+// flagScaler returns the Scaler of the target given by -labels, -times, -counts and -rule.
+func flagScaler() (*Scaler, error) {
+	selector, err := labels.Parse(*userLabels)
+	if err != nil {
+		return nil, err
+	}
+	loc, parse, err := zoneFor(*timezone)
+	if err != nil {
+		return nil, err
+	}
+	floors, ceilings, banded, err := splitBands(*counts)
+	if err != nil {
+		return nil, err
+	}
+	tc, err := parseTimeCountsWith(*times, floors, parse)
+	if err != nil {
+		return nil, err
+	}
+	ctc, err := parseTimeCountsWith(*times, ceilings, parse)
+	if err != nil {
+		return nil, err
+	}
+	var floorRules, ceilingRules []rule
+	for _, text := range rules {
+		floors, ceilings, b, err := splitRule(text)
+		if err != nil {
+			return nil, err
+		}
+		banded = banded || b
+		r, err := parseRule(floors, parse)
+		if err != nil {
+			return nil, err
+		}
+		floorRules = append(floorRules, r)
+		if r, err = parseRule(ceilings, parse); err != nil {
+			return nil, err
+		}
+		ceilingRules = append(ceilingRules, r)
+	}
+	if namespace == "" {
+		return nil, errors.New("POD_NAMESPACE is not set. Set to the namespace of the objects to scale if running locally.")
+	}
+	r, err := newRamp(*rampMode, *rampWindow, *rampSteps, *rampPerMinute)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := newSignal(*signalKind, *signalURL, *signalCPUTarget)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newWorkload(*resource, *apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	if sig != nil && *signalInterval <= 0 {
+		return nil, errors.New("the signal interval must be positive")
+	}
+	var cal *calendar
+	if len(*holidays) > 0 {
+		if cal, err = loadCalendar(*holidays); err != nil {
+			return nil, err
+		}
+	}
+	scaler := &Scaler{
+		name:      selector.String(),
+		namespace: namespace,
+		selector:  selector,
+		workload:  w,
+		schedule:  newSchedule(tc, floorRules, cal, loc),
+		signal:    sig,
+		interval:  *signalInterval,
+		resync:    *reconcileInterval,
+		ramp:      r,
+	}
+	if banded {
+		scaler.ceiling = newSchedule(ctc, ceilingRules, cal, loc)
 	}
+	return scaler, nil
 }
@@ -0,0 +1,273 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	apierrors "k8s.io/kubernetes/pkg/api/errors"
+	kclient "k8s.io/kubernetes/pkg/client"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// leaderAnnotation on the lock object holds the leaderRecord of the leader.
+const leaderAnnotation = "diurnal.alpha.kubernetes.io/leader"
+
+var leader = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "diurnal_leader",
+	Help: "Whether this replica of diurnal is the leader, 1 if it is and 0 otherwise.",
+})
+
+func init() {
+	prometheus.MustRegister(leader)
+}
+
+// leaderRecord is who leads, and when they last renewed their lease.
+type leaderRecord struct {
+	// HolderIdentity is the identity of the leader, empty once it gave up its lease.
+	HolderIdentity string    `json:"holderIdentity"`
+	AcquireTime    time.Time `json:"acquireTime"`
+	RenewTime      time.Time `json:"renewTime"`
+}
+
+func (r leaderRecord) equal(o leaderRecord) bool {
+	return r.HolderIdentity == o.HolderIdentity && r.AcquireTime.Equal(o.AcquireTime) && r.RenewTime.Equal(o.RenewTime)
+}
+
+// elector elects one of the replicas of diurnal as the leader, by holding a lease on
+// an Endpoints object. The lease is written with the resourceVersion it was read at,
+// so only one replica can take it. A replica takes the lease once it has seen no
+// change of it for lease. The leader renews it every retry, and steps down once it has
+// been unable to for lease less retry, before another replica could take it.
+type elector struct {
+	namespace string
+	name      string
+	identity  string
+	lease     time.Duration
+	retry     time.Duration
+
+	// leading is whether this replica leads, since renewed.
+	leading bool
+	renewed time.Time
+	// observed is the record last read, and observedTime when it was first read.
+	observed     leaderRecord
+	observedTime time.Time
+
+	// onChange is called with whether this replica leads whenever that changes. run
+	// calls it from a goroutine of its own through changes, so that a slow change does
+	// not hold up the renewal of the lease; if changes come faster, the latest wins.
+	onChange func(leading bool)
+	changes  chan bool
+	// client reads and writes the lease.
+	client *kclient.Client
+	// clock is replaced in tests.
+	clock clock
+}
+
+func newElector(namespace, name, identity string, lease, retry time.Duration, onChange func(bool)) (*elector, error) {
+	if len(namespace) == 0 || len(name) == 0 || len(identity) == 0 {
+		return nil, errors.New("leader election needs a namespace, the name of a lock and an identity")
+	}
+	if retry <= 0 || lease <= 2*retry {
+		return nil, errors.New("the lease must be more than twice the retry period")
+	}
+	return &elector{
+		namespace: namespace,
+		name:      name,
+		identity:  identity,
+		lease:     lease,
+		retry:     retry,
+		onChange:  onChange,
+		changes:   make(chan bool, 1),
+		client:    client,
+		clock:     realClock{},
+	}, nil
+}
+
+// electionClient returns a client whose requests give up after timeout, so that a slow
+// API server can't keep the leader scaling after its lease ran out.
+func electionClient(cfg *kclient.Config, timeout time.Duration) (*kclient.Client, error) {
+	c, err := kclient.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := kclient.TransportFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.Client = &http.Client{Transport: transport, Timeout: timeout}
+	return c, nil
+}
+
+// tryAcquireOrRenew takes or renews the lease at now. It returns false if another
+// replica holds the lease, and an error if the lease could not be read or written.
+func (e *elector) tryAcquireOrRenew(now time.Time) (bool, error) {
+	mine := leaderRecord{HolderIdentity: e.identity, AcquireTime: now, RenewTime: now}
+	ep, err := e.client.Endpoints(e.namespace).Get(e.name)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		ep = &api.Endpoints{ObjectMeta: api.ObjectMeta{Namespace: e.namespace, Name: e.name}}
+		if err := setLeaderRecord(ep, mine); err != nil {
+			return false, err
+		}
+		if _, err := e.client.Endpoints(e.namespace).Create(ep); err != nil {
+			return false, err
+		}
+		e.observe(mine, now)
+		return true, nil
+	}
+
+	var record leaderRecord
+	if data, ok := ep.Annotations[leaderAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			glog.Errorf("ignoring invalid %s of %s: %v", leaderAnnotation, e.name, err)
+		}
+	}
+	e.observe(record, now)
+	held := len(record.HolderIdentity) > 0
+	if held && record.HolderIdentity != e.identity && now.Before(e.observedTime.Add(e.lease)) {
+		return false, nil
+	}
+	if record.HolderIdentity == e.identity {
+		mine.AcquireTime = record.AcquireTime
+	}
+	if err := setLeaderRecord(ep, mine); err != nil {
+		return false, err
+	}
+	if _, err := e.client.Endpoints(e.namespace).Update(ep); err != nil {
+		return false, err
+	}
+	e.observe(mine, now)
+	return true, nil
+}
+
+// observe notes record, read at now.
+func (e *elector) observe(record leaderRecord, now time.Time) {
+	if !record.equal(e.observed) {
+		e.observed = record
+		e.observedTime = now
+	}
+}
+
+func setLeaderRecord(ep *api.Endpoints, record leaderRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if ep.Annotations == nil {
+		ep.Annotations = map[string]string{}
+	}
+	ep.Annotations[leaderAnnotation] = string(data)
+	return nil
+}
+
+// step tries to take or renew the lease once, and sends to changes if that changes
+// whether this replica leads.
+func (e *elector) step() {
+	now := e.clock.Now()
+	ok, err := e.tryAcquireOrRenew(now)
+	leading := ok
+	switch {
+	case ok:
+		e.renewed = now
+	case err != nil && e.leading && e.clock.Now().Sub(e.renewed) < e.lease-e.retry:
+		glog.Errorf("unable to renew the lease %s, still leading: %v", e.name, err)
+		leading = true
+	case err != nil:
+		glog.Errorf("unable to take the lease %s: %v", e.name, err)
+	}
+	if leading == e.leading {
+		return
+	}
+	e.leading = leading
+	if leading {
+		glog.Infof("leading as %s", e.identity)
+		leader.Set(1)
+	} else {
+		glog.Infof("no longer leading, the leader is %q", e.observed.HolderIdentity)
+		leader.Set(0)
+	}
+	e.notify(leading)
+}
+
+// notify sends leading to changes, replacing a change which wasn't applied yet.
+func (e *elector) notify(leading bool) {
+	select {
+	case <-e.changes:
+	default:
+	}
+	e.changes <- leading
+}
+
+// release gives up the lease, if this replica holds it, so that another replica can
+// take it at once.
+func (e *elector) release() {
+	if !e.leading {
+		return
+	}
+	e.leading = false
+	leader.Set(0)
+	e.onChange(false)
+	ep, err := e.client.Endpoints(e.namespace).Get(e.name)
+	if err != nil {
+		glog.Errorf("unable to release the lease %s: %v", e.name, err)
+		return
+	}
+	var record leaderRecord
+	if err := json.Unmarshal([]byte(ep.Annotations[leaderAnnotation]), &record); err != nil || record.HolderIdentity != e.identity {
+		// the lease was taken over already
+		return
+	}
+	if err := setLeaderRecord(ep, leaderRecord{}); err != nil {
+		glog.Errorf("unable to release the lease %s: %v", e.name, err)
+		return
+	}
+	if _, err := e.client.Endpoints(e.namespace).Update(ep); err != nil {
+		glog.Errorf("unable to release the lease %s: %v", e.name, err)
+	}
+}
+
+// run takes part in the election every retry until done is closed, then releases the
+// lease once the last change was applied.
+func (e *elector) run(done <-chan struct{}) {
+	applied := make(chan struct{})
+	go func() {
+		defer close(applied)
+		for leading := range e.changes {
+			e.onChange(leading)
+		}
+	}()
+	for {
+		e.step()
+		select {
+		case <-done:
+			close(e.changes)
+			<-applied
+			e.release()
+			return
+		case <-e.clock.After(e.retry):
+		}
+	}
+}
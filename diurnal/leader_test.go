@@ -0,0 +1,388 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	kclient "k8s.io/kubernetes/pkg/client"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// fakeLock serves the Endpoints object ns/diurnal, and rejects updates of it which
+// were not read at its latest version.
+type fakeLock struct {
+	lock        sync.Mutex
+	version     int
+	annotations map[string]string
+	// failing fails every request
+	failing bool
+}
+
+func (f *fakeLock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	const (
+		path     = "/api/v1/namespaces/ns/endpoints"
+		notFound = `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`
+		exists   = `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "AlreadyExists", "code": 409}`
+	)
+	if f.failing {
+		http.Error(w, "broken", http.StatusInternalServerError)
+		return
+	}
+	var body struct {
+		Metadata struct {
+			ResourceVersion string            `json:"resourceVersion"`
+			Annotations     map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if r.Method == "POST" || r.Method == "PUT" {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	switch {
+	case r.Method == "GET" && r.URL.Path == path+"/diurnal":
+		if f.version == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, notFound)
+			return
+		}
+	case r.Method == "POST" && r.URL.Path == path:
+		if f.version > 0 {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, exists)
+			return
+		}
+		f.version++
+		f.annotations = body.Metadata.Annotations
+	case r.Method == "PUT" && r.URL.Path == path+"/diurnal":
+		if body.Metadata.ResourceVersion != strconv.Itoa(f.version) {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, testConflict)
+			return
+		}
+		f.version++
+		f.annotations = body.Metadata.Annotations
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"kind":       "Endpoints",
+		"apiVersion": "v1",
+		"metadata": map[string]interface{}{
+			"name":            "diurnal",
+			"namespace":       "ns",
+			"resourceVersion": strconv.Itoa(f.version),
+			"annotations":     f.annotations,
+		},
+	})
+	w.Write(data)
+}
+
+func (f *fakeLock) holder() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var record leaderRecord
+	json.Unmarshal([]byte(f.annotations[leaderAnnotation]), &record)
+	return record.HolderIdentity
+}
+
+func TestElector(t *testing.T) {
+	lock := &fakeLock{}
+	server := httptest.NewServer(lock)
+	defer server.Close()
+	var err error
+	client, err = kclient.New(&kclient.Config{Host: server.URL, Version: "v1", QPS: 1000, Burst: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { client = nil }()
+
+	start := timeMustParse(time.RFC3339, "2015-12-01T12:00:00Z")
+	var changes []string
+	electors := map[string]*elector{}
+	for _, id := range []string{"a", "b"} {
+		id := id
+		e, err := newElector("ns", "diurnal", id, 15*time.Second, 2*time.Second, func(leading bool) {
+			changes = append(changes, fmt.Sprintf("%s %v", id, leading))
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		e.clock = &fakeClock{now: start}
+		electors[id] = e
+	}
+
+	steps := []struct {
+		// after is the time since start of the step
+		after   time.Duration
+		id      string
+		failing bool
+		// release gives up the lease instead of stepping
+		release bool
+		leading bool
+		holder  string
+	}{
+		{0, "a", false, false, true, "a"},
+		{0, "b", false, false, false, "a"},
+		{2 * time.Second, "a", false, false, true, "a"},
+		{2 * time.Second, "b", false, false, false, "a"},
+		// a keeps leading while it is unable to renew, until it could be taken over
+		{4 * time.Second, "a", true, false, true, "a"},
+		{14 * time.Second, "a", true, false, true, "a"},
+		{15 * time.Second, "a", true, false, false, "a"},
+		// b last saw a change at 2s
+		{16 * time.Second, "b", false, false, false, "a"},
+		{17 * time.Second, "b", false, false, true, "b"},
+		{18 * time.Second, "a", false, false, false, "b"},
+		{19 * time.Second, "b", false, false, true, "b"},
+		// a takes over as soon as b gives up
+		{20 * time.Second, "b", false, true, false, ""},
+		{20 * time.Second, "a", false, false, true, "a"},
+	}
+	for i, test := range steps {
+		e := electors[test.id]
+		e.clock.(*fakeClock).now = start.Add(test.after)
+		lock.lock.Lock()
+		lock.failing = test.failing
+		lock.lock.Unlock()
+		if test.release {
+			e.release()
+		} else {
+			e.step()
+			select {
+			case leading := <-e.changes:
+				e.onChange(leading)
+			default:
+			}
+		}
+		if e.leading != test.leading {
+			t.Errorf("step %d: expected %s leading %v", i, test.id, test.leading)
+		}
+		lock.lock.Lock()
+		lock.failing = false
+		lock.lock.Unlock()
+		if holder := lock.holder(); holder != test.holder {
+			t.Errorf("step %d: expected holder %q got %q", i, test.holder, holder)
+		}
+	}
+	expected := []string{"a true", "a false", "b true", "b false", "a true"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v got %v", expected, changes)
+	}
+}
+
+func TestElectorSlowChange(t *testing.T) {
+	lock := &fakeLock{}
+	server := httptest.NewServer(lock)
+	defer server.Close()
+	var err error
+	client, err = kclient.New(&kclient.Config{Host: server.URL, Version: "v1", QPS: 1000, Burst: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { client = nil }()
+
+	var (
+		changes []bool
+		unblock = make(chan struct{})
+	)
+	e, err := newElector("ns", "diurnal", "a", 15*time.Second, 2*time.Second, func(leading bool) {
+		<-unblock
+		changes = append(changes, leading)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e.clock = &fakeClock{now: timeMustParse(time.RFC3339, "2015-12-01T12:00:00Z")}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		e.run(done)
+		close(stopped)
+	}()
+	// the lease is renewed while the change is being applied
+	for {
+		lock.lock.Lock()
+		version := lock.version
+		lock.lock.Unlock()
+		if version > 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(unblock)
+	close(done)
+	<-stopped
+	if expected := []bool{true, false}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v got %v", expected, changes)
+	}
+	if holder := lock.holder(); holder != "" {
+		t.Errorf("expected the lease to be released, held by %q", holder)
+	}
+}
+
+func TestElectionClientTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer server.Close()
+	defer close(hang)
+
+	e, err := newElector("ns", "diurnal", "a", 15*time.Second, 2*time.Second, func(bool) {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.client, err = electionClient(&kclient.Config{Host: server.URL, Version: "v1"}, 50*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	finished := make(chan struct{})
+	go func() {
+		e.step()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("step did not give up on a hung API server")
+	}
+	if e.leading {
+		t.Errorf("expected not to lead")
+	}
+}
+
+func TestNewElector(t *testing.T) {
+	cases := []struct {
+		namespace string
+		identity  string
+		lease     time.Duration
+		retry     time.Duration
+		err       bool
+	}{
+		{"ns", "a", 15 * time.Second, 2 * time.Second, false},
+		{"", "a", 15 * time.Second, 2 * time.Second, true},
+		{"ns", "", 15 * time.Second, 2 * time.Second, true},
+		{"ns", "a", 4 * time.Second, 2 * time.Second, true},
+		{"ns", "a", 15 * time.Second, 0, true},
+	}
+	for i, test := range cases {
+		_, err := newElector(test.namespace, "diurnal", test.identity, test.lease, test.retry, func(bool) {})
+		if test.err != (err != nil) {
+			t.Errorf("case %d: expected error %v got %v", i, test.err, err)
+		}
+	}
+}
+
+func TestControllerStandby(t *testing.T) {
+	def, err := parseTimeCounts("00:00Z", "2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var started, stopped []string
+	c := newController()
+	c.start = func(s *Scaler) error {
+		started = append(started, s.name)
+		return nil
+	}
+	c.stop = func(s *Scaler) error {
+		stopped = append(stopped, s.name)
+		return nil
+	}
+	target := func(name string) *Scaler {
+		return &Scaler{name: name, selector: labels.Everything(), schedule: newSchedule(def, nil, nil, time.UTC)}
+	}
+	c.setStandby(true)
+	c.update([]*Scaler{target("a")})
+	c.setStandby(false)
+	c.update([]*Scaler{target("a"), target("b")})
+	c.setStandby(true)
+	c.update([]*Scaler{target("c")})
+	c.setStandby(false)
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(started, expected) {
+		t.Errorf("expected started %v got %v", expected, started)
+	}
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(stopped, expected) {
+		t.Errorf("expected stopped %v got %v", expected, stopped)
+	}
+}
+
+func TestControllerStandbyRestart(t *testing.T) {
+	def, err := parseTimeCounts("00:00Z,12:00Z", "2,4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var (
+		lock sync.Mutex
+		// running is whether the controller may scale, and setting whether a count is
+		// being set
+		running, setting bool
+		sets             = make(chan struct{}, 1)
+	)
+	s := &Scaler{
+		name:     "a",
+		selector: labels.Everything(),
+		schedule: newSchedule(def, nil, nil, time.UTC),
+		clock:    &fakeClock{now: timeMustParse(time.RFC3339, "2015-12-01T11:35:00Z")},
+	}
+	s.set = func(s *Scaler, count int) {
+		lock.Lock()
+		if !running {
+			t.Errorf("count set in standby")
+		}
+		if setting {
+			t.Errorf("count set by two scaling loops at once")
+		}
+		setting = true
+		lock.Unlock()
+		time.Sleep(time.Millisecond)
+		lock.Lock()
+		setting = false
+		lock.Unlock()
+		select {
+		case sets <- struct{}{}:
+		default:
+		}
+	}
+	c := newController()
+	c.setStandby(true)
+	c.update([]*Scaler{s})
+	for i := 0; i < 3; i++ {
+		lock.Lock()
+		running = true
+		lock.Unlock()
+		c.setStandby(false)
+		<-sets
+		<-sets
+		c.setStandby(true)
+		lock.Lock()
+		running = false
+		lock.Unlock()
+	}
+	c.stopAll()
+}
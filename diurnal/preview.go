@@ -0,0 +1,201 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// action is one change of the count of a target in a preview.
+type action struct {
+	Time   time.Time `json:"time"`
+	Target string    `json:"target"`
+	Count  int       `json:"replicas"`
+	// Rule is the rule of the day the count comes from.
+	Rule string `json:"rule"`
+}
+
+// simClock passes the time waited for at once, until end. Waiting past end closes
+// ended and never returns.
+type simClock struct {
+	now   time.Time
+	end   time.Time
+	ended chan struct{}
+}
+
+func (c *simClock) Now() time.Time { return c.now }
+
+func (c *simClock) After(d time.Duration) <-chan time.Time {
+	if c.now.Add(d).After(c.end) {
+		close(c.ended)
+		return nil
+	}
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// simulate runs s from from until to with a simulated clock and returns the count it
+// starts with and every change of it. The signal is not read, so the floor of a band
+// is used, and the count is not reconciled, which never changes it.
+func simulate(s *Scaler, from, to time.Time) ([]action, error) {
+	clock := &simClock{now: from, end: to, ended: make(chan struct{})}
+	var actions []action
+	s.clock = clock
+	s.signal = nil
+	s.resync = 0
+	s.set = func(s *Scaler, count int) {
+		if len(actions) > 0 && actions[len(actions)-1].Count == count {
+			return
+		}
+		t := s.scheduleTime()
+		actions = append(actions, action{
+			Time:   clock.Now().In(s.schedule.location),
+			Target: s.name,
+			Count:  count,
+			Rule:   s.schedule.ruleFor(s.schedule.dateOf(t)).text,
+		})
+	}
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	// the scaling loop waits for done once the clock has ended, and sets no more
+	// counts, so actions can be read
+	<-clock.ended
+	if err := s.Stop(); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// actionsByTime sorts actions by time, then target.
+type actionsByTime []action
+
+func (a actionsByTime) Len() int      { return len(a) }
+func (a actionsByTime) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a actionsByTime) Less(i, j int) bool {
+	if !a[i].Time.Equal(a[j].Time) {
+		return a[i].Time.Before(a[j].Time)
+	}
+	return a[i].Target < a[j].Target
+}
+
+// writeActions writes actions as a table or as JSON.
+func writeActions(w io.Writer, actions []action, format string) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tTARGET\tREPLICAS\tRULE")
+		for _, a := range actions {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", a.Time.Format(time.RFC3339), a.Target, a.Count, a.Rule)
+		}
+		return tw.Flush()
+	case "json":
+		if actions == nil {
+			actions = []action{}
+		}
+		data, err := json.MarshalIndent(actions, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+const previewUsageNotes = `
+preview prints the counts the schedule given by the flags above would set from
+-from for -for, without contacting the API server. Signals are not read, so the
+floor of a band is shown. Example usage:
+  diurnal preview -schedule-file schedule.yaml -from 2015-12-24T00:00:00Z -for 72h -format json
+`
+
+// preview runs the preview subcommand with args.
+func preview(args []string) error {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	// the schedule is given as it is to the controller
+	flag.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	var (
+		from   = fs.String("from", "", "start of the preview following RFC 3339 (default now)")
+		window = fs.Duration("for", 24*time.Hour, "length of the preview")
+		format = fs.String("format", "table", "output format: table or json")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s preview:\n", os.Args[0])
+		fs.PrintDefaults()
+		fmt.Fprint(os.Stderr, previewUsageNotes)
+	}
+	fs.Parse(args)
+
+	start := time.Now()
+	if len(*from) > 0 {
+		var err error
+		if start, err = time.Parse(time.RFC3339, *from); err != nil {
+			return err
+		}
+	}
+	if *window <= 0 {
+		return errors.New("the preview must be longer than 0")
+	}
+	if len(*scheduleConfigMap) > 0 {
+		return errors.New("a preview cannot read a ConfigMap, use -schedule-file")
+	}
+	// the namespace does not matter offline
+	if len(namespace) == 0 {
+		namespace = "default"
+	}
+	var scalers []*Scaler
+	if len(*scheduleFile) > 0 {
+		data, err := ioutil.ReadFile(*scheduleFile)
+		if err != nil {
+			return err
+		}
+		if scalers, err = parseScheduleConfig(data); err != nil {
+			return fmt.Errorf("invalid schedule in %s: %v", *scheduleFile, err)
+		}
+	} else {
+		s, err := flagScaler()
+		if err != nil {
+			return err
+		}
+		scalers = []*Scaler{s}
+	}
+
+	var actions []action
+	for _, s := range scalers {
+		a, err := simulate(s, start, start.Add(*window))
+		if err != nil {
+			return fmt.Errorf("target %s: %v", s.name, err)
+		}
+		actions = append(actions, a...)
+	}
+	sort.Stable(actionsByTime(actions))
+	return writeActions(os.Stdout, actions, *format)
+}
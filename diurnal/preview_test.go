@@ -0,0 +1,116 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+	def, err := parseTimeCounts("06:00Z,12:00Z,22:00Z", "4,4,2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	weekend, err := parseRule("sat,sun 00:00Z 1", parseTimeRelative)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r, err := newRamp(rampLinear, 20*time.Minute, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := &Scaler{
+		name:     "redis",
+		schedule: newSchedule(def, []rule{weekend}, nil, time.UTC),
+		ramp:     r,
+		// neither is used in a preview
+		signal: &fakeSignal{},
+		resync: time.Minute,
+	}
+	// Friday morning to Saturday noon, the count set again at noon is not a change
+	from := timeMustParse(time.RFC3339, "2015-12-04T10:00:00Z")
+	actions, err := simulate(s, from, from.Add(26*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []scaleEvent{
+		{"2015-12-04T10:00:00Z", 4},
+		{"2015-12-04T22:00:00Z", 3},
+		{"2015-12-04T22:10:00Z", 2},
+		{"2015-12-05T00:00:00Z", 1},
+	}
+	var got []scaleEvent
+	for _, a := range actions {
+		if a.Target != "redis" {
+			t.Errorf("unexpected target %s", a.Target)
+		}
+		got = append(got, scaleEvent{a.Time.Format(time.RFC3339), a.Count})
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v got %v", expected, got)
+	}
+	if len(actions) == len(expected) && (actions[2].Rule != "default" || actions[3].Rule != "sat,sun 00:00Z 1") {
+		t.Errorf("unexpected rules %q and %q", actions[2].Rule, actions[3].Rule)
+	}
+}
+
+func TestWriteActions(t *testing.T) {
+	actions := []action{
+		{timeMustParse(time.RFC3339, "2015-12-04T12:00:00Z"), "redis", 4, "default"},
+		{timeMustParse(time.RFC3339, "2015-12-05T00:00:00Z"), "web", 10, "sat,sun"},
+	}
+	cases := []struct {
+		actions  []action
+		format   string
+		expected string
+		err      bool
+	}{
+		{actions, "table", `TIME                  TARGET  REPLICAS  RULE
+2015-12-04T12:00:00Z  redis   4         default
+2015-12-05T00:00:00Z  web     10        sat,sun
+`, false},
+		{actions[:1], "json", `[
+  {
+    "time": "2015-12-04T12:00:00Z",
+    "target": "redis",
+    "replicas": 4,
+    "rule": "default"
+  }
+]
+`, false},
+		{nil, "json", "[]\n", false},
+		{actions, "yaml", "", true},
+	}
+	for i, test := range cases {
+		var buf bytes.Buffer
+		err := writeActions(&buf, test.actions, test.format)
+		if test.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if buf.String() != test.expected {
+			t.Errorf("case %d: expected\n%s\ngot\n%s", i, test.expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// The modes of a ramp.
+const (
+	rampNone = "none"
+	// rampLinear changes the count one replica at a time, evenly over the window.
+	rampLinear = "linear"
+	// rampStep changes the count in a fixed number of steps, evenly over the window.
+	rampStep = "step"
+	// rampRate changes the count by at most a number of replicas per minute.
+	rampRate = "rate"
+)
+
+// ramp spreads a change of the count over time, starting at the time of the change.
+type ramp struct {
+	mode   string
+	window time.Duration
+	steps  int
+	// rate is the largest change per minute.
+	rate int
+}
+
+// newRamp returns the ramp of mode, or nil if mode is empty or none.
+func newRamp(mode string, window time.Duration, steps, rate int) (*ramp, error) {
+	r := &ramp{mode: mode, window: window, steps: steps, rate: rate}
+	switch mode {
+	case "", rampNone:
+		return nil, nil
+	case rampLinear:
+		if window <= 0 {
+			return nil, fmt.Errorf("a %s ramp needs a positive window", mode)
+		}
+	case rampStep:
+		if window <= 0 || steps <= 0 {
+			return nil, fmt.Errorf("a %s ramp needs a positive window and number of steps", mode)
+		}
+	case rampRate:
+		if rate <= 0 {
+			return nil, fmt.Errorf("a %s ramp needs a positive rate", mode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown ramp %q, must be one of %s, %s, %s or %s", mode, rampNone, rampLinear, rampStep, rampRate)
+	}
+	return r, nil
+}
+
+// step is a count to set at a time.
+type step struct {
+	time  time.Time
+	count int
+}
+
+// plan returns the steps from the count from to the count to, the first of which is
+// at. The last step sets to. Without a ramp, or if from is unknown, there is just
+// that step.
+func (r *ramp) plan(from, to int, at time.Time) []step {
+	n := to - from
+	if n < 0 {
+		n = -n
+	}
+	if r == nil || n == 0 || from < 0 {
+		return []step{{at, to}}
+	}
+	var steps int
+	switch r.mode {
+	case rampLinear:
+		steps = n
+	case rampStep:
+		steps = r.steps
+		if steps > n {
+			steps = n
+		}
+	case rampRate:
+		steps = (n + r.rate - 1) / r.rate
+	}
+	plan := make([]step, 0, steps)
+	for k := 1; k <= steps; k++ {
+		var t time.Time
+		if r.mode == rampRate {
+			t = at.Add(time.Duration(k-1) * time.Minute)
+		} else {
+			t = at.Add(r.window * time.Duration(k-1) / time.Duration(steps))
+		}
+		plan = append(plan, step{t, from + (to-from)*k/steps})
+	}
+	return plan
+}
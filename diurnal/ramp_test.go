@@ -0,0 +1,158 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewRamp(t *testing.T) {
+	cases := []struct {
+		mode   string
+		window time.Duration
+		steps  int
+		rate   int
+		isNil  bool
+		err    bool
+	}{
+		{"", 0, 0, 0, true, false},
+		{rampNone, time.Hour, 0, 0, true, false},
+		{rampLinear, time.Hour, 0, 0, false, false},
+		{rampLinear, 0, 0, 0, false, true},
+		{rampStep, time.Hour, 3, 0, false, false},
+		{rampStep, time.Hour, 0, 0, false, true},
+		{rampStep, 0, 3, 0, false, true},
+		{rampRate, 0, 0, 2, false, false},
+		{rampRate, time.Hour, 0, 0, false, true},
+		{"exponential", time.Hour, 0, 0, false, true},
+	}
+	for i, test := range cases {
+		r, err := newRamp(test.mode, test.window, test.steps, test.rate)
+		if test.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if (r == nil) != test.isNil {
+			t.Errorf("case %d: expected nil ramp %v got %v", i, test.isNil, r)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	at := timeMustParse(time.RFC3339, "2015-12-01T06:00:00Z")
+	cases := []struct {
+		ramp     *ramp
+		from, to int
+		expected []scaleEvent
+	}{
+		{nil, 6, 20, []scaleEvent{{"06:00:00", 20}}},
+		{&ramp{mode: rampLinear, window: 30 * time.Minute}, 6, 6, []scaleEvent{{"06:00:00", 6}}},
+		// the count before is unknown
+		{&ramp{mode: rampLinear, window: 30 * time.Minute}, -1, 6, []scaleEvent{{"06:00:00", 6}}},
+		{&ramp{mode: rampLinear, window: 30 * time.Minute}, 6, 9, []scaleEvent{
+			{"06:00:00", 7}, {"06:10:00", 8}, {"06:20:00", 9},
+		}},
+		{&ramp{mode: rampLinear, window: 10 * time.Minute}, 4, 0, []scaleEvent{
+			{"06:00:00", 3}, {"06:02:30", 2}, {"06:05:00", 1}, {"06:07:30", 0},
+		}},
+		{&ramp{mode: rampStep, window: 30 * time.Minute, steps: 3}, 6, 20, []scaleEvent{
+			{"06:00:00", 10}, {"06:10:00", 15}, {"06:20:00", 20},
+		}},
+		{&ramp{mode: rampStep, window: 30 * time.Minute, steps: 3}, 20, 6, []scaleEvent{
+			{"06:00:00", 16}, {"06:10:00", 11}, {"06:20:00", 6},
+		}},
+		// no more steps than replicas to change
+		{&ramp{mode: rampStep, window: 30 * time.Minute, steps: 3}, 1, 3, []scaleEvent{
+			{"06:00:00", 2}, {"06:15:00", 3},
+		}},
+		{&ramp{mode: rampRate, rate: 5}, 6, 20, []scaleEvent{
+			{"06:00:00", 10}, {"06:01:00", 15}, {"06:02:00", 20},
+		}},
+		{&ramp{mode: rampRate, rate: 2}, 5, 0, []scaleEvent{
+			{"06:00:00", 4}, {"06:01:00", 2}, {"06:02:00", 0},
+		}},
+	}
+	for i, test := range cases {
+		var got []scaleEvent
+		for _, s := range test.ramp.plan(test.from, test.to, at) {
+			got = append(got, scaleEvent{s.time.Format("15:04:05"), s.count})
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("case %d: expected %v got %v", i, test.expected, got)
+		}
+	}
+}
+
+func TestScalerRamp(t *testing.T) {
+	def, err := parseTimeCounts("06:00Z,06:10Z,12:00Z", "10,2,4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []scaleEvent{
+		{"05:00:00", 4},
+		{"06:00:00", 5},
+		{"06:05:00", 6},
+		// the ramp to 10 is cut short by the change to 2
+		{"06:10:00", 5},
+		{"06:17:30", 4},
+		{"06:25:00", 3},
+		{"06:32:30", 2},
+		{"12:00:00", 3},
+		{"12:15:00", 4},
+	}
+
+	var (
+		lock     sync.Mutex
+		events   []scaleEvent
+		finished = make(chan struct{})
+	)
+	clock := &fakeClock{now: timeMustParse(time.RFC3339, "2015-12-01T05:00:00Z")}
+	s := &Scaler{
+		name:     "test",
+		schedule: newSchedule(def, nil, nil, time.UTC),
+		ramp:     &ramp{mode: rampLinear, window: 30 * time.Minute},
+		clock:    clock,
+	}
+	s.set = func(s *Scaler, count int) {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(events) == len(expected) {
+			return
+		}
+		events = append(events, scaleEvent{clock.Now().UTC().Format("15:04:05"), count})
+		if len(events) == len(expected) {
+			close(finished)
+		}
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-finished
+	s.Stop()
+	lock.Lock()
+	defer lock.Unlock()
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v got %v", expected, events)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	apierrors "k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/util"
+
+	"github.com/golang/glog"
+)
+
+// pausedUntilAnnotation on an object stops diurnal from scaling it until the time it
+// holds, in RFC 3339 format, so that it can be scaled by hand.
+const pausedUntilAnnotation = "diurnal.alpha.kubernetes.io/paused-until"
+
+var (
+	// maxAttempts is how many times scaling an object is tried when it conflicts with
+	// another change.
+	maxAttempts = 5
+	// retryBackoff is the wait before the first retry, doubled for every retry after.
+	retryBackoff = time.Second
+
+	// errStopped is returned when the Scaler is stopped while it waits to retry.
+	errStopped = errors.New("stopped scaling")
+
+	// createEvent is replaced in tests.
+	createEvent = func(event *api.Event) error {
+		_, err := client.Events(event.Namespace).Create(event)
+		return err
+	}
+)
+
+// recordEvent records an event about obj.
+func (s *Scaler) recordEvent(obj *object, reason, format string, args ...interface{}) {
+	now := util.NewTime(s.clock.Now())
+	event := &api.Event{
+		ObjectMeta: api.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", obj.name, now.UnixNano()),
+			Namespace: obj.namespace,
+		},
+		InvolvedObject: api.ObjectReference{
+			Kind:            obj.kind,
+			Namespace:       obj.namespace,
+			Name:            obj.name,
+			UID:             obj.uid,
+			ResourceVersion: obj.resourceVersion,
+		},
+		Reason:         reason,
+		Message:        fmt.Sprintf(format, args...),
+		Source:         api.EventSource{Component: "diurnal"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if err := createEvent(event); err != nil {
+		glog.Errorf("unable to record event %s of %s %s: %v", reason, obj.kind, obj.name, err)
+	}
+}
+
+// pausedUntil returns the time scaling of obj is paused until, if it is paused at now.
+func pausedUntil(obj *object, now time.Time) (time.Time, bool) {
+	value, ok := obj.annotations[pausedUntilAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		glog.Errorf("ignoring %s of %s %s: %v", pausedUntilAnnotation, obj.kind, obj.name, err)
+		return time.Time{}, false
+	}
+	return until, now.Before(until)
+}
+
+// scaleObject scales obj to c unless it is paused, and returns the replicas obj is
+// left with. If obj was changed since it was read, it is read again and scaling
+// retried, with a backoff. Stopping the Scaler ends the backoff with errStopped.
+func (s *Scaler) scaleObject(obj *object, c int) (int, error) {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		if until, paused := pausedUntil(obj, s.clock.Now()); paused {
+			glog.V(2).Infof("not scaling %s %s, paused until %v", obj.kind, obj.name, until)
+			return obj.replicas, nil
+		}
+		if obj.replicas == c {
+			return c, nil
+		}
+		err := s.workload.setReplicas(obj, c)
+		if err == nil {
+			s.recordEvent(obj, "Scaled", "Scaled from %d to %d replicas for target %s", obj.replicas, c, s.name)
+			return c, nil
+		}
+		if !apierrors.IsConflict(err) || attempt == maxAttempts {
+			glog.Errorf("unable to scale %s %s: %v", obj.kind, obj.name, err)
+			s.recordEvent(obj, "FailedScale", "Unable to scale from %d to %d replicas for target %s: %v", obj.replicas, c, s.name, err)
+			return obj.replicas, err
+		}
+		glog.V(2).Infof("%s %s changed while scaling it, retrying in %v", obj.kind, obj.name, backoff)
+		select {
+		case <-s.done:
+			glog.V(2).Infof("stopped scaling %s %s", obj.kind, obj.name)
+			return obj.replicas, errStopped
+		case <-s.clock.After(backoff):
+		}
+		backoff *= 2
+		latest, err := s.workload.get(obj)
+		if err != nil {
+			glog.Errorf("could not get %s %s: %v", obj.kind, obj.name, err)
+			return obj.replicas, err
+		}
+		obj = latest
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	kclient "k8s.io/kubernetes/pkg/client"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+func TestPausedUntil(t *testing.T) {
+	now := timeMustParse(time.RFC3339, "2015-12-01T12:00:00Z")
+	cases := []struct {
+		annotations map[string]string
+		paused      bool
+	}{
+		{nil, false},
+		{map[string]string{pausedUntilAnnotation: "2015-12-01T13:00:00Z"}, true},
+		{map[string]string{pausedUntilAnnotation: "2015-12-01T08:00:00-05:00"}, true},
+		{map[string]string{pausedUntilAnnotation: "2015-12-01T11:00:00Z"}, false},
+		{map[string]string{pausedUntilAnnotation: "2015-12-01T12:00:00Z"}, false},
+		{map[string]string{pausedUntilAnnotation: "tomorrow"}, false},
+	}
+	for i, test := range cases {
+		obj := &object{kind: "ReplicationController", name: "redis", annotations: test.annotations}
+		if _, paused := pausedUntil(obj, now); paused != test.paused {
+			t.Errorf("case %d: expected paused %v got %v", i, test.paused, paused)
+		}
+	}
+}
+
+const testRC = `{"kind": "ReplicationController", "apiVersion": "v1",
+  "metadata": {"name": "redis", "namespace": "ns", "resourceVersion": "%d", "annotations": {%s}},
+  "spec": {"replicas": %d, "selector": {"name": "redis"}}}`
+
+const testConflict = `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "Conflict", "code": 409}`
+
+func TestSetCount(t *testing.T) {
+	now := timeMustParse(time.RFC3339, "2015-12-01T12:00:00Z")
+	cases := []struct {
+		replicas    int
+		annotations string
+		// conflicts is how many updates conflict before one succeeds, -1 for an error
+		conflicts int
+		puts      int
+		events    []string
+		// actual is the replicas left, as recorded in the result of the scaling
+		actual int
+	}{
+		{3, "", 0, 1, []string{"Scaled: Scaled from 3 to 5 replicas for target redis"}, 5},
+		{3, "", 2, 3, []string{"Scaled: Scaled from 3 to 5 replicas for target redis"}, 5},
+		{3, "", maxAttempts, maxAttempts, []string{"FailedScale"}, 3},
+		{3, "", -1, 1, []string{"FailedScale"}, 3},
+		{5, "", 0, 0, nil, 5},
+		{3, `"diurnal.alpha.kubernetes.io/paused-until": "2015-12-01T13:00:00Z"`, 0, 0, nil, 3},
+		{3, `"diurnal.alpha.kubernetes.io/paused-until": "2015-12-01T11:00:00Z"`, 0, 1, []string{"Scaled: Scaled from 3 to 5 replicas for target redis"}, 5},
+	}
+	for i, test := range cases {
+		var (
+			lock   sync.Mutex
+			puts   int
+			events []string
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			rc := fmt.Sprintf(testRC, puts, test.annotations, test.replicas)
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/api/v1/namespaces/ns/replicationcontrollers":
+				fmt.Fprintf(w, `{"kind": "ReplicationControllerList", "apiVersion": "v1", "items": [%s]}`, rc)
+			case r.Method == "GET" && r.URL.Path == "/api/v1/namespaces/ns/replicationcontrollers/redis":
+				fmt.Fprint(w, rc)
+			case r.Method == "PUT" && r.URL.Path == "/api/v1/namespaces/ns/replicationcontrollers/redis":
+				puts++
+				switch {
+				case test.conflicts < 0:
+					http.Error(w, "broken", http.StatusInternalServerError)
+				case puts <= test.conflicts:
+					w.WriteHeader(http.StatusConflict)
+					fmt.Fprint(w, testConflict)
+				default:
+					fmt.Fprint(w, rc)
+				}
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		var err error
+		client, err = kclient.New(&kclient.Config{Host: server.URL, Version: "v1", QPS: 1000, Burst: 1000})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		createEvent = func(event *api.Event) error {
+			if event.InvolvedObject.Name != "redis" || event.Namespace != "ns" {
+				t.Errorf("case %d: event about the wrong object: %+v", i, event)
+			}
+			msg := event.Reason
+			if event.Reason == "Scaled" {
+				msg += ": " + event.Message
+			}
+			events = append(events, msg)
+			return nil
+		}
+		selector, err := labels.Parse("name=redis")
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		s := &Scaler{name: "redis", namespace: "ns", selector: selector, workload: rcWorkload{}, clock: &fakeClock{now: now}}
+		s.setCount(5)
+		server.Close()
+
+		if puts != test.puts {
+			t.Errorf("case %d: expected %d updates got %d", i, test.puts, puts)
+		}
+		if !reflect.DeepEqual(events, test.events) {
+			t.Errorf("case %d: expected events %v got %v", i, test.events, events)
+		}
+		failed := len(test.events) > 0 && test.events[0] == "FailedScale"
+		if r := s.last; r == nil || r.Replicas != 5 || r.Actual != test.actual || r.Objects != 1 || (r.Failures > 0) != failed {
+			t.Errorf("case %d: unexpected result %+v", i, r)
+		}
+	}
+	client = nil
+}
+
+func TestScalerReconcile(t *testing.T) {
+	def, err := parseTimeCounts("00:00Z,12:00Z", "2,4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []scaleEvent{
+		{"11:35:00", 2},
+		{"11:45:00", 2},
+		{"11:55:00", 2},
+		{"12:00:00", 4},
+		{"12:10:00", 4},
+	}
+
+	var (
+		lock     sync.Mutex
+		events   []scaleEvent
+		finished = make(chan struct{})
+	)
+	clock := &fakeClock{now: timeMustParse(time.RFC3339, "2015-12-01T11:35:00Z")}
+	s := &Scaler{
+		name:     "test",
+		schedule: newSchedule(def, nil, nil, time.UTC),
+		resync:   10 * time.Minute,
+		clock:    clock,
+	}
+	s.set = func(s *Scaler, count int) {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(events) == len(expected) {
+			return
+		}
+		events = append(events, scaleEvent{clock.Now().UTC().Format("15:04:05"), count})
+		if len(events) == len(expected) {
+			close(finished)
+		}
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-finished
+	s.Stop()
+	lock.Lock()
+	defer lock.Unlock()
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v got %v", expected, events)
+	}
+}
+
+// stuckClock is a fakeClock whose waits never end.
+type stuckClock struct {
+	fakeClock
+}
+
+func (c *stuckClock) After(d time.Duration) <-chan time.Time {
+	return make(chan time.Time)
+}
+
+func TestSetCountStopped(t *testing.T) {
+	var (
+		lock sync.Mutex
+		puts int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		rc := fmt.Sprintf(testRC, puts, "", 3)
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v1/namespaces/ns/replicationcontrollers":
+			fmt.Fprintf(w, `{"kind": "ReplicationControllerList", "apiVersion": "v1", "items": [%s]}`, rc)
+		case r.Method == "PUT" && r.URL.Path == "/api/v1/namespaces/ns/replicationcontrollers/redis":
+			puts++
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, testConflict)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	var err error
+	client, err = kclient.New(&kclient.Config{Host: server.URL, Version: "v1", QPS: 1000, Burst: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { client = nil }()
+	defer func(f func(*api.Event) error) { createEvent = f }(createEvent)
+	createEvent = func(event *api.Event) error {
+		t.Errorf("unexpected event: %+v", event)
+		return nil
+	}
+	selector, err := labels.Parse("name=redis")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A stopped Scaler gives up instead of waiting to retry
+	s := &Scaler{name: "redis", namespace: "ns", selector: selector, workload: rcWorkload{}, clock: &stuckClock{}, done: make(chan struct{})}
+	close(s.done)
+	s.setCount(5)
+	if puts != 1 {
+		t.Errorf("expected 1 update got %d", puts)
+	}
+	if r := s.last; r == nil || r.Actual != 3 || r.Failures != 0 {
+		t.Errorf("unexpected result %+v", r)
+	}
+}
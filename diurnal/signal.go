@@ -0,0 +1,216 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/fields"
+)
+
+// The kinds of signal.
+const (
+	signalNone = "none"
+	// signalHTTP reads the number of replicas needed from a URL.
+	signalHTTP = "http"
+	// signalCPU computes the number of replicas needed to keep the CPU usage of the pods
+	// at a percentage of what they request.
+	signalCPU = "cpu"
+)
+
+// loadSignal observes the demand on a target as the number of replicas it needs. The
+// count diurnal sets stays within the floor and ceiling of the schedule.
+type loadSignal interface {
+	replicas(s *Scaler) (int, error)
+}
+
+// newSignal returns the signal of kind, or nil if kind is empty or none.
+func newSignal(kind, url string, cpuTarget int) (loadSignal, error) {
+	switch kind {
+	case "", signalNone:
+		return nil, nil
+	case signalHTTP:
+		if len(url) == 0 {
+			return nil, fmt.Errorf("an %s signal needs a URL", kind)
+		}
+		return &httpSignal{url: url}, nil
+	case signalCPU:
+		if cpuTarget <= 0 {
+			return nil, fmt.Errorf("a %s signal needs a positive target utilization", kind)
+		}
+		return &cpuSignal{target: cpuTarget}, nil
+	}
+	return nil, fmt.Errorf("unknown signal %q, must be one of %s, %s or %s", kind, signalNone, signalHTTP, signalCPU)
+}
+
+// httpClient is used by http signals.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// httpSignal reads a number from a URL, such as a metrics endpoint. Fractions are
+// rounded up.
+type httpSignal struct {
+	url string
+}
+
+func (h *httpSignal) replicas(*Scaler) (int, error) {
+	resp, err := httpClient.Get(h.url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s returned %s", h.url, resp.Status)
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(body)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s did not return a number: %v", h.url, err)
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("%s returned a negative number: %v", h.url, v)
+	}
+	return int(math.Ceil(v)), nil
+}
+
+// cpuSignal scales the running replicas by how far their CPU usage, as reported by
+// heapster, is from target percent of the CPU they request. The replicas are shared
+// evenly between the objects, since each of them is scaled to the number returned.
+type cpuSignal struct {
+	target int
+}
+
+// heapsterPath is where heapster is reached through the API server.
+var heapsterPath = []string{"proxy", "namespaces", "kube-system", "services", "heapster"}
+
+func (c *cpuSignal) replicas(s *Scaler) (int, error) {
+	objs, err := s.workload.list(s.namespace, s.selector)
+	if err != nil {
+		return 0, err
+	}
+	var requested, used int64
+	running, measured := 0, 0
+	for _, obj := range objs {
+		pods, err := client.Pods(s.namespace).List(obj.pods, fields.Everything())
+		if err != nil {
+			return 0, err
+		}
+		for _, pod := range pods.Items {
+			if pod.Status.Phase != api.PodRunning {
+				continue
+			}
+			running++
+			usage, err := podCPU(s.namespace, pod.Name)
+			if err == noSamplesError {
+				// Heapster has not seen a new pod yet, so leave it out of the utilization.
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			for _, container := range pod.Spec.Containers {
+				requested += container.Resources.Requests.Cpu().MilliValue()
+			}
+			used += usage
+			measured++
+		}
+	}
+	if running == 0 {
+		return 0, fmt.Errorf("no running pods to measure")
+	}
+	if measured == 0 {
+		return 0, fmt.Errorf("heapster has no CPU usage of the running pods")
+	}
+	if requested == 0 {
+		return 0, fmt.Errorf("the pods do not request CPU")
+	}
+	utilization := float64(used) * 100 / float64(requested)
+	total := math.Ceil(float64(running) * utilization / float64(c.target))
+	return int(math.Ceil(total / float64(len(objs)))), nil
+}
+
+// noSamplesError is returned by podCPU when heapster has no usage of the pod yet.
+var noSamplesError = errors.New("no CPU usage samples")
+
+// podCPU returns the latest CPU usage of a pod in millicores.
+func podCPU(ns, pod string) (int64, error) {
+	body, err := client.Get().Prefix(heapsterPath...).
+		Suffix(path.Join("api/v1/model/namespaces", ns, "pods", pod, "metrics/cpu-usage")).
+		Do().Raw()
+	if err != nil {
+		return 0, err
+	}
+	var result struct {
+		Metrics []struct {
+			Value int64 `json:"value"`
+		} `json:"metrics"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, err
+	}
+	if len(result.Metrics) == 0 {
+		return 0, noSamplesError
+	}
+	return result.Metrics[len(result.Metrics)-1].Value, nil
+}
+
+// splitBands splits counts into the floors and ceilings of its entries, which are a
+// count or a band such as 3-10. banded is true if any entry is a band.
+func splitBands(counts string) (floors, ceilings string, banded bool, err error) {
+	var fs, cs []string
+	for _, c := range strings.Split(counts, ",") {
+		floor, ceiling := c, c
+		if i := strings.Index(c, "-"); i > 0 {
+			floor, ceiling = c[:i], c[i+1:]
+			low, lerr := strconv.Atoi(floor)
+			high, herr := strconv.Atoi(ceiling)
+			if lerr == nil && herr == nil && low > high {
+				return "", "", false, fmt.Errorf("the floor of %s is above its ceiling", c)
+			}
+			banded = true
+		}
+		fs = append(fs, floor)
+		cs = append(cs, ceiling)
+	}
+	return strings.Join(fs, ","), strings.Join(cs, ","), banded, nil
+}
+
+// splitRule splits a rule as given to -rule into the rules of its floors and ceilings.
+func splitRule(s string) (floors, ceilings string, banded bool, err error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		// parseRule explains what is wrong
+		return s, s, false, nil
+	}
+	fc, cc, banded, err := splitBands(fields[2])
+	if err != nil {
+		return "", "", false, err
+	}
+	return strings.Join([]string{fields[0], fields[1], fc}, " "), strings.Join([]string{fields[0], fields[1], cc}, " "), banded, nil
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	kclient "k8s.io/kubernetes/pkg/client"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+func TestSplitBands(t *testing.T) {
+	cases := []struct {
+		counts   string
+		floors   string
+		ceilings string
+		banded   bool
+		err      bool
+	}{
+		{"3,5", "3,5", "3,5", false, false},
+		{"3-10,5", "3,5", "10,5", true, false},
+		{"3-10,5-5", "3,5", "10,5", true, false},
+		{"10-3", "", "", false, true},
+		// left to parseTimeCounts to reject
+		{"-1", "-1", "-1", false, false},
+	}
+	for i, test := range cases {
+		floors, ceilings, banded, err := splitBands(test.counts)
+		if test.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if floors != test.floors || ceilings != test.ceilings || banded != test.banded {
+			t.Errorf("case %d: expected %q, %q, %v got %q, %q, %v", i, test.floors, test.ceilings, test.banded, floors, ceilings, banded)
+		}
+	}
+
+	floors, ceilings, banded, err := splitRule("sat,sun 00:00Z,12:00Z 2-4,6")
+	if err != nil || floors != "sat,sun 00:00Z,12:00Z 2,6" || ceilings != "sat,sun 00:00Z,12:00Z 4,6" || !banded {
+		t.Errorf("unexpected split of a rule: %q, %q, %v, %v", floors, ceilings, banded, err)
+	}
+}
+
+func TestHTTPSignal(t *testing.T) {
+	cases := []struct {
+		status   int
+		body     string
+		expected int
+		err      bool
+	}{
+		{http.StatusOK, "7\n", 7, false},
+		{http.StatusOK, "6.2", 7, false},
+		{http.StatusOK, "-1", 0, true},
+		{http.StatusOK, "many", 0, true},
+		{http.StatusInternalServerError, "7", 0, true},
+	}
+	for i, test := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body)
+		}))
+		sig, err := newSignal(signalHTTP, server.URL, 0)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		n, err := sig.replicas(&Scaler{})
+		server.Close()
+		if test.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if n != test.expected {
+			t.Errorf("case %d: expected %d got %d", i, test.expected, n)
+		}
+	}
+}
+
+const testRCList = `{"kind": "ReplicationControllerList", "apiVersion": "v1", "items": [
+  {"metadata": {"name": "redis"}, "spec": {"replicas": 3, "selector": {"name": "redis"}}}
+]}`
+
+const testPodList = `{"kind": "PodList", "apiVersion": "v1", "items": [
+  {"metadata": {"name": "redis-1"}, "spec": {"containers": [{"name": "redis", "image": "redis", "resources": {"requests": {"cpu": "200m"}}}]}, "status": {"phase": "Running"}},
+  {"metadata": {"name": "redis-2"}, "spec": {"containers": [{"name": "redis", "image": "redis", "resources": {"requests": {"cpu": "200m"}}}]}, "status": {"phase": "Running"}},
+  {"metadata": {"name": "redis-3"}, "spec": {"containers": [{"name": "redis", "image": "redis", "resources": {"requests": {"cpu": "200m"}}}]}, "status": {"phase": "Pending"}}
+]}`
+
+func TestCPUSignal(t *testing.T) {
+	usage := map[string]string{
+		"redis-1": `{"metrics": [{"value": 100}, {"value": 300}]}`,
+		"redis-2": `{"metrics": [{"value": 180}]}`,
+	}
+	prefix := "/api/v1/proxy/namespaces/kube-system/services/heapster/api/v1/model/namespaces/ns/pods/"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/ns/replicationcontrollers":
+			fmt.Fprint(w, testRCList)
+		case r.URL.Path == "/api/v1/namespaces/ns/pods":
+			fmt.Fprint(w, testPodList)
+		case len(r.URL.Path) > len(prefix) && r.URL.Path[:len(prefix)] == prefix:
+			pod := r.URL.Path[len(prefix):]
+			pod = pod[:len(pod)-len("/metrics/cpu-usage")]
+			if u, ok := usage[pod]; ok {
+				fmt.Fprint(w, u)
+			} else {
+				fmt.Fprint(w, `{"metrics": []}`)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	var err error
+	client, err = kclient.New(&kclient.Config{Host: server.URL, Version: "v1", QPS: 1000, Burst: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { client = nil }()
+
+	selector, err := labels.Parse("name=redis")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := &Scaler{namespace: "ns", selector: selector, workload: rcWorkload{}}
+	cases := []struct {
+		target   int
+		expected int
+	}{
+		// 480m used of 400m requested is 120%
+		{80, 3},
+		{120, 2},
+		{200, 2},
+		{20, 12},
+	}
+	for i, test := range cases {
+		sig, err := newSignal(signalCPU, "", test.target)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		n, err := sig.replicas(s)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if n != test.expected {
+			t.Errorf("case %d: expected %d got %d", i, test.expected, n)
+		}
+	}
+
+	// redis-1 alone uses 300m of 200m, 150%, and the unmeasured redis-2 still counts.
+	delete(usage, "redis-2")
+	sig, _ := newSignal(signalCPU, "", 100)
+	if n, err := sig.replicas(s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if n != 3 {
+		t.Errorf("expected 3 got %d", n)
+	}
+
+	delete(usage, "redis-1")
+	if _, err := sig.replicas(s); err == nil {
+		t.Errorf("expected error when no pod has usage")
+	}
+}
+
+func TestCPUSignalSharesReplicas(t *testing.T) {
+	rcs := `{"kind": "ReplicationControllerList", "apiVersion": "v1", "items": [
+  {"metadata": {"name": "redis-a"}, "spec": {"replicas": 2, "selector": {"name": "redis", "track": "a"}}},
+  {"metadata": {"name": "redis-b"}, "spec": {"replicas": 2, "selector": {"name": "redis", "track": "b"}}}
+]}`
+	prefix := "/api/v1/proxy/namespaces/kube-system/services/heapster/api/v1/model/namespaces/ns/pods/"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/ns/replicationcontrollers":
+			fmt.Fprint(w, rcs)
+		case r.URL.Path == "/api/v1/namespaces/ns/pods":
+			// Both controllers see the two running pods of the fixture.
+			fmt.Fprint(w, testPodList)
+		case len(r.URL.Path) > len(prefix) && r.URL.Path[:len(prefix)] == prefix:
+			fmt.Fprint(w, `{"metrics": [{"value": 240}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	var err error
+	client, err = kclient.New(&kclient.Config{Host: server.URL, Version: "v1", QPS: 1000, Burst: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { client = nil }()
+
+	selector, err := labels.Parse("name=redis")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := &Scaler{namespace: "ns", selector: selector, workload: rcWorkload{}}
+	// 4 running pods at 120% of their request need 6 at 80%, or 3 for each controller.
+	sig, _ := newSignal(signalCPU, "", 80)
+	n, err := sig.replicas(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 got %d", n)
+	}
+}
+
+// fakeSignal returns values in turn, failing for negative ones.
+type fakeSignal struct {
+	lock   sync.Mutex
+	values []int
+}
+
+func (f *fakeSignal) replicas(*Scaler) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(f.values) == 0 {
+		return 0, errors.New("no more values")
+	}
+	v := f.values[0]
+	f.values = f.values[1:]
+	if v < 0 {
+		return 0, errors.New("failed")
+	}
+	return v, nil
+}
+
+func TestScalerBands(t *testing.T) {
+	floors, ceilings, _, err := splitBands("2-5,4-8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	floor, err := parseTimeCounts("00:00Z,12:00Z", floors)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ceiling, err := parseTimeCounts("00:00Z,12:00Z", ceilings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []scaleEvent{
+		{"05:00:00", 3},
+		{"06:00:00", 5},
+		{"08:00:00", 2},
+		{"12:00:00", 4},
+		{"13:00:00", 6},
+		// 14:00 fails and keeps 6
+		{"15:00:00", 8},
+	}
+
+	var (
+		lock     sync.Mutex
+		events   []scaleEvent
+		finished = make(chan struct{})
+	)
+	clock := &fakeClock{now: timeMustParse(time.RFC3339, "2015-12-01T05:00:00Z")}
+	s := &Scaler{
+		name:     "test",
+		schedule: newSchedule(floor, nil, nil, time.UTC),
+		ceiling:  newSchedule(ceiling, nil, nil, time.UTC),
+		signal:   &fakeSignal{values: []int{3, 9, 5, 1, 1, 1, 1, 1, 6, -1, 20}},
+		interval: time.Hour,
+		clock:    clock,
+	}
+	s.set = func(s *Scaler, count int) {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(events) == len(expected) {
+			return
+		}
+		events = append(events, scaleEvent{clock.Now().UTC().Format("15:04:05"), count})
+		if len(events) == len(expected) {
+			close(finished)
+		}
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-finished
+	s.Stop()
+	lock.Lock()
+	defer lock.Unlock()
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v got %v", expected, events)
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scheduledReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "diurnal_scheduled_replicas",
+		Help: "Number of replicas diurnal last scaled each target to.",
+	}, []string{"target"})
+	actualReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "diurnal_actual_replicas",
+		Help: "Number of replicas of the objects of each target after diurnal last scaled them.",
+	}, []string{"target"})
+	failedScales = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "diurnal_failed_scales_total",
+		Help: "Number of times listing or scaling the objects of each target failed.",
+	}, []string{"target"})
+)
+
+func init() {
+	prometheus.MustRegister(scheduledReplicas)
+	prometheus.MustRegister(actualReplicas)
+	prometheus.MustRegister(failedScales)
+}
+
+// scaleResult is the outcome of scaling the objects of a target.
+type scaleResult struct {
+	Time time.Time `json:"time"`
+	// Replicas is the count the objects were scaled to, and Actual the sum of the
+	// replicas they were left with.
+	Replicas int `json:"replicas"`
+	Actual   int `json:"actual"`
+	Objects  int `json:"objects"`
+	Failures int `json:"failures,omitempty"`
+	// Error is the last error, if any.
+	Error string `json:"error,omitempty"`
+}
+
+func (r *scaleResult) fail(err error) {
+	r.Failures++
+	r.Error = err.Error()
+}
+
+// recordResult keeps r as the result of the last scaling of s, for the status server.
+func (s *Scaler) recordResult(r *scaleResult) {
+	s.lock.Lock()
+	s.last = r
+	s.lock.Unlock()
+	scheduledReplicas.WithLabelValues(s.name).Set(float64(r.Replicas))
+	actualReplicas.WithLabelValues(s.name).Set(float64(r.Actual))
+	if r.Failures > 0 {
+		failedScales.WithLabelValues(s.name).Add(float64(r.Failures))
+	}
+}
+
+// forgetMetrics removes the metrics of target, once it is no longer scaled.
+func forgetMetrics(target string) {
+	scheduledReplicas.DeleteLabelValues(target)
+	actualReplicas.DeleteLabelValues(target)
+	failedScales.DeleteLabelValues(target)
+}
+
+// statusEntry is a count of a schedule, with the most replicas a signal may ask for
+// if the schedule has bands.
+type statusEntry struct {
+	Time     time.Time `json:"time"`
+	Replicas int       `json:"replicas"`
+	Max      int       `json:"max,omitempty"`
+}
+
+// targetStatus is the state of the Scaler of a target.
+type targetStatus struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Selector  string `json:"selector"`
+	// Rule is the rule in force today, and Schedule its counts.
+	Rule     string        `json:"rule"`
+	Schedule []statusEntry `json:"schedule"`
+	Current  int           `json:"current"`
+	// Next is the next change of the schedule.
+	Next statusEntry  `json:"next"`
+	Last *scaleResult `json:"lastScale,omitempty"`
+}
+
+// status returns the state of s.
+func (s *Scaler) status() targetStatus {
+	now := s.scheduleTime()
+	d := s.schedule.dateOf(now)
+	st := targetStatus{
+		Name:      s.name,
+		Namespace: s.namespace,
+		Selector:  s.selector.String(),
+		Rule:      s.schedule.ruleFor(d).text,
+	}
+	start, tc := s.schedule.day(d)
+	var ceilings []timeCount
+	if s.ceiling != nil {
+		_, ceilings = s.ceiling.day(d)
+	}
+	for i, c := range tc {
+		entry := statusEntry{Time: s.realTime(start.Add(c.time)), Replicas: c.count}
+		if i < len(ceilings) {
+			entry.Max = ceilings[i].count
+		}
+		st.Schedule = append(st.Schedule, entry)
+	}
+	next := s.nextChange(now)
+	st.Next = statusEntry{Time: s.realTime(next), Replicas: s.schedule.countAt(next)}
+	if s.ceiling != nil {
+		st.Next.Max = s.ceiling.countAt(next)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	st.Current = s.current
+	st.Last = s.last
+	return st
+}
+
+// realTime returns the time t on the schedule is reached, in the time zone of the
+// schedule.
+func (s *Scaler) realTime(t time.Time) time.Time {
+	return t.Add(s.shift).In(s.schedule.location)
+}
+
+// status returns the state of every running Scaler, sorted by target.
+func (c *controller) status() []targetStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	statuses := []targetStatus{}
+	for _, name := range sortedNames(c.scalers) {
+		statuses = append(statuses, c.scalers[name].status())
+	}
+	return statuses
+}
+
+// handler serves /healthz, /status and /metrics.
+func (c *controller) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.MarshalIndent(c.status(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+	mux.Handle("/metrics", prometheus.Handler())
+	return mux
+}
+
+// serve serves the handler of c on address.
+func (c *controller) serve(address string) {
+	glog.Fatal(http.ListenAndServe(address, c.handler()))
+}
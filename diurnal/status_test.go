@@ -0,0 +1,139 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+func TestScalerStatus(t *testing.T) {
+	floors, err := parseTimeCounts("06:00Z,22:00Z", "10,3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ceilings, err := parseTimeCounts("06:00Z,22:00Z", "30,3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	selector, err := labels.Parse("app=web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := timeMustParse(time.RFC3339, "2015-12-01T12:00:00Z")
+	last := &scaleResult{Time: now, Replicas: 12, Actual: 10, Objects: 1}
+	last.fail(errors.New("conflict"))
+	s := &Scaler{
+		name:      "web",
+		namespace: "ns",
+		selector:  selector,
+		schedule:  newSchedule(floors, nil, nil, time.UTC),
+		ceiling:   newSchedule(ceilings, nil, nil, time.UTC),
+		clock:     &fakeClock{now: now},
+		current:   12,
+		last:      last,
+	}
+	expected := targetStatus{
+		Name:      "web",
+		Namespace: "ns",
+		Selector:  "app=web",
+		Rule:      "default",
+		Schedule: []statusEntry{
+			{timeMustParse(time.RFC3339, "2015-12-01T06:00:00Z"), 10, 30},
+			{timeMustParse(time.RFC3339, "2015-12-01T22:00:00Z"), 3, 3},
+		},
+		Current: 12,
+		Next:    statusEntry{timeMustParse(time.RFC3339, "2015-12-01T22:00:00Z"), 3, 3},
+		Last:    last,
+	}
+	if st := s.status(); !reflect.DeepEqual(st, expected) {
+		t.Errorf("expected %+v got %+v", expected, st)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	def, err := parseTimeCounts("00:00Z", "2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := newController()
+	c.start = func(*Scaler) error { return nil }
+	c.stop = func(*Scaler) error { return nil }
+	for _, name := range []string{"web", "cache"} {
+		s := &Scaler{
+			name:     name,
+			selector: labels.Everything(),
+			schedule: newSchedule(def, nil, nil, time.UTC),
+			clock:    &fakeClock{now: timeMustParse(time.RFC3339, "2015-12-01T12:00:00Z")},
+		}
+		c.update([]*Scaler{s})
+		s.recordResult(&scaleResult{Replicas: 2, Actual: 1, Failures: 1})
+	}
+	server := httptest.NewServer(c.handler())
+	defer server.Close()
+
+	get := func(path string) string {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: unexpected status %d", path, resp.StatusCode)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return string(body)
+	}
+
+	if body := get("/healthz"); body != "ok" {
+		t.Errorf("unexpected /healthz %q", body)
+	}
+	var statuses []targetStatus
+	if err := json.Unmarshal([]byte(get("/status")), &statuses); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the first target was replaced by the second
+	if len(statuses) != 1 || statuses[0].Name != "cache" || statuses[0].Last == nil || statuses[0].Last.Failures != 1 {
+		t.Errorf("unexpected /status %+v", statuses)
+	}
+	metrics := get("/metrics")
+	for _, line := range []string{
+		`diurnal_scheduled_replicas{target="cache"} 2`,
+		`diurnal_actual_replicas{target="cache"} 1`,
+		`diurnal_failed_scales_total{target="cache"} 1`,
+	} {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("/metrics is missing %s", line)
+		}
+	}
+	if strings.Contains(metrics, `target="web"`) {
+		t.Errorf("/metrics has a target no longer scaled")
+	}
+	c.stopAll()
+}
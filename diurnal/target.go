@@ -0,0 +1,247 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+// object is one object diurnal scales, such as a replication controller.
+type object struct {
+	kind            string
+	namespace       string
+	name            string
+	uid             types.UID
+	resourceVersion string
+	annotations     map[string]string
+	replicas        int
+	// pods selects the pods of the object.
+	pods labels.Selector
+	// raw is the object as its workload read it, for setReplicas.
+	raw interface{}
+}
+
+// workload is a kind of object diurnal scales.
+type workload interface {
+	// list returns the objects in namespace matching selector.
+	list(namespace string, selector labels.Selector) ([]*object, error)
+	// get reads obj again.
+	get(obj *object) (*object, error)
+	// setReplicas scales obj to replicas. It fails with a conflict if obj was changed
+	// since it was read.
+	setReplicas(obj *object, replicas int) error
+}
+
+// newWorkload returns the workload of resource, the plural name of a kind such as
+// deployments, in apiVersion. Replication controllers are scaled by updating them,
+// anything else through its scale subresource.
+func newWorkload(resource, apiVersion string) (workload, error) {
+	if len(resource) == 0 || len(apiVersion) == 0 {
+		return nil, fmt.Errorf("a resource and an API version are needed, got %q and %q", resource, apiVersion)
+	}
+	if resource == "replicationcontrollers" && apiVersion == "v1" {
+		return rcWorkload{}, nil
+	}
+	return &scaleWorkload{resource: resource, apiVersion: apiVersion}, nil
+}
+
+// rcWorkload scales replication controllers.
+type rcWorkload struct{}
+
+func rcObject(rc *api.ReplicationController) *object {
+	return &object{
+		kind:            "ReplicationController",
+		namespace:       rc.Namespace,
+		name:            rc.Name,
+		uid:             rc.UID,
+		resourceVersion: rc.ResourceVersion,
+		annotations:     rc.Annotations,
+		replicas:        rc.Spec.Replicas,
+		pods:            labels.SelectorFromSet(rc.Spec.Selector),
+		raw:             rc,
+	}
+}
+
+func (rcWorkload) list(namespace string, selector labels.Selector) ([]*object, error) {
+	rcList, err := client.ReplicationControllers(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	var objs []*object
+	for i := range rcList.Items {
+		objs = append(objs, rcObject(&rcList.Items[i]))
+	}
+	return objs, nil
+}
+
+func (rcWorkload) get(obj *object) (*object, error) {
+	rc, err := client.ReplicationControllers(obj.namespace).Get(obj.name)
+	if err != nil {
+		return nil, err
+	}
+	return rcObject(rc), nil
+}
+
+func (rcWorkload) setReplicas(obj *object, replicas int) error {
+	rc := *obj.raw.(*api.ReplicationController)
+	rc.Spec.Replicas = replicas
+	_, err := client.ReplicationControllers(obj.namespace).Update(&rc)
+	return err
+}
+
+// scaleWorkload scales objects through their scale subresource, such as
+// deployments/scale in extensions/v1beta1.
+type scaleWorkload struct {
+	resource   string
+	apiVersion string
+}
+
+// genericObject is the part of any object diurnal reads.
+type genericObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		UID             types.UID         `json:"uid"`
+		ResourceVersion string            `json:"resourceVersion"`
+		Annotations     map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+// scale is the part of a scale subresource diurnal reads.
+type scale struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas int `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		// Selector is a map of labels, or a selector in later versions.
+		Selector interface{} `json:"selector"`
+	} `json:"status"`
+}
+
+// path returns the path of the objects in namespace, followed by elem.
+func (w *scaleWorkload) path(namespace string, elem ...string) string {
+	root := "/api"
+	if strings.Contains(w.apiVersion, "/") {
+		root = "/apis"
+	}
+	return strings.Join(append([]string{root, w.apiVersion, "namespaces", namespace, w.resource}, elem...), "/")
+}
+
+func (w *scaleWorkload) list(namespace string, selector labels.Selector) ([]*object, error) {
+	body, err := client.Get().AbsPath(w.path(namespace)).Param("labelSelector", selector.String()).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Kind  string          `json:"kind"`
+		Items []genericObject `json:"items"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	var objs []*object
+	for _, item := range list.Items {
+		// items of a list have no kind of their own
+		item.Kind = strings.TrimSuffix(list.Kind, "List")
+		obj, err := w.withScale(item)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+func (w *scaleWorkload) get(obj *object) (*object, error) {
+	body, err := client.Get().AbsPath(w.path(obj.namespace, obj.name)).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+	var item genericObject
+	if err := json.Unmarshal(body, &item); err != nil {
+		return nil, err
+	}
+	return w.withScale(item)
+}
+
+// withScale returns the object of item with the replicas of its scale subresource.
+func (w *scaleWorkload) withScale(item genericObject) (*object, error) {
+	body, err := client.Get().AbsPath(w.path(item.Metadata.Namespace, item.Metadata.Name, "scale")).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+	var s scale
+	if err := json.Unmarshal(body, &s); err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	obj := &object{
+		kind:            item.Kind,
+		namespace:       item.Metadata.Namespace,
+		name:            item.Metadata.Name,
+		uid:             item.Metadata.UID,
+		resourceVersion: s.Metadata.ResourceVersion,
+		annotations:     item.Metadata.Annotations,
+		replicas:        s.Spec.Replicas,
+		raw:             raw,
+	}
+	switch selector := s.Status.Selector.(type) {
+	case map[string]interface{}:
+		set := labels.Set{}
+		for k, v := range selector {
+			set[k] = fmt.Sprint(v)
+		}
+		obj.pods = labels.SelectorFromSet(set)
+	case string:
+		if obj.pods, err = labels.Parse(selector); err != nil {
+			return nil, err
+		}
+	default:
+		obj.pods = labels.Everything()
+	}
+	return obj, nil
+}
+
+func (w *scaleWorkload) setReplicas(obj *object, replicas int) error {
+	// the scale is written back as it was read, so its resourceVersion makes the
+	// update fail if the object changed since
+	raw := obj.raw.(map[string]interface{})
+	spec, _ := raw["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = map[string]interface{}{}
+		raw["spec"] = spec
+	}
+	spec["replicas"] = replicas
+	body, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return client.Put().AbsPath(w.path(obj.namespace, obj.name, "scale")).Body(body).Do().Error()
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	apierrors "k8s.io/kubernetes/pkg/api/errors"
+	kclient "k8s.io/kubernetes/pkg/client"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+func TestNewWorkload(t *testing.T) {
+	cases := []struct {
+		resource   string
+		apiVersion string
+		expected   workload
+		err        bool
+	}{
+		{"replicationcontrollers", "v1", rcWorkload{}, false},
+		{"deployments", "extensions/v1beta1", &scaleWorkload{"deployments", "extensions/v1beta1"}, false},
+		{"replicationcontrollers", "extensions/v1beta1", &scaleWorkload{"replicationcontrollers", "extensions/v1beta1"}, false},
+		{"", "v1", nil, true},
+		{"deployments", "", nil, true},
+	}
+	for i, test := range cases {
+		w, err := newWorkload(test.resource, test.apiVersion)
+		if test.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if !reflect.DeepEqual(w, test.expected) {
+			t.Errorf("case %d: expected %#v got %#v", i, test.expected, w)
+		}
+	}
+}
+
+func TestScaleWorkload(t *testing.T) {
+	const (
+		prefix     = "/apis/extensions/v1beta1/namespaces/ns/deployments"
+		deployment = `{"metadata": {"name": "%s", "namespace": "ns", "uid": "uid-%s", "annotations": {"a": "b"}}}`
+		scale      = `{"kind": "Scale", "apiVersion": "extensions/v1beta1", "metadata": {"name": "%s", "resourceVersion": "%d"},
+  "spec": {"replicas": %d}, "status": {"replicas": %d, "selector": %s}}`
+	)
+	var (
+		lock      sync.Mutex
+		versions  = map[string]int{"web": 1, "api": 1}
+		replicas  = map[string]int{"web": 3, "api": 4}
+		selectors = map[string]string{"web": `{"app": "web"}`, "api": `"app=api,tier in (backend)"`}
+	)
+	writeScale := func(w http.ResponseWriter, name string) {
+		fmt.Fprintf(w, scale, name, versions[name], replicas[name], replicas[name], selectors[name])
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch {
+		case r.Method == "GET" && r.URL.Path == prefix:
+			if r.URL.Query().Get("labelSelector") != "tier=backend" {
+				t.Errorf("unexpected selector %q", r.URL.Query().Get("labelSelector"))
+			}
+			fmt.Fprintf(w, `{"kind": "DeploymentList", "apiVersion": "extensions/v1beta1", "items": [`+deployment+`,`+deployment+`]}`,
+				"web", "web", "api", "api")
+		case r.Method == "GET" && r.URL.Path == prefix+"/web":
+			fmt.Fprintf(w, `{"kind": "Deployment", "metadata": {"name": "web", "namespace": "ns", "uid": "uid-web"}}`)
+		case r.Method == "GET" && (r.URL.Path == prefix+"/web/scale" || r.URL.Path == prefix+"/api/scale"):
+			writeScale(w, r.URL.Path[len(prefix)+1:len(r.URL.Path)-len("/scale")])
+		case r.Method == "PUT" && r.URL.Path == prefix+"/web/scale":
+			var body struct {
+				Kind     string `json:"kind"`
+				Metadata struct {
+					ResourceVersion string `json:"resourceVersion"`
+				} `json:"metadata"`
+				Spec struct {
+					Replicas int `json:"replicas"`
+				} `json:"spec"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Kind != "Scale" {
+				t.Errorf("unexpected body %+v: %v", body, err)
+			}
+			if body.Metadata.ResourceVersion != strconv.Itoa(versions["web"]) {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, testConflict)
+				return
+			}
+			versions["web"]++
+			replicas["web"] = body.Spec.Replicas
+			writeScale(w, "web")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	var err error
+	client, err = kclient.New(&kclient.Config{Host: server.URL, Version: "v1", QPS: 1000, Burst: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { client = nil }()
+
+	w, err := newWorkload("deployments", "extensions/v1beta1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	selector, err := labels.Parse("tier=backend")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	objs, err := w.list("ns", selector)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expected 2 objects got %d", len(objs))
+	}
+	expected := []struct {
+		name     string
+		replicas int
+		pods     string
+	}{
+		{"web", 3, "app=web"},
+		{"api", 4, "app=api,tier in (backend)"},
+	}
+	for i, e := range expected {
+		obj := objs[i]
+		if obj.kind != "Deployment" || obj.name != e.name || obj.namespace != "ns" || string(obj.uid) != "uid-"+e.name {
+			t.Errorf("object %d: unexpected %+v", i, obj)
+		}
+		if obj.replicas != e.replicas || obj.resourceVersion != "1" || obj.annotations["a"] != "b" {
+			t.Errorf("object %d: unexpected %+v", i, obj)
+		}
+		if obj.pods.String() != e.pods {
+			t.Errorf("object %d: expected pods %s got %s", i, e.pods, obj.pods)
+		}
+	}
+
+	web := objs[0]
+	if err := w.setReplicas(web, 6); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if replicas["web"] != 6 {
+		t.Errorf("expected 6 replicas got %d", replicas["web"])
+	}
+	// web was changed by setting it, so setting it again from the same read conflicts
+	if err := w.setReplicas(web, 8); !apierrors.IsConflict(err) {
+		t.Errorf("expected a conflict got %v", err)
+	}
+	web, err = w.get(web)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if web.replicas != 6 || web.resourceVersion != "2" {
+		t.Errorf("unexpected %+v", web)
+	}
+	if err := w.setReplicas(web, 8); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if replicas["web"] != 8 {
+		t.Errorf("expected 8 replicas got %d", replicas["web"])
+	}
+}
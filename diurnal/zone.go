@@ -0,0 +1,94 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeParser parses a time of day into the time since the start of the day.
+type timeParser func(string) (time.Duration, error)
+
+// zoneFor returns the location whose days a schedule in zone follows, and how the
+// times of the schedule are parsed. Without a zone, days begin at 0:00 UTC and times
+// may have an offset from UTC. In a zone, times are read off its wall clock and may
+// not have an offset, so they stay put when the clocks change.
+func zoneFor(zone string) (*time.Location, timeParser, error) {
+	if len(zone) == 0 {
+		return time.UTC, parseTimeRelative, nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown time zone %s: %v", zone, err)
+	}
+	return loc, parseWallClock, nil
+}
+
+// parseWallClock parses a time of day without an offset, such as 09:30.
+func parseWallClock(s string) (time.Duration, error) {
+	t, err := parseTimeISO8601(s)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s: %v", s, err)
+	}
+	// parseTimeISO8601 uses the Local location for times without an offset
+	if t.Location().String() != "Local" {
+		return 0, fmt.Errorf("%s has an offset, but times in a time zone follow its wall clock", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+}
+
+// wallTime returns the moment the wall clock of loc shows wall on day d. If the clocks
+// go back and show wall twice, that is the first time. If they go forward past wall,
+// it is the moment they do.
+func wallTime(d date, wall time.Duration, loc *time.Location) time.Time {
+	// naive is the moment UTC shows wall. Offsets are within -12h...+14h, so the
+	// offsets in effect at the ends of that range are the candidates.
+	naive := d.start().Add(wall)
+	before := offset(naive.Add(-14*time.Hour), loc)
+	after := offset(naive.Add(12*time.Hour), loc)
+
+	var found *time.Time
+	for _, off := range []time.Duration{before, after} {
+		t := naive.Add(-off)
+		if offset(t, loc) == off && (found == nil || t.Before(*found)) {
+			found = &t
+		}
+	}
+	if found != nil {
+		return *found
+	}
+
+	// wall was skipped: the clocks went forward from before to after somewhere in
+	// (lo, hi], so search for the moment they did to the second.
+	lo, hi := naive.Add(-after), naive.Add(-before)
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+		if offset(mid, loc) == after {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi
+}
+
+// offset returns the offset from UTC of loc at t.
+func offset(t time.Time, loc *time.Location) time.Duration {
+	_, off := t.In(loc).Zone()
+	return time.Duration(off) * time.Second
+}
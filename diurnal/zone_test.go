@@ -0,0 +1,225 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+func TestParseWallClock(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected time.Duration
+		err      bool
+	}{
+		{"09:30", 9*time.Hour + 30*time.Minute, false},
+		{"000001", time.Second, false},
+		{"23", 23 * time.Hour, false},
+		{"09:30Z", 0, true},
+		{"0930-0500", 0, true},
+		{"24:00", 0, true},
+	}
+	for i, test := range cases {
+		d, err := parseWallClock(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if d != test.expected {
+			t.Errorf("case %d: expected %v got %v", i, test.expected, d)
+		}
+	}
+}
+
+func TestWallTime(t *testing.T) {
+	cases := []struct {
+		zone     string
+		day      string
+		wall     time.Duration
+		expected string
+	}{
+		{"UTC", "2015-03-08", 2*time.Hour + 30*time.Minute, "2015-03-08T02:30:00Z"},
+		{"America/New_York", "2015-03-08", 0, "2015-03-08T05:00:00Z"},
+		{"America/New_York", "2015-03-08", 1*time.Hour + 30*time.Minute, "2015-03-08T06:30:00Z"},
+		// skipped, so when the clocks go forward
+		{"America/New_York", "2015-03-08", 2 * time.Hour, "2015-03-08T07:00:00Z"},
+		{"America/New_York", "2015-03-08", 2*time.Hour + 30*time.Minute, "2015-03-08T07:00:00Z"},
+		{"America/New_York", "2015-03-08", 3 * time.Hour, "2015-03-08T07:00:00Z"},
+		{"America/New_York", "2015-03-08", 3*time.Hour + 30*time.Minute, "2015-03-08T07:30:00Z"},
+		{"America/New_York", "2015-11-01", 0, "2015-11-01T04:00:00Z"},
+		// repeated, so the first time
+		{"America/New_York", "2015-11-01", 1*time.Hour + 30*time.Minute, "2015-11-01T05:30:00Z"},
+		{"America/New_York", "2015-11-01", 2*time.Hour + 30*time.Minute, "2015-11-01T07:30:00Z"},
+		// midnight is skipped
+		{"America/Sao_Paulo", "2015-10-18", 0, "2015-10-18T03:00:00Z"},
+		{"America/Sao_Paulo", "2015-10-18", 30 * time.Minute, "2015-10-18T03:00:00Z"},
+		{"America/Sao_Paulo", "2015-10-18", 1*time.Hour + 30*time.Minute, "2015-10-18T03:30:00Z"},
+		// the clocks move by half an hour
+		{"Australia/Lord_Howe", "2015-10-04", 2*time.Hour + 15*time.Minute, "2015-10-03T15:30:00Z"},
+		{"Australia/Lord_Howe", "2015-10-04", 2*time.Hour + 45*time.Minute, "2015-10-03T15:45:00Z"},
+	}
+	for i, test := range cases {
+		got := wallTime(mustParseDate(test.day), test.wall, mustLoadLocation(test.zone))
+		if expected := timeMustParse(time.RFC3339, test.expected); !got.Equal(expected) {
+			t.Errorf("case %d: expected %v got %v", i, expected, got.UTC())
+		}
+	}
+}
+
+func TestScheduleDST(t *testing.T) {
+	loc := mustLoadLocation("America/New_York")
+	def, err := parseTimeCountsWith("01:30,02:30,12:00", "1,2,3", parseWallClock)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r, err := parseRule("2016-03-13 02:15,02:45,12:00 4,5,6", parseWallClock)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := newSchedule(def, []rule{r}, nil, loc)
+	cases := []struct {
+		now       string
+		count     int
+		next      string
+		nextCount int
+	}{
+		{"2015-03-08T05:00:00Z", 3, "2015-03-08T06:30:00Z", 1},
+		{"2015-03-08T06:30:00Z", 1, "2015-03-08T07:00:00Z", 2},
+		{"2015-03-08T07:00:00Z", 2, "2015-03-08T16:00:00Z", 3},
+		{"2015-11-01T05:00:00Z", 3, "2015-11-01T05:30:00Z", 1},
+		// 1:30 is not repeated
+		{"2015-11-01T05:30:00Z", 1, "2015-11-01T07:30:00Z", 2},
+		{"2015-11-01T06:45:00Z", 1, "2015-11-01T07:30:00Z", 2},
+		{"2015-11-01T07:30:00Z", 2, "2015-11-01T17:00:00Z", 3},
+		// both skipped times fall on the moment the clocks go forward, and the later wins
+		{"2016-03-13T05:00:00Z", 3, "2016-03-13T07:00:00Z", 5},
+		{"2016-03-13T07:00:00Z", 5, "2016-03-13T16:00:00Z", 6},
+	}
+	for i, test := range cases {
+		now := timeMustParse(time.RFC3339, test.now)
+		if count := s.countAt(now); count != test.count {
+			t.Errorf("case %d: expected count %d got %d", i, test.count, count)
+		}
+		next, count := s.next(now)
+		if !next.Equal(timeMustParse(time.RFC3339, test.next)) || count != test.nextCount {
+			t.Errorf("case %d: expected next %s, %d got %v, %d", i, test.next, test.nextCount, next.UTC(), count)
+		}
+	}
+}
+
+// fakeClock passes the time waited for at once.
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+type scaleEvent struct {
+	time  string
+	count int
+}
+
+func TestScalerDST(t *testing.T) {
+	def, err := parseTimeCountsWith("01:30,02:30,12:00", "1,2,3", parseWallClock)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		start    string
+		expected []scaleEvent
+	}{
+		{"2015-03-07T12:00:00-05:00", []scaleEvent{
+			{"2015-03-07T17:00:00Z", 3},
+			{"2015-03-08T06:30:00Z", 1},
+			{"2015-03-08T07:00:00Z", 2},
+			{"2015-03-08T16:00:00Z", 3},
+			{"2015-03-09T05:30:00Z", 1},
+			{"2015-03-09T06:30:00Z", 2},
+		}},
+		{"2015-10-31T12:00:00-04:00", []scaleEvent{
+			{"2015-10-31T16:00:00Z", 3},
+			{"2015-11-01T05:30:00Z", 1},
+			{"2015-11-01T07:30:00Z", 2},
+			{"2015-11-01T17:00:00Z", 3},
+			{"2015-11-02T06:30:00Z", 1},
+			{"2015-11-02T07:30:00Z", 2},
+		}},
+	}
+	for i, test := range cases {
+		var (
+			lock     sync.Mutex
+			events   []scaleEvent
+			finished = make(chan struct{})
+		)
+		clock := &fakeClock{now: timeMustParse(time.RFC3339, test.start)}
+		s := &Scaler{
+			name:     "test",
+			schedule: newSchedule(def, nil, nil, mustLoadLocation("America/New_York")),
+			clock:    clock,
+		}
+		s.set = func(s *Scaler, count int) {
+			lock.Lock()
+			defer lock.Unlock()
+			if len(events) == len(test.expected) {
+				return
+			}
+			events = append(events, scaleEvent{clock.Now().UTC().Format(time.RFC3339), count})
+			if len(events) == len(test.expected) {
+				close(finished)
+			}
+		}
+		if err := s.Start(); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		<-finished
+		s.Stop()
+		lock.Lock()
+		if !reflect.DeepEqual(events, test.expected) {
+			t.Errorf("case %d: expected %v got %v", i, test.expected, events)
+		}
+		lock.Unlock()
+	}
+}
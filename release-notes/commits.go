@@ -0,0 +1,148 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// compareLimit is the most commits the compare API returns.
+const compareLimit = 250
+
+// githubCommitter is the committer email of the commits github makes when it squashes or
+// rebases a PR.
+const githubCommitter = "noreply@github.com"
+
+var (
+	// mergeRE matches the subject of a commit made by the merge button.
+	mergeRE = regexp.MustCompile(`^Merge pull request #(\d+) `)
+	// squashRE matches the subject of a squashed or rebased PR. Only commits made by
+	// githubCommitter are trusted, any other commit may end its subject this way.
+	squashRE = regexp.MustCompile(`\(#(\d+)\)$`)
+	// cherryPickRE matches the references to the original PR in a cherry-pick, in the
+	// branch name of an automated cherry-pick or the subject of a cherry-picked commit.
+	cherryPickRE = regexp.MustCompile(`(?i)cherry[- ]pick[- ]of[- ]#(\d+)`)
+)
+
+// commit is a commit in the release range.
+type commit struct {
+	SHA     string
+	Message string
+	// Committer is the email of the committer.
+	Committer string
+}
+
+// gitCommits lists the commits reachable from to but not from, oldest first, using the
+// git checkout in dir.
+func gitCommits(dir, from, to string) ([]commit, error) {
+	cmd := exec.Command("git", "log", "--reverse", "--format=%H%x00%ce%x00%B%x00", from+".."+to)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v: %s", err, stderr.String())
+	}
+	return parseGitLog(string(out)), nil
+}
+
+// parseGitLog parses the output of git log --format=%H%x00%ce%x00%B%x00.
+func parseGitLog(out string) []commit {
+	fields := strings.Split(out, "\x00")
+	commits := []commit{}
+	for i := 0; i+2 < len(fields); i += 3 {
+		commits = append(commits, commit{
+			SHA:       strings.TrimSpace(fields[i]),
+			Committer: strings.TrimSpace(fields[i+1]),
+			Message:   strings.TrimSpace(fields[i+2]),
+		})
+	}
+	return commits
+}
+
+// compareCommits lists the commits reachable from to but not from, oldest first, using
+// the github compare API. The API returns at most 250 commits, so larger ranges need a
+// local checkout.
+func compareCommits(client *github.Client, owner, repo, from, to string) ([]commit, error) {
+	comparison, _, err := client.Repositories.CompareCommits(owner, repo, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if comparison.TotalCommits != nil && *comparison.TotalCommits > len(comparison.Commits) {
+		return nil, fmt.Errorf("%s..%s has %d commits but github only compares %d, use --git-dir", from, to, *comparison.TotalCommits, compareLimit)
+	}
+	commits := []commit{}
+	for _, c := range comparison.Commits {
+		if c.SHA == nil || c.Commit == nil || c.Commit.Message == nil {
+			continue
+		}
+		entry := commit{SHA: *c.SHA, Message: *c.Commit.Message}
+		if c.Commit.Committer != nil && c.Commit.Committer.Email != nil {
+			entry.Committer = *c.Commit.Committer.Email
+		}
+		commits = append(commits, entry)
+	}
+	return commits, nil
+}
+
+// prNumbers returns the PRs which introduced commits, in the order they were merged. A
+// cherry-pick is attributed to the PR it was picked from, so the notes describe the
+// original change. Only the subject of a commit is read, and of a merge only its branch,
+// since a description may mention other PRs.
+func prNumbers(commits []commit) []int {
+	seen := map[int]bool{}
+	result := []int{}
+	add := func(s string) {
+		n, err := strconv.Atoi(s)
+		if err != nil || seen[n] {
+			return
+		}
+		seen[n] = true
+		result = append(result, n)
+	}
+	addPicks := func(s string) bool {
+		picks := cherryPickRE.FindAllStringSubmatch(s, -1)
+		for _, pick := range picks {
+			add(pick[1])
+		}
+		return len(picks) > 0
+	}
+	for _, c := range commits {
+		subject := strings.SplitN(c.Message, "\n", 2)[0]
+		if match := mergeRE.FindStringSubmatch(subject); match != nil {
+			// the rest of the subject is the branch
+			if !addPicks(strings.TrimPrefix(subject, match[0])) {
+				add(match[1])
+			}
+			continue
+		}
+		if addPicks(subject) {
+			continue
+		}
+		if match := squashRE.FindStringSubmatch(subject); match != nil && c.Committer == githubCommitter {
+			add(match[1])
+		}
+	}
+	return result
+}
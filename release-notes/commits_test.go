@@ -0,0 +1,54 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGitLog(t *testing.T) {
+	out := "abc\x00a@b.com\x00Merge pull request #1 from a/b\n\nTitle\n\x00\ndef\x00noreply@github.com\x00Fix it (#2)\n\x00\n"
+	expected := []commit{
+		{SHA: "abc", Committer: "a@b.com", Message: "Merge pull request #1 from a/b\n\nTitle"},
+		{SHA: "def", Committer: "noreply@github.com", Message: "Fix it (#2)"},
+	}
+	if commits := parseGitLog(out); !reflect.DeepEqual(commits, expected) {
+		t.Errorf("expected %+v, saw %+v", expected, commits)
+	}
+	if commits := parseGitLog(""); len(commits) != 0 {
+		t.Errorf("expected no commits, saw %+v", commits)
+	}
+}
+
+func TestPRNumbers(t *testing.T) {
+	commits := []commit{
+		{Message: "Add a thing"},
+		{Message: "Merge pull request #10 from alice/thing\n\nAdd a thing"},
+		{Message: "Fix the thing (#11)", Committer: githubCommitter},
+		{Message: "Mention (#12) in the middle of a subject", Committer: githubCommitter},
+		{Message: "Revert a change made in (#13)", Committer: "dev@example.com"},
+		{Message: "Merge pull request #20 from bob/automated-cherry-pick-of-#5-upstream-release-1.1\n\nAutomated cherry pick of #5"},
+		{Message: "Merge pull request #21 from carol/cherry\n\nFix the cherry-pick of #6 script"},
+		{Message: "Cherry pick of #6 and cherry-pick of #7 on release-1.1.\n\nAlso mentions #8"},
+		{Message: "Merge pull request #10 from alice/thing"},
+	}
+	expected := []int{10, 11, 5, 21, 6, 7}
+	if numbers := prNumbers(commits); !reflect.DeepEqual(numbers, expected) {
+		t.Errorf("expected %v, saw %v", expected, numbers)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// releaseNoteNone marks a PR which shouldn't be in the release notes.
+	releaseNoteNone = "release-note-none"
+	// otherSection holds PRs which have no label with the group prefix.
+	otherSection = "Other notable changes"
+	// actionRequiredSection holds breaking changes.
+	actionRequiredSection = "Action Required"
+)
+
+// releaseNoteRE matches a ```release-note block in the body of a PR.
+var releaseNoteRE = regexp.MustCompile("(?s)```release-note\\s*\\n(.*?)```")
+
+// note is a single entry in the release notes.
+type note struct {
+	Number int    `json:"number"`
+	Author string `json:"author"`
+	// Text is the release-note block of the PR, or its title.
+	Text string `json:"text"`
+	// Section is the heading the note is listed under.
+	Section string `json:"-"`
+}
+
+// releaseNote returns the contents of the ```release-note block in body, if any.
+func releaseNote(body string) string {
+	match := releaseNoteRE.FindStringSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimSpace(match[1])
+}
+
+// sectionTitle turns a label such as "kind/api-change" into "Api change".
+func sectionTitle(label, prefix string) string {
+	title := strings.Replace(strings.TrimPrefix(label, prefix), "-", " ", -1)
+	if len(title) == 0 {
+		return title
+	}
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+// newNote creates the note for a PR with labels. Its section is taken from the first
+// label, in sorted order, which starts with groupPrefix. It returns nil if the PR
+// shouldn't be in the release notes.
+func newNote(pr *github.PullRequest, labels []string, groupPrefix string, actionRequired []string) *note {
+	n := &note{Number: *pr.Number, Section: otherSection}
+	if pr.Title != nil {
+		n.Text = *pr.Title
+	}
+	if pr.User != nil && pr.User.Login != nil {
+		n.Author = *pr.User.Login
+	}
+	if pr.Body != nil {
+		if text := releaseNote(*pr.Body); len(text) > 0 {
+			n.Text = text
+		}
+	}
+	if strings.EqualFold(n.Text, "none") {
+		return nil
+	}
+	sorted := append([]string{}, labels...)
+	sort.Strings(sorted)
+	for _, label := range sorted {
+		if label == releaseNoteNone {
+			return nil
+		}
+	}
+	for _, label := range sorted {
+		if strings.HasPrefix(label, groupPrefix) {
+			n.Section = sectionTitle(label, groupPrefix)
+			break
+		}
+	}
+	for _, label := range sorted {
+		for _, action := range actionRequired {
+			if label == action {
+				n.Section = actionRequiredSection
+			}
+		}
+	}
+	return n
+}
+
+// sections groups notes by section, keeping the order of the notes within each. The
+// section names are returned with "Action Required" first, "Other notable changes"
+// last and the rest sorted.
+func sections(notes []*note) ([]string, map[string][]*note) {
+	bySection := map[string][]*note{}
+	names := []string{}
+	for _, n := range notes {
+		if _, found := bySection[n.Section]; !found && n.Section != actionRequiredSection && n.Section != otherSection {
+			names = append(names, n.Section)
+		}
+		bySection[n.Section] = append(bySection[n.Section], n)
+	}
+	sort.Strings(names)
+	if len(bySection[actionRequiredSection]) > 0 {
+		names = append([]string{actionRequiredSection}, names...)
+	}
+	if len(bySection[otherSection]) > 0 {
+		names = append(names, otherSection)
+	}
+	return names, bySection
+}
+
+// writeMarkdown writes notes to w as a Markdown section per group.
+func writeMarkdown(w io.Writer, notes []*note) error {
+	names, bySection := sections(notes)
+	for i, name := range names {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "### %s\n\n", name); err != nil {
+			return err
+		}
+		for _, n := range bySection[name] {
+			// Indent any further lines of a multi-line note under its bullet
+			text := strings.Replace(n.Text, "\n", "\n  ", -1)
+			if _, err := fmt.Fprintf(w, "* %s (#%d, @%s)\n", text, n.Number, n.Author); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
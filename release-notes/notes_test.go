@@ -0,0 +1,125 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func stringPtr(val string) *string { return &val }
+func intPtr(val int) *int          { return &val }
+
+func TestReleaseNote(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{body: "Fixes #1", expected: ""},
+		{body: "Fixes #1\n```release-note\nAdded a flag.\n```\n", expected: "Added a flag."},
+		{body: "```release-note\r\nNONE\r\n```", expected: "NONE"},
+	}
+	for _, test := range tests {
+		if note := releaseNote(test.body); note != test.expected {
+			t.Errorf("%q: expected %q, saw %q", test.body, test.expected, note)
+		}
+	}
+}
+
+func TestNewNote(t *testing.T) {
+	actionRequired := []string{"release-note-action-required"}
+	tests := []struct {
+		body     string
+		labels   []string
+		expected *note
+	}{
+		{
+			labels:   nil,
+			expected: &note{Number: 1, Author: "a", Text: "Title", Section: otherSection},
+		},
+		{
+			body:     "```release-note\nBetter text\n```",
+			labels:   []string{"kind/new-feature", "area/kubectl", "kind/bug"},
+			expected: &note{Number: 1, Author: "a", Text: "Better text", Section: "Bug"},
+		},
+		{
+			labels:   []string{"kind/api-change", "release-note-action-required"},
+			expected: &note{Number: 1, Author: "a", Text: "Title", Section: actionRequiredSection},
+		},
+		{
+			labels:   []string{"kind/bug", "release-note-none"},
+			expected: nil,
+		},
+		{
+			body:     "```release-note\nNONE\n```",
+			expected: nil,
+		},
+	}
+	for i, test := range tests {
+		pr := &github.PullRequest{
+			Number: intPtr(1),
+			Title:  stringPtr("Title"),
+			Body:   stringPtr(test.body),
+			User:   &github.User{Login: stringPtr("a")},
+		}
+		n := newNote(pr, test.labels, "kind/", actionRequired)
+		switch {
+		case n == nil && test.expected == nil:
+		case n == nil || test.expected == nil:
+			t.Errorf("case %d: expected %+v, saw %+v", i, test.expected, n)
+		case *n != *test.expected:
+			t.Errorf("case %d: expected %+v, saw %+v", i, *test.expected, *n)
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	notes := []*note{
+		{Number: 1, Author: "a", Text: "Fixed a crash", Section: "Bug"},
+		{Number: 2, Author: "b", Text: "Something else", Section: otherSection},
+		{Number: 3, Author: "c", Text: "Removed v1beta1\nMigrate first", Section: actionRequiredSection},
+		{Number: 4, Author: "d", Text: "Fixed a leak", Section: "Bug"},
+		{Number: 5, Author: "e", Text: "API change", Section: "Api change"},
+	}
+	expected := `### Action Required
+
+* Removed v1beta1
+  Migrate first (#3, @c)
+
+### Api change
+
+* API change (#5, @e)
+
+### Bug
+
+* Fixed a crash (#1, @a)
+* Fixed a leak (#4, @d)
+
+### Other notable changes
+
+* Something else (#2, @b)
+`
+	var buf bytes.Buffer
+	if err := writeMarkdown(&buf, notes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nsaw:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Values of --format.
+const (
+	formatMarkdown  = "markdown"
+	formatHTML      = "html"
+	formatJSON      = "json"
+	formatChangelog = "changelog"
+)
+
+// contributor is an author of PRs in the release.
+type contributor struct {
+	Login string `json:"login"`
+	PRs   int    `json:"prs"`
+	// FirstTime is set if the author had no PRs merged before this release.
+	FirstTime bool `json:"firstTime"`
+	// firstMerged is when the author's first PR in the release was merged.
+	firstMerged time.Time
+}
+
+// section is a heading of the release notes and the notes under it.
+type section struct {
+	Title string  `json:"title"`
+	Notes []*note `json:"notes"`
+}
+
+// releaseNotes is everything written out, in the JSON format.
+type releaseNotes struct {
+	Sections     []section      `json:"sections"`
+	Contributors []*contributor `json:"contributors,omitempty"`
+}
+
+func newReleaseNotes(notes []*note, contributors []*contributor) *releaseNotes {
+	names, bySection := sections(notes)
+	result := &releaseNotes{Sections: []section{}, Contributors: contributors}
+	for _, name := range names {
+		result.Sections = append(result.Sections, section{Title: name, Notes: bySection[name]})
+	}
+	return result
+}
+
+// countContributors counts the PRs of each author, most prolific first.
+func countContributors(prs []*github.PullRequest) []*contributor {
+	byLogin := map[string]*contributor{}
+	result := []*contributor{}
+	for _, pr := range prs {
+		if pr.User == nil || pr.User.Login == nil {
+			continue
+		}
+		c := byLogin[*pr.User.Login]
+		if c == nil {
+			c = &contributor{Login: *pr.User.Login}
+			byLogin[c.Login] = c
+			result = append(result, c)
+		}
+		c.PRs++
+		if pr.MergedAt != nil && (c.firstMerged.IsZero() || pr.MergedAt.Before(c.firstMerged)) {
+			c.firstMerged = *pr.MergedAt
+		}
+	}
+	sort.Sort(byPRs(result))
+	return result
+}
+
+// Count describes how many PRs the contributor made.
+func (c *contributor) Count() string {
+	if c.PRs == 1 {
+		return "1 PR"
+	}
+	return fmt.Sprintf("%d PRs", c.PRs)
+}
+
+type byPRs []*contributor
+
+func (c byPRs) Len() int      { return len(c) }
+func (c byPRs) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byPRs) Less(i, j int) bool {
+	if c[i].PRs != c[j].PRs {
+		return c[i].PRs > c[j].PRs
+	}
+	return c[i].Login < c[j].Login
+}
+
+// findFirstTimers sets FirstTime on each contributor who had no PR merged into
+// owner/repo before their first PR in the release.
+func findFirstTimers(client *github.Client, contributors []*contributor) error {
+	for _, c := range contributors {
+		if c.firstMerged.IsZero() {
+			continue
+		}
+		query := fmt.Sprintf("repo:%s/%s is:pr is:merged author:%s merged:<%s", owner, repo, c.Login, c.firstMerged.UTC().Format(time.RFC3339))
+		result, _, err := client.Search.Issues(query, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 1}})
+		if err != nil {
+			return err
+		}
+		c.FirstTime = result.Total != nil && *result.Total == 0
+	}
+	return nil
+}
+
+// writeContributors writes the contributor section in Markdown.
+func writeContributors(w io.Writer, contributors []*contributor) error {
+	firstTimers := []string{}
+	for _, c := range contributors {
+		if c.FirstTime {
+			firstTimers = append(firstTimers, "@"+c.Login)
+		}
+	}
+	sort.Strings(firstTimers)
+	if _, err := fmt.Fprintf(w, "### Contributors\n\n"); err != nil {
+		return err
+	}
+	if len(firstTimers) > 0 {
+		if _, err := fmt.Fprintf(w, "Welcome to our first-time contributors: %s\n\n", strings.Join(firstTimers, ", ")); err != nil {
+			return err
+		}
+	}
+	for _, c := range contributors {
+		if _, err := fmt.Fprintf(w, "* @%s: %s\n", c.Login, c.Count()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAllMarkdown writes the notes and, if there are any, the contributors.
+func writeAllMarkdown(w io.Writer, notes []*note, contributors []*contributor) error {
+	if err := writeMarkdown(w, notes); err != nil {
+		return err
+	}
+	if len(contributors) == 0 {
+		return nil
+	}
+	if len(notes) > 0 {
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return writeContributors(w, contributors)
+}
+
+var htmlTemplate = template.Must(template.New("release-notes").Parse(`{{range .Sections}}<h3>{{.Title}}</h3>
+<ul>
+{{range .Notes}}<li>{{.Text}} (<a href="https://github.com/{{$.Owner}}/{{$.Repo}}/pull/{{.Number}}">#{{.Number}}</a>, <a href="https://github.com/{{.Author}}">@{{.Author}}</a>)</li>
+{{end}}</ul>
+{{end}}{{if .Contributors}}<h3>Contributors</h3>
+<ul>
+{{range .Contributors}}<li><a href="https://github.com/{{.Login}}">@{{.Login}}</a>: {{.Count}}{{if .FirstTime}} (first contribution){{end}}</li>
+{{end}}</ul>
+{{end}}`))
+
+// writeHTML writes the notes and contributors as HTML lists.
+func writeHTML(w io.Writer, notes *releaseNotes) error {
+	return htmlTemplate.Execute(w, struct {
+		*releaseNotes
+		Owner string
+		Repo  string
+	}{notes, owner, repo})
+}
+
+// writeJSON writes the notes and contributors as JSON.
+func writeJSON(w io.Writer, notes *releaseNotes) error {
+	data, err := json.MarshalIndent(notes, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// prependChangelog adds the Markdown notes for a release called title to the top of
+// the changelog file, creating it if it doesn't exist.
+func prependChangelog(file, title string, notes []*note, contributors []*contributor) error {
+	old, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "## %s\n\n", title)
+	if err := writeAllMarkdown(&buf, notes, contributors); err != nil {
+		return err
+	}
+	if len(old) > 0 {
+		buf.WriteString("\n")
+		buf.Write(old)
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
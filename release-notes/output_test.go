@@ -0,0 +1,185 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func mergedPR(number int, login string, merged int64) *github.PullRequest {
+	mergedAt := time.Unix(merged, 0)
+	return &github.PullRequest{Number: &number, User: &github.User{Login: &login}, MergedAt: &mergedAt}
+}
+
+func TestCountContributors(t *testing.T) {
+	prs := []*github.PullRequest{
+		mergedPR(1, "bob", 30),
+		mergedPR(2, "alice", 20),
+		mergedPR(3, "bob", 10),
+		mergedPR(4, "carol", 40),
+	}
+	contributors := countContributors(prs)
+	logins := []string{}
+	for _, c := range contributors {
+		logins = append(logins, c.Login)
+	}
+	if strings.Join(logins, ",") != "bob,alice,carol" {
+		t.Errorf("unexpected order: %v", logins)
+	}
+	if contributors[0].PRs != 2 || !contributors[0].firstMerged.Equal(time.Unix(10, 0)) {
+		t.Errorf("unexpected contributor: %+v", contributors[0])
+	}
+}
+
+func TestFindFirstTimers(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		if !strings.Contains(q, "repo:o/r is:pr is:merged") || !strings.Contains(q, "merged:<1970-01-01T00:00:10Z") {
+			t.Errorf("unexpected query: %s", q)
+		}
+		total := 3
+		if strings.Contains(q, "author:alice ") {
+			total = 0
+		}
+		data, err := json.Marshal(github.IssuesSearchResult{Total: &total})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		w.Write(data)
+	})
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	owner, repo = "o", "r"
+	defer func() { owner, repo = "kubernetes", "kubernetes" }()
+
+	contributors := countContributors([]*github.PullRequest{mergedPR(1, "alice", 10), mergedPR(2, "bob", 10)})
+	if err := findFirstTimers(client, contributors); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range contributors {
+		if c.FirstTime != (c.Login == "alice") {
+			t.Errorf("unexpected contributor: %+v", c)
+		}
+	}
+}
+
+func TestWriteAllMarkdown(t *testing.T) {
+	notes := []*note{{Number: 1, Author: "a", Text: "Fixed a crash", Section: "Bug"}}
+	contributors := []*contributor{{Login: "a", PRs: 2, FirstTime: true}, {Login: "b", PRs: 1}}
+	expected := `### Bug
+
+* Fixed a crash (#1, @a)
+
+### Contributors
+
+Welcome to our first-time contributors: @a
+
+* @a: 2 PRs
+* @b: 1 PR
+`
+	var buf bytes.Buffer
+	if err := writeAllMarkdown(&buf, notes, contributors); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nsaw:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	notes := []*note{{Number: 1, Author: "a", Text: "Escape <b>", Section: "Bug"}}
+	var buf bytes.Buffer
+	if err := writeHTML(&buf, newReleaseNotes(notes, []*contributor{{Login: "a", PRs: 1, FirstTime: true}})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range []string{"<h3>Bug</h3>", "Escape &lt;b&gt;", `href="https://github.com/kubernetes/kubernetes/pull/1"`, "@a</a>: 1 PR (first contribution)"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %q in %s", s, buf.String())
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	notes := []*note{
+		{Number: 1, Author: "a", Text: "Fixed a crash", Section: "Bug"},
+		{Number: 2, Author: "b", Text: "Breaking", Section: actionRequiredSection},
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, newReleaseNotes(notes, []*contributor{{Login: "a", PRs: 1}})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result := releaseNotes{}
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Sections) != 2 || result.Sections[0].Title != actionRequiredSection || result.Sections[1].Notes[0].Number != 1 {
+		t.Errorf("unexpected sections: %+v", result.Sections)
+	}
+	if len(result.Contributors) != 1 || result.Contributors[0].Login != "a" {
+		t.Errorf("unexpected contributors: %+v", result.Contributors)
+	}
+}
+
+func TestPrependChangelog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "release-notes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "CHANGELOG.md")
+
+	if err := prependChangelog(file, "v1.0.0", []*note{{Number: 1, Author: "a", Text: "First", Section: otherSection}}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := prependChangelog(file, "v1.1.0", []*note{{Number: 2, Author: "b", Text: "Second", Section: otherSection}}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `## v1.1.0
+
+### Other notable changes
+
+* Second (#2, @b)
+
+## v1.0.0
+
+### Other notable changes
+
+* First (#1, @a)
+`
+	if string(data) != expected {
+		t.Errorf("expected:\n%s\nsaw:\n%s", expected, string(data))
+	}
+}
@@ -17,12 +17,11 @@ limitations under the License.
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
-	"time"
 
 	"github.com/google/go-github/github"
 	flag "github.com/spf13/pflag"
@@ -30,9 +29,21 @@ import (
 )
 
 var (
-	last    int
-	current int
-	token   string
+	last           int
+	current        int
+	from           string
+	to             string
+	gitDir         string
+	owner          string
+	repo           string
+	token          string
+	groupBy        string
+	actionRequired []string
+	format         string
+	changelogFile  string
+	releaseName    string
+	contributors   bool
+	cacheDir       string
 )
 
 type ByMerged []*github.PullRequest
@@ -44,18 +55,113 @@ func (a ByMerged) Less(i, j int) bool { return a[i].MergedAt.Before(*a[j].Merged
 func init() {
 	flag.IntVar(&last, "last-release-pr", 0, "The PR number of the last versioned release.")
 	flag.IntVar(&current, "current-release-pr", 0, "The PR number of the current versioned release.")
+	flag.StringVar(&from, "from", "", "The tag, branch or SHA of the last release. Replaces --last-release-pr.")
+	flag.StringVar(&to, "to", "", "The tag, branch or SHA of the current release. Replaces --current-release-pr.")
+	flag.StringVar(&gitDir, "git-dir", "", "A local checkout to list the commits between --from and --to with, instead of the github compare API, which stops at 250 commits.")
+	flag.StringVar(&owner, "owner", "kubernetes", "The github user or organization which owns the repository.")
+	flag.StringVar(&repo, "repo", "kubernetes", "The github repository.")
 	flag.StringVar(&token, "api-token", "", "Github api token for rate limiting. Background: https://developer.github.com/v3/#rate-limiting and create a token: https://github.com/settings/tokens")
+	flag.StringVar(&groupBy, "group-by", "kind/", "Label prefix, such as kind/ or area/, whose labels group PRs into sections.")
+	flag.StringSliceVar(&actionRequired, "action-required-labels", []string{"release-note-action-required", "kind/breaking-change"}, "Labels which mark a PR as a breaking change, listed under Action Required.")
+	flag.StringVar(&format, "format", formatMarkdown, "The output format: markdown, html, json, or changelog to prepend markdown to --changelog-file.")
+	flag.StringVar(&changelogFile, "changelog-file", "CHANGELOG.md", "The file --format=changelog prepends the release notes to.")
+	flag.StringVar(&releaseName, "release-name", "", "The heading of the release in --format=changelog. Defaults to --to.")
+	flag.StringVar(&cacheDir, "cache-dir", filepath.Join(os.TempDir(), "release-notes-cache"), "Directory to cache PR metadata and search progress in between runs, empty to disable.")
+	flag.BoolVar(&contributors, "contributors", false, "Add a section counting the PRs of each author and welcoming first-time contributors.")
+}
+
+// prsBetween returns the PRs merged after last and up to and including current, and
+// their labels, by searching for the PRs merged between them.
+func prsBetween(client *github.Client, c *cache) ([]*github.PullRequest, map[int][]string, error) {
+	lastPR, _, err := client.PullRequests.Get(owner, repo, last)
+	if err != nil {
+		return nil, nil, err
+	}
+	currentPR, _, err := client.PullRequests.Get(owner, repo, current)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lastPR.MergedAt == nil || currentPR.MergedAt == nil {
+		return nil, nil, fmt.Errorf("PRs %d and %d must both be merged", last, current)
+	}
+	lastVersionMerged, currentVersionMerged := lastPR.MergedAt, currentPR.MergedAt
+	if !lastVersionMerged.Before(*currentVersionMerged) {
+		return nil, nil, fmt.Errorf("PR %d was not merged after PR %d", current, last)
+	}
+	issues, err := searchMerged(client, c, *lastVersionMerged, *currentVersionMerged)
+	if err != nil {
+		return nil, nil, err
+	}
+	prs, labels, err := mergedPRs(client, c, issues)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Sort(ByMerged(prs))
+	result := []*github.PullRequest{}
+	for _, pr := range prs {
+		if pr.MergedAt == nil {
+			continue
+		}
+		if lastVersionMerged.Before(*pr.MergedAt) && (pr.MergedAt.Before(*currentVersionMerged) || (*pr.Number == current)) {
+			result = append(result, pr)
+		}
+	}
+	return result, labels, nil
+}
+
+// prsInRange returns the PRs which introduced the commits between from and to, and
+// their labels.
+func prsInRange(client *github.Client, c *cache) ([]*github.PullRequest, map[int][]string, error) {
+	var commits []commit
+	var err error
+	if len(gitDir) > 0 {
+		fmt.Fprintf(os.Stderr, "Listing commits %s..%s in %s\n", from, to, gitDir)
+		commits, err = gitCommits(gitDir, from, to)
+	} else {
+		fmt.Fprintf(os.Stderr, "Comparing %s..%s\n", from, to)
+		commits, err = compareCommits(client, owner, repo, from, to)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	numbers := prNumbers(commits)
+	fmt.Fprintf(os.Stderr, " ... %d commits from %d PRs.\n", len(commits), len(numbers))
+	return fetchPRs(client, c, numbers)
+}
+
+// fetchPRs returns the numbered PRs and their labels. The issue of each PR is fetched
+// to see whether the cached PR is still current.
+func fetchPRs(client *github.Client, c *cache, numbers []int) ([]*github.PullRequest, map[int][]string, error) {
+	issues := []github.Issue{}
+	for _, number := range numbers {
+		issue, _, err := client.Issues.Get(owner, repo, number)
+		if err != nil {
+			return nil, nil, err
+		}
+		issues = append(issues, *issue)
+	}
+	return mergedPRs(client, c, issues)
 }
 
 func main() {
 	flag.Parse()
-	// Automatically determine this from github.
-	if last == 0 {
-		fmt.Printf("--last-release-pr is required.\n")
+	rangeMode := len(from) > 0 || len(to) > 0
+	if rangeMode && (len(from) == 0 || len(to) == 0) {
+		fmt.Fprintf(os.Stderr, "--from and --to are required together.\n")
+		os.Exit(1)
+	}
+	if !rangeMode && last == 0 {
+		fmt.Fprintf(os.Stderr, "--from and --to, or --last-release-pr, are required.\n")
 		os.Exit(1)
 	}
-	if current == 0 {
-		fmt.Printf("--current-release-pr is required.\n")
+	if !rangeMode && current == 0 {
+		fmt.Fprintf(os.Stderr, "--current-release-pr is required.\n")
+		os.Exit(1)
+	}
+	switch format {
+	case formatMarkdown, formatHTML, formatJSON, formatChangelog:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown --format %q.\n", format)
 		os.Exit(1)
 	}
 	var tc *http.Client
@@ -70,60 +176,56 @@ func main() {
 
 	client := github.NewClient(tc)
 
-	done := false
-
-	opts := github.PullRequestListOptions{
-		State:     "closed",
-		Sort:      "updated",
-		Direction: "desc",
-		ListOptions: github.ListOptions{
-			Page:    0,
-			PerPage: 100,
-		},
-	}
-
-	buffer := &bytes.Buffer{}
-	prs := []*github.PullRequest{}
-	var lastVersionMerged *time.Time
-	var currentVersionMerged *time.Time
-	for !done {
-		opts.Page++
-		fmt.Printf("Fetching PR list page %2d\n", opts.Page)
-		results, _, err := client.PullRequests.List("GoogleCloudPlatform", "kubernetes", &opts)
-		if err != nil {
-			fmt.Printf("Error contacting github: %v", err)
-			os.Exit(1)
+	var prs []*github.PullRequest
+	var labels map[int][]string
+	var err error
+	c := &cache{dir: cacheDir}
+	if rangeMode {
+		prs, labels, err = prsInRange(client, c)
+	} else {
+		prs, labels, err = prsBetween(client, c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error contacting github: %v", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Compiling pretty-printed list of PRs...\n")
+	notes := []*note{}
+	for _, pr := range prs {
+		if n := newNote(pr, labels[*pr.Number], groupBy, actionRequired); n != nil {
+			notes = append(notes, n)
 		}
-		unmerged := 0
-		merged := 0
-		for ix := range results {
-			result := &results[ix]
-			// Skip Closed but not Merged PRs
-			if result.MergedAt == nil {
-				unmerged++
-				continue
-			}
-			if *result.Number == last {
-				done = true
-				lastVersionMerged = result.MergedAt
-				fmt.Printf(" ... found last PR %d.\n", last)
-				break
-			}
-			if *result.Number == current {
-				currentVersionMerged = result.MergedAt
-				fmt.Printf(" ... found current PR %d.\n", current)
-			}
-			prs = append(prs, result)
-			merged++
+	}
+	var authors []*contributor
+	if contributors {
+		fmt.Fprintf(os.Stderr, "Looking for first-time contributors...\n")
+		authors = countContributors(prs)
+		if err := findFirstTimers(client, authors); err != nil {
+			fmt.Fprintf(os.Stderr, "Error contacting github: %v", err)
+			os.Exit(1)
 		}
-		fmt.Printf(" ... %d merged PRs, %d unmerged PRs.\n", merged, unmerged)
 	}
-	fmt.Printf("Compiling pretty-printed list of PRs...\n")
-	sort.Sort(ByMerged(prs))
-	for _, pr := range prs {
-		if lastVersionMerged.Before(*pr.MergedAt) && (pr.MergedAt.Before(*currentVersionMerged) || (*pr.Number == current)) {
-			fmt.Fprintf(buffer, "   * %s #%d (%s)\n", *pr.Title, *pr.Number, *pr.User.Login)
+
+	switch format {
+	case formatMarkdown:
+		err = writeAllMarkdown(os.Stdout, notes, authors)
+	case formatHTML:
+		err = writeHTML(os.Stdout, newReleaseNotes(notes, authors))
+	case formatJSON:
+		err = writeJSON(os.Stdout, newReleaseNotes(notes, authors))
+	case formatChangelog:
+		title := releaseName
+		if len(title) == 0 {
+			title = to
+		}
+		if len(title) == 0 {
+			title = fmt.Sprintf("PR #%d", current)
 		}
+		err = prependChangelog(changelogFile, title, notes, authors)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing release notes: %v", err)
+		os.Exit(1)
 	}
-	fmt.Printf("%s", buffer.Bytes())
 }
@@ -0,0 +1,199 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// searchLimit is the most results github returns for one search query.
+var searchLimit = 1000
+
+// cachedPR is the metadata of a PR as of its last update.
+type cachedPR struct {
+	UpdatedAt time.Time           `json:"updatedAt"`
+	PR        *github.PullRequest `json:"pr"`
+	Labels    []string            `json:"labels"`
+}
+
+// searchProgress is how far a search query has been paged, so an interrupted run can
+// continue where it stopped.
+type searchProgress struct {
+	Query  string         `json:"query"`
+	Page   int            `json:"page"`
+	Issues []github.Issue `json:"issues"`
+}
+
+// cache keeps PR metadata and search progress in a directory. The zero value, with no
+// directory, caches nothing.
+type cache struct {
+	dir string
+}
+
+func (c *cache) path(parts ...string) string {
+	return filepath.Join(append([]string{c.dir, owner, repo}, parts...)...)
+}
+
+func (c *cache) read(file string, v interface{}) bool {
+	if len(c.dir) == 0 {
+		return false
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+func (c *cache) write(file string, v interface{}) error {
+	if len(c.dir) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// getPR returns the cached PR, or nil if it isn't cached or was updated since.
+func (c *cache) getPR(number int, updatedAt time.Time) *cachedPR {
+	entry := &cachedPR{}
+	if !c.read(c.path("pr", strconv.Itoa(number)+".json"), entry) || !entry.UpdatedAt.Equal(updatedAt) || entry.PR == nil {
+		return nil
+	}
+	return entry
+}
+
+func (c *cache) putPR(number int, entry *cachedPR) error {
+	return c.write(c.path("pr", strconv.Itoa(number)+".json"), entry)
+}
+
+func (c *cache) progressFile(query string) string {
+	return c.path("search", fmt.Sprintf("%x.json", sha1.Sum([]byte(query))))
+}
+
+// getProgress returns how far query has been paged, or a fresh start.
+func (c *cache) getProgress(query string) *searchProgress {
+	progress := &searchProgress{}
+	if !c.read(c.progressFile(query), progress) || progress.Query != query {
+		return &searchProgress{Query: query}
+	}
+	return progress
+}
+
+func (c *cache) putProgress(progress *searchProgress) error {
+	return c.write(c.progressFile(progress.Query), progress)
+}
+
+// clearProgress forgets a finished query, so the next run sees any updates.
+func (c *cache) clearProgress(query string) {
+	if len(c.dir) > 0 {
+		os.Remove(c.progressFile(query))
+	}
+}
+
+// searchMerged returns the PRs merged between start and end, inclusive, as issues. A
+// window with more PRs than github returns for one query is split in two.
+func searchMerged(client *github.Client, c *cache, start, end time.Time) ([]github.Issue, error) {
+	query := fmt.Sprintf("repo:%s/%s is:pr is:merged merged:%s..%s", owner, repo, start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	progress := c.getProgress(query)
+	if progress.Page > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming search %q at page %d\n", query, progress.Page+1)
+	}
+	for {
+		page := progress.Page + 1
+		fmt.Fprintf(os.Stderr, "Fetching search page %2d for %s..%s\n", page, start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+		result, resp, err := client.Search.Issues(query, &github.SearchOptions{
+			Sort:        "created",
+			Order:       "asc",
+			ListOptions: github.ListOptions{Page: page, PerPage: 100},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if page == 1 && result.Total != nil && *result.Total > searchLimit && end.Sub(start) > time.Second {
+			middle := start.Add(end.Sub(start) / 2)
+			first, err := searchMerged(client, c, start, middle)
+			if err != nil {
+				return nil, err
+			}
+			second, err := searchMerged(client, c, middle.Add(time.Second), end)
+			if err != nil {
+				return nil, err
+			}
+			return append(first, second...), nil
+		}
+		progress.Page = page
+		progress.Issues = append(progress.Issues, result.Issues...)
+		if resp.NextPage == 0 {
+			break
+		}
+		if err := c.putProgress(progress); err != nil {
+			return nil, err
+		}
+	}
+	c.clearProgress(query)
+	return progress.Issues, nil
+}
+
+// mergedPRs returns the PRs among issues, from the cache when they haven't been updated
+// since they were cached, and their labels.
+func mergedPRs(client *github.Client, c *cache, issues []github.Issue) ([]*github.PullRequest, map[int][]string, error) {
+	prs := []*github.PullRequest{}
+	labels := map[int][]string{}
+	fetched := 0
+	for _, issue := range issues {
+		if issue.Number == nil || issue.UpdatedAt == nil {
+			continue
+		}
+		names := []string{}
+		for _, label := range issue.Labels {
+			if label.Name != nil {
+				names = append(names, *label.Name)
+			}
+		}
+		entry := c.getPR(*issue.Number, *issue.UpdatedAt)
+		if entry == nil {
+			pr, _, err := client.PullRequests.Get(owner, repo, *issue.Number)
+			if err != nil {
+				return nil, nil, err
+			}
+			fetched++
+			entry = &cachedPR{UpdatedAt: *issue.UpdatedAt, PR: pr, Labels: names}
+			if err := c.putPR(*issue.Number, entry); err != nil {
+				return nil, nil, err
+			}
+		}
+		prs = append(prs, entry.PR)
+		labels[*issue.Number] = names
+	}
+	fmt.Fprintf(os.Stderr, " ... %d merged PRs, %d fetched from github.\n", len(prs), fetched)
+	return prs, labels, nil
+}
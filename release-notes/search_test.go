@@ -0,0 +1,215 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// searchServer fakes the search, issue and pull request APIs of o/r for issues 1 to
+// total, all merged between 1970-01-01T00:00:00Z and 1970-01-01T01:00:00Z, two per page.
+type searchServer struct {
+	t      *testing.T
+	total  int
+	limit  int
+	failAt int
+	// searches, issueGets and gets count the requests made
+	searches  int
+	issueGets int
+	gets      int
+}
+
+// issue returns issue n, updated when it was merged.
+func (s *searchServer) issue(n int) github.Issue {
+	updated := time.Unix(int64(n), 0)
+	return github.Issue{Number: &n, UpdatedAt: &updated, Labels: []github.Label{{Name: stringPtr("kind/bug")}}}
+}
+
+func (s *searchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/repos/o/r/pulls/") {
+		s.gets++
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/repos/o/r/pulls/"))
+		merged := time.Unix(int64(n), 0)
+		s.write(w, github.PullRequest{Number: &n, MergedAt: &merged})
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/repos/o/r/issues/") {
+		s.issueGets++
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/repos/o/r/issues/"))
+		s.write(w, s.issue(n))
+		return
+	}
+	s.searches++
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page == s.failAt {
+		s.failAt = 0
+		http.Error(w, `{"message": "rate limited"}`, http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query().Get("q")
+	if !strings.HasPrefix(q, "repo:o/r is:pr is:merged merged:") {
+		s.t.Errorf("unexpected query: %s", q)
+	}
+	window := strings.Split(strings.TrimPrefix(q, "repo:o/r is:pr is:merged merged:"), "..")
+	start, _ := time.Parse(time.RFC3339, window[0])
+	end, _ := time.Parse(time.RFC3339, window[1])
+	matches := []github.Issue{}
+	for i := 1; i <= s.total; i++ {
+		if t := time.Unix(int64(i), 0); !t.Before(start) && !t.After(end) {
+			matches = append(matches, s.issue(i))
+		}
+	}
+	total := len(matches)
+	if total > s.limit {
+		matches = matches[:s.limit]
+	}
+	from := (page - 1) * 2
+	to := from + 2
+	if to < len(matches) {
+		w.Header().Set("Link", fmt.Sprintf(`<https://api.github.com/search/issues?page=%d>; rel="next"`, page+1))
+	} else {
+		to = len(matches)
+	}
+	s.write(w, github.IssuesSearchResult{Total: &total, Issues: matches[from:to]})
+}
+
+func (s *searchServer) write(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.t.Errorf("unexpected error: %v", err)
+	}
+	w.Write(data)
+}
+
+func numbers(issues []github.Issue) []int {
+	result := []int{}
+	for _, issue := range issues {
+		result = append(result, *issue.Number)
+	}
+	return result
+}
+
+func TestSearchMerged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "release-notes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	owner, repo = "o", "r"
+	defer func() { owner, repo = "kubernetes", "kubernetes" }()
+
+	fake := &searchServer{t: t, total: 5, limit: 1000, failAt: 2}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	c := &cache{dir: dir}
+	start, end := time.Unix(0, 0), time.Unix(3600, 0)
+
+	// The first attempt fails on page 2, the second resumes there
+	if _, err := searchMerged(client, c, start, end); err == nil {
+		t.Fatalf("expected error")
+	}
+	fake.searches = 0
+	issues, err := searchMerged(client, c, start, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(numbers(issues)) != "[1 2 3 4 5]" || fake.searches != 2 {
+		t.Errorf("unexpected issues %v after %d searches", numbers(issues), fake.searches)
+	}
+
+	// Only PRs which aren't cached are fetched
+	prs, labels, err := mergedPRs(client, c, issues[:2])
+	if err != nil || len(prs) != 2 || fake.gets != 2 {
+		t.Errorf("unexpected result %v, %v after %d gets", prs, err, fake.gets)
+	}
+	prs, labels, err = mergedPRs(client, c, issues)
+	if err != nil || len(prs) != 5 || fake.gets != 5 {
+		t.Errorf("unexpected result %v, %v after %d gets", prs, err, fake.gets)
+	}
+	if *prs[4].Number != 5 || len(labels[5]) != 1 || labels[5][0] != "kind/bug" {
+		t.Errorf("unexpected PR %v with labels %v", *prs[4].Number, labels[5])
+	}
+	updated := time.Unix(100, 0)
+	issues[0].UpdatedAt = &updated
+	if _, _, err = mergedPRs(client, c, issues); err != nil || fake.gets != 6 {
+		t.Errorf("expected an updated PR to be fetched again, %v after %d gets", err, fake.gets)
+	}
+}
+
+func TestSearchMergedSplits(t *testing.T) {
+	owner, repo = "o", "r"
+	defer func() { owner, repo = "kubernetes", "kubernetes" }()
+
+	searchLimit = 3
+	defer func() { searchLimit = 1000 }()
+	fake := &searchServer{t: t, total: 7, limit: 3}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	issues, err := searchMerged(client, &cache{}, time.Unix(1, 0), time.Unix(7, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(numbers(issues)) != "[1 2 3 4 5 6 7]" {
+		t.Errorf("unexpected issues %v", numbers(issues))
+	}
+}
+
+func TestFetchPRs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "release-notes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	owner, repo = "o", "r"
+	defer func() { owner, repo = "kubernetes", "kubernetes" }()
+
+	fake := &searchServer{t: t, total: 5, limit: 1000}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	c := &cache{dir: dir}
+
+	prs, labels, err := fetchPRs(client, c, []int{3, 1})
+	if err != nil || len(prs) != 2 || *prs[0].Number != 3 || fake.gets != 2 {
+		t.Errorf("unexpected result %v, %v after %d gets", prs, err, fake.gets)
+	}
+	if len(labels[1]) != 1 || labels[1][0] != "kind/bug" {
+		t.Errorf("unexpected labels %v", labels[1])
+	}
+	// A second run only checks the issues of cached PRs
+	if prs, _, err = fetchPRs(client, c, []int{3, 1}); err != nil || len(prs) != 2 || fake.gets != 2 || fake.issueGets != 4 {
+		t.Errorf("unexpected result %v, %v after %d gets and %d issue gets", prs, err, fake.gets, fake.issueGets)
+	}
+}
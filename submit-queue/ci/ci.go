@@ -0,0 +1,173 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ci abstracts the continuous integration systems the submit queue
+// consults before merging a PR.
+package ci
+
+import (
+	"fmt"
+	"time"
+
+	sqgithub "k8s.io/contrib/submit-queue/github"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+const (
+	// JenkinsType selects a Provider which checks the last completed build of a set of Jenkins jobs.
+	JenkinsType = "jenkins"
+	// GithubStatusType selects a Provider which checks github status contexts on a branch.
+	GithubStatusType = "github-status"
+	// HTTPJSONType selects a Provider which reads JSON results files, for example from GCS.
+	HTTPJSONType = "http-json"
+
+	defaultRetestComment = "@k8s-bot test this [testing build queue, sorry for the noise]"
+)
+
+// Provider is a continuous integration system which gates merges.
+type Provider interface {
+	// IsStable returns true if the CI system considers the tree healthy enough to merge into.
+	IsStable() (bool, error)
+	// Retest asks the CI system to test the PR again.
+	Retest(client *github.Client, user, project string, pr *github.PullRequest) error
+	// WaitForResult blocks until the CI system has a result for the PR, and returns true if it passed.
+	// If ctx is done first, ctx.Err() is returned.
+	WaitForResult(ctx context.Context, client *github.Client, user, project string, pr *github.PullRequest) (bool, error)
+}
+
+// Config describes which Provider to use for a repository and how to configure it.
+type Config struct {
+	// Type is one of JenkinsType, GithubStatusType or HTTPJSONType.
+	Type string `json:"type"`
+	// RetestComment is the comment which asks the PR builder to test a PR again.
+	RetestComment string `json:"retestComment,omitempty"`
+
+	// JenkinsHost is the URL of the Jenkins server (jenkins).
+	JenkinsHost string `json:"jenkinsHost,omitempty"`
+	// JenkinsUser and JenkinsToken authenticate with Jenkins (jenkins). The token is
+	// set from the command line rather than the config file.
+	JenkinsUser  string `json:"jenkinsUser,omitempty"`
+	JenkinsToken string `json:"-"`
+	// Jobs are the Jenkins jobs (jenkins) or results names (http-json) which must be passing.
+	Jobs []string `json:"jobs,omitempty"`
+	// StableBuilds is how many recent builds of each job are considered (jenkins). If it
+	// is 0 or 1, only the last completed build counts.
+	StableBuilds int `json:"stableBuilds,omitempty"`
+	// FlakinessThreshold is the fraction of the last StableBuilds builds which may fail
+	// with the job still considered stable (jenkins).
+	FlakinessThreshold float64 `json:"flakinessThreshold,omitempty"`
+	// RetestJob, if set, is a parameterized job which Retest starts with PULL_NUMBER,
+	// PULL_SHA and PULL_BASE_REF instead of commenting on the PR (jenkins).
+	RetestJob string `json:"retestJob,omitempty"`
+	// ReportFailures posts a summary of the failed tests of any failed Jenkins build
+	// back to the PR (jenkins).
+	ReportFailures bool `json:"reportFailures,omitempty"`
+
+	// Owner and Repo identify the repository whose branch is checked (github-status).
+	// They default to the repository being merged into.
+	Owner string `json:"owner,omitempty"`
+	Repo  string `json:"repo,omitempty"`
+	// Branch is the branch whose head must be passing (github-status).
+	Branch string `json:"branch,omitempty"`
+	// Contexts are the status contexts which must be 'success' on Branch (github-status).
+	// If empty, the combined status of the branch is used.
+	Contexts []string `json:"contexts,omitempty"`
+
+	// ResultsURL is a format string with a single %s for the job name, which yields the
+	// URL of a JSON results file for the latest run of that job (http-json).
+	ResultsURL string `json:"resultsURL,omitempty"`
+	// PRResultsURL is a format string with a single %d for the PR number, which yields the
+	// URL of a JSON results file for the latest run of the PR builder (http-json).
+	// If empty, WaitForResult uses the github status of the PR instead.
+	PRResultsURL string `json:"prResultsURL,omitempty"`
+
+	// PendingTimeout bounds how long WaitForResult waits for a retest to start, or for
+	// a new results file of the PR builder (http-json), as those have no pending state.
+	// It is set from the command line rather than the config file.
+	PendingTimeout time.Duration `json:"-"`
+	// DryRun stops the provider from reporting on PRs (jenkins). It is set from the
+	// command line rather than the config file.
+	DryRun bool `json:"-"`
+}
+
+// New creates the Provider described by config. client is used by providers which
+// read state from github, user and project name the repository being merged into.
+func New(config *Config, client *github.Client, user, project string) (Provider, error) {
+	retest := config.RetestComment
+	if len(retest) == 0 {
+		retest = defaultRetestComment
+	}
+	switch config.Type {
+	case JenkinsType:
+		if len(config.JenkinsHost) == 0 {
+			return nil, fmt.Errorf("%s provider requires jenkinsHost", config.Type)
+		}
+		return newJenkinsProvider(config, retest), nil
+	case GithubStatusType:
+		owner, repo, branch := config.Owner, config.Repo, config.Branch
+		if len(owner) == 0 {
+			owner = user
+		}
+		if len(repo) == 0 {
+			repo = project
+		}
+		if len(branch) == 0 {
+			branch = "master"
+		}
+		return &statusProvider{
+			client:         client,
+			owner:          owner,
+			repo:           repo,
+			branch:         branch,
+			contexts:       config.Contexts,
+			retestComment:  retest,
+			pendingTimeout: config.PendingTimeout,
+		}, nil
+	case HTTPJSONType:
+		if len(config.ResultsURL) == 0 {
+			return nil, fmt.Errorf("%s provider requires resultsURL", config.Type)
+		}
+		return newHTTPJSONProvider(config.ResultsURL, config.PRResultsURL, config.Jobs, retest, config.PendingTimeout), nil
+	default:
+		return nil, fmt.Errorf("unknown CI provider type: %q", config.Type)
+	}
+}
+
+// commentRetest asks the PR builder to test a PR again by commenting on it.
+func commentRetest(client *github.Client, user, project string, pr *github.PullRequest, body string) error {
+	glog.V(4).Infof("Asking PR builder to build %d", *pr.Number)
+	return sqgithub.WriteComment(client, user, project, *pr.Number, body, "retest before merging", false)
+}
+
+// waitForStatus waits up to pendingTimeout for the PR to go pending and then for its
+// github status to settle. A zero pendingTimeout only bounds the wait by ctx.
+func waitForStatus(ctx context.Context, client *github.Client, user, project string, pr *github.PullRequest, pendingTimeout time.Duration) (bool, error) {
+	// Wait for the build to start
+	pendingCtx := ctx
+	if pendingTimeout > 0 {
+		var cancel context.CancelFunc
+		pendingCtx, cancel = context.WithTimeout(ctx, pendingTimeout)
+		defer cancel()
+	}
+	if err := sqgithub.WaitForPending(pendingCtx, client, user, project, *pr.Number); err != nil {
+		return false, err
+	}
+	// Wait for the status to go back to 'success'
+	return sqgithub.ValidateStatus(ctx, client, user, project, *pr.Number, nil, true)
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+func stringPtr(val string) *string { return &val }
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		config    Config
+		expectErr bool
+	}{
+		{config: Config{Type: JenkinsType, JenkinsHost: "http://jenkins"}},
+		{config: Config{Type: JenkinsType}, expectErr: true},
+		{config: Config{Type: GithubStatusType}},
+		{config: Config{Type: HTTPJSONType, ResultsURL: "http://results/%s.json"}},
+		{config: Config{Type: HTTPJSONType}, expectErr: true},
+		{config: Config{Type: "travis"}, expectErr: true},
+	}
+	for _, test := range tests {
+		_, err := New(&test.config, nil, "o", "r")
+		if test.expectErr && err == nil {
+			t.Errorf("%v: expected error", test.config)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("%v: unexpected error: %v", test.config, err)
+		}
+	}
+}
+
+func TestIsCombinedStatusStable(t *testing.T) {
+	tests := []struct {
+		status   github.CombinedStatus
+		contexts []string
+		expected bool
+	}{
+		{
+			status:   github.CombinedStatus{State: stringPtr("success")},
+			expected: true,
+		},
+		{
+			status:   github.CombinedStatus{State: stringPtr("pending")},
+			expected: false,
+		},
+		{
+			status: github.CombinedStatus{
+				State: stringPtr("failure"),
+				Statuses: []github.RepoStatus{
+					{Context: stringPtr("e2e"), State: stringPtr("success")},
+					{Context: stringPtr("lint"), State: stringPtr("failure")},
+				},
+			},
+			contexts: []string{"e2e"},
+			expected: true,
+		},
+		{
+			status: github.CombinedStatus{
+				State: stringPtr("success"),
+				Statuses: []github.RepoStatus{
+					{Context: stringPtr("lint"), State: stringPtr("success")},
+				},
+			},
+			contexts: []string{"e2e"},
+			expected: false,
+		},
+	}
+	for i, test := range tests {
+		if stable := isCombinedStatusStable(&test.status, test.contexts); stable != test.expected {
+			t.Errorf("case %d: expected %v, saw %v", i, test.expected, stable)
+		}
+	}
+}
+
+func TestHTTPJSONIsStable(t *testing.T) {
+	results := map[string]Result{
+		"/good.json":   {Result: "SUCCESS"},
+		"/passed.json": {Passed: true},
+		"/bad.json":    {Result: "FAILURE"},
+	}
+	mux := http.NewServeMux()
+	for path, result := range results {
+		data, err := json.Marshal(result)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		jobs      []string
+		expected  bool
+		expectErr bool
+	}{
+		{jobs: []string{"good", "passed"}, expected: true},
+		{jobs: []string{"good", "bad"}, expected: false},
+		{jobs: []string{"missing"}, expectErr: true},
+	}
+	for _, test := range tests {
+		provider := newHTTPJSONProvider(server.URL+"/%s.json", "", test.jobs, "", 0)
+		stable, err := provider.IsStable()
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%v: expected error", test.jobs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.jobs, err)
+		}
+		if stable != test.expected {
+			t.Errorf("%v: expected %v, saw %v", test.jobs, test.expected, stable)
+		}
+	}
+}
+
+func TestHTTPJSONWaitForResult(t *testing.T) {
+	retested := time.Now()
+	hang := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pr/1.json", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(Result{Timestamp: retested.Unix() + 1, Result: "SUCCESS"})
+		w.Write(data)
+	})
+	mux.HandleFunc("/pr/2.json", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(Result{Timestamp: retested.Unix() - 60, Result: "SUCCESS"})
+		w.Write(data)
+	})
+	mux.HandleFunc("/pr/3.json", func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// the hung handler must return before the server can close
+	defer close(hang)
+
+	tests := []struct {
+		number    int
+		expected  bool
+		expectErr error
+	}{
+		{number: 1, expected: true},
+		// only a result older than the retest
+		{number: 2, expectErr: context.DeadlineExceeded},
+		// the server never answers
+		{number: 3, expectErr: context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		provider := newHTTPJSONProvider(server.URL+"/%s.json", server.URL+"/pr/%d.json", nil, "", 100*time.Millisecond)
+		provider.retested[test.number] = retested
+		pr := &github.PullRequest{Number: &test.number}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			ok, err := provider.WaitForResult(context.Background(), nil, "o", "r", pr)
+			if err != test.expectErr {
+				t.Errorf("%d: expected error %v, saw %v", test.number, test.expectErr, err)
+			}
+			if ok != test.expected {
+				t.Errorf("%d: expected %v, saw %v", test.number, test.expected, ok)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%d: WaitForResult did not return", test.number)
+		}
+	}
+}
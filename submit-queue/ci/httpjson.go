@@ -0,0 +1,152 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// Result is the JSON document describing the outcome of a CI run, in the same
+// format as the finished.json files the e2e jobs upload to GCS.
+type Result struct {
+	// Timestamp is the time the run finished, in seconds since the epoch.
+	Timestamp int64  `json:"timestamp"`
+	Result    string `json:"result"`
+	Passed    bool   `json:"passed"`
+}
+
+// Succeeded returns true if the run passed.
+func (r *Result) Succeeded() bool {
+	return r.Passed || r.Result == "SUCCESS"
+}
+
+// httpJSONProvider reads Results over HTTP. Public GCS buckets can be read this way
+// through https://storage.googleapis.com/<bucket>/<path>.
+type httpJSONProvider struct {
+	resultsURL    string
+	prResultsURL  string
+	jobs          []string
+	retestComment string
+	// pendingTimeout bounds how long to wait for a retest to start.
+	pendingTimeout time.Duration
+	// retested records when each PR was last asked to retest, so stale results are ignored.
+	retested map[int]time.Time
+}
+
+func newHTTPJSONProvider(resultsURL, prResultsURL string, jobs []string, retestComment string, pendingTimeout time.Duration) *httpJSONProvider {
+	return &httpJSONProvider{
+		resultsURL:     resultsURL,
+		prResultsURL:   prResultsURL,
+		jobs:           jobs,
+		retestComment:  retestComment,
+		pendingTimeout: pendingTimeout,
+		retested:       map[int]time.Time{},
+	}
+}
+
+// httpClient bounds every request for a results file, so that a hung server cannot
+// block a wait loop past its deadline.
+var httpClient = &http.Client{Timeout: time.Minute}
+
+// getResult fetches the Result at url. The request is abandoned once ctx is done.
+func getResult(ctx context.Context, url string) (*Result, error) {
+	glog.V(3).Infof("Hitting: %s", url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Cancel = ctx.Done()
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", url, res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (h *httpJSONProvider) IsStable() (bool, error) {
+	for _, job := range h.jobs {
+		glog.V(2).Infof("Checking build stability for %s", job)
+		result, err := getResult(context.Background(), fmt.Sprintf(h.resultsURL, job))
+		if err != nil {
+			return false, err
+		}
+		if !result.Succeeded() {
+			glog.Errorf("Build %s isn't stable, skipping!", job)
+			return false, nil
+		}
+	}
+	glog.V(2).Infof("Build is stable.")
+	return true, nil
+}
+
+func (h *httpJSONProvider) Retest(client *github.Client, user, project string, pr *github.PullRequest) error {
+	h.retested[*pr.Number] = time.Now()
+	return commentRetest(client, user, project, pr, h.retestComment)
+}
+
+func (h *httpJSONProvider) WaitForResult(ctx context.Context, client *github.Client, user, project string, pr *github.PullRequest) (bool, error) {
+	if len(h.prResultsURL) == 0 {
+		return waitForStatus(ctx, client, user, project, pr, h.pendingTimeout)
+	}
+	// a results file has no pending state, so pendingTimeout bounds the wait for a
+	// result newer than the retest
+	if h.pendingTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.pendingTimeout)
+		defer cancel()
+	}
+	url := fmt.Sprintf(h.prResultsURL, *pr.Number)
+	since := h.retested[*pr.Number]
+	for {
+		result, err := getResult(ctx, url)
+		if err != nil {
+			glog.V(4).Infof("No results for PR %d yet: %v", *pr.Number, err)
+		} else if !time.Unix(result.Timestamp, 0).Before(since) {
+			return result.Succeeded(), nil
+		}
+		glog.V(4).Info("PR has no new results, waiting for 30 seconds")
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
+func (h *httpJSONProvider) String() string {
+	return fmt.Sprintf("http-json(%s)", h.resultsURL)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	sqgithub "k8s.io/contrib/submit-queue/github"
+	"k8s.io/contrib/submit-queue/jenkins"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// jenkinsProvider considers the tree stable if recent builds of every job succeeded.
+type jenkinsProvider struct {
+	client             *jenkins.JenkinsClient
+	jobs               []string
+	stableBuilds       int
+	flakinessThreshold float64
+	retestJob          string
+	reportFailures     bool
+	retestComment      string
+	// pendingTimeout bounds how long to wait for a retest to start.
+	pendingTimeout time.Duration
+	// dryRun stops failures from being reported on PRs.
+	dryRun bool
+}
+
+func newJenkinsProvider(config *Config, retestComment string) *jenkinsProvider {
+	return &jenkinsProvider{
+		client: &jenkins.JenkinsClient{
+			Host:  config.JenkinsHost,
+			User:  config.JenkinsUser,
+			Token: config.JenkinsToken,
+		},
+		jobs:               config.Jobs,
+		stableBuilds:       config.StableBuilds,
+		flakinessThreshold: config.FlakinessThreshold,
+		retestJob:          config.RetestJob,
+		reportFailures:     config.ReportFailures,
+		retestComment:      retestComment,
+		pendingTimeout:     config.PendingTimeout,
+		dryRun:             config.DryRun,
+	}
+}
+
+func (j *jenkinsProvider) isJobStable(job string) (bool, error) {
+	if j.stableBuilds > 1 {
+		return j.client.IsBuildStableOver(job, j.stableBuilds, j.flakinessThreshold)
+	}
+	return j.client.IsBuildStable(job)
+}
+
+func (j *jenkinsProvider) IsStable() (bool, error) {
+	for _, job := range j.jobs {
+		glog.V(2).Infof("Checking build stability for %s", job)
+		stable, err := j.isJobStable(job)
+		if err != nil {
+			return false, err
+		}
+		if !stable {
+			glog.Errorf("Build %s isn't stable, skipping!", job)
+			return false, nil
+		}
+	}
+	glog.V(2).Infof("Build is stable.")
+	return true, nil
+}
+
+func (j *jenkinsProvider) Retest(client *github.Client, user, project string, pr *github.PullRequest) error {
+	if len(j.retestJob) == 0 {
+		return commentRetest(client, user, project, pr, j.retestComment)
+	}
+	params := url.Values{"PULL_NUMBER": {strconv.Itoa(*pr.Number)}}
+	if pr.Head != nil && pr.Head.SHA != nil {
+		params.Set("PULL_SHA", *pr.Head.SHA)
+	}
+	if pr.Base != nil && pr.Base.Ref != nil {
+		params.Set("PULL_BASE_REF", *pr.Base.Ref)
+	}
+	glog.V(4).Infof("Starting %s for PR %d", j.retestJob, *pr.Number)
+	return j.client.Build(j.retestJob, params)
+}
+
+func (j *jenkinsProvider) WaitForResult(ctx context.Context, client *github.Client, user, project string, pr *github.PullRequest) (bool, error) {
+	ok, err := waitForStatus(ctx, client, user, project, pr, j.pendingTimeout)
+	if err == nil && !ok && j.reportFailures {
+		if err := j.postFailures(client, user, project, pr); err != nil {
+			glog.Warningf("Failed to report test failures on PR %d: %v", *pr.Number, err)
+		}
+	}
+	return ok, err
+}
+
+// postFailures comments on the PR with the failed tests of each failed status which
+// links to a build on this Jenkins server.
+func (j *jenkinsProvider) postFailures(client *github.Client, user, project string, pr *github.PullRequest) error {
+	if pr.Head == nil || pr.Head.SHA == nil {
+		return nil
+	}
+	statuses, err := sqgithub.FailedStatuses(client, user, project, *pr.Head.SHA)
+	if err != nil {
+		return err
+	}
+	summaries := []string{}
+	for _, status := range statuses {
+		if status.TargetURL == nil || status.Context == nil || !j.client.OnServer(*status.TargetURL) {
+			continue
+		}
+		report, err := j.client.GetTestReport(*status.TargetURL)
+		if err != nil {
+			glog.Warningf("Failed to get test report for %s: %v", *status.TargetURL, err)
+			continue
+		}
+		if report.FailCount == 0 {
+			continue
+		}
+		summaries = append(summaries, fmt.Sprintf("**%s**: %s", *status.Context, jenkins.FailureSummary(*status.TargetURL, report)))
+	}
+	if len(summaries) == 0 {
+		return nil
+	}
+	return sqgithub.WriteComment(client, user, project, *pr.Number, strings.Join(summaries, "\n\n"), "Jenkins build failed", j.dryRun)
+}
+
+func (j *jenkinsProvider) String() string {
+	return fmt.Sprintf("jenkins(%s)", j.client.Host)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// statusProvider considers the tree stable if the head of a branch has passing github statuses.
+type statusProvider struct {
+	client         *github.Client
+	owner          string
+	repo           string
+	branch         string
+	contexts       []string
+	retestComment  string
+	pendingTimeout time.Duration
+}
+
+func (s *statusProvider) IsStable() (bool, error) {
+	status, _, err := s.client.Repositories.GetCombinedStatus(s.owner, s.repo, s.branch, &github.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	return isCombinedStatusStable(status, s.contexts), nil
+}
+
+// isCombinedStatusStable returns true if every context in contexts is 'success'. If contexts
+// is empty, the combined state of all contexts must be 'success'.
+func isCombinedStatusStable(status *github.CombinedStatus, contexts []string) bool {
+	if len(contexts) == 0 {
+		return status.State != nil && *status.State == "success"
+	}
+	states := map[string]string{}
+	for _, s := range status.Statuses {
+		if s.Context != nil && s.State != nil {
+			states[*s.Context] = *s.State
+		}
+	}
+	for _, context := range contexts {
+		if states[context] != "success" {
+			glog.Errorf("Status context %q is %q, skipping!", context, states[context])
+			return false
+		}
+	}
+	return true
+}
+
+func (s *statusProvider) Retest(client *github.Client, user, project string, pr *github.PullRequest) error {
+	return commentRetest(client, user, project, pr, s.retestComment)
+}
+
+func (s *statusProvider) WaitForResult(ctx context.Context, client *github.Client, user, project string, pr *github.PullRequest) (bool, error) {
+	return waitForStatus(ctx, client, user, project, pr, s.pendingTimeout)
+}
+
+func (s *statusProvider) String() string {
+	return fmt.Sprintf("github-status(%s/%s@%s)", s.owner, s.repo, s.branch)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"k8s.io/contrib/submit-queue/ci"
+	"k8s.io/contrib/submit-queue/flake"
+	"k8s.io/contrib/submit-queue/freeze"
+	"k8s.io/contrib/submit-queue/merge"
+)
+
+// RepoConfig holds the settings for a single repository.
+type RepoConfig struct {
+	// CI selects the continuous integration system which gates merges.
+	CI *ci.Config `json:"ci,omitempty"`
+	// Freeze restricts when PRs may be merged.
+	Freeze *freeze.Config `json:"freeze,omitempty"`
+	// Flakes sets how often PRs are retried when flaky status contexts fail.
+	Flakes *flake.Config `json:"flakes,omitempty"`
+	// Merge sets how PRs are merged and their commit messages.
+	Merge *merge.Config `json:"merge,omitempty"`
+	// Status selects the status contexts a PR needs to merge.
+	Status *StatusConfig `json:"status,omitempty"`
+}
+
+// StatusConfig selects the status contexts a PR needs to merge.
+type StatusConfig struct {
+	// BranchContexts maps a target branch to the contexts required to merge into it.
+	// Branches which aren't listed use --required-contexts.
+	BranchContexts map[string][]string `json:"branchContexts,omitempty"`
+	// OptionalContexts are logged when they fail but don't block a merge. They
+	// replace --optional-contexts.
+	OptionalContexts []string `json:"optionalContexts,omitempty"`
+	// AllCommits requires every commit of a PR to be passing, not only its head.
+	AllCommits bool `json:"allCommits,omitempty"`
+}
+
+// Config is the contents of the --config file, keyed by "<org>/<project>".
+type Config map[string]*RepoConfig
+
+func loadConfig(file string) (Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := Config{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// repoConfig returns the settings for org/project, or nil if there are none.
+func (c Config) repoConfig(org, project string) *RepoConfig {
+	return c[org+"/"+project]
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package flake tracks which status contexts fail on PRs in the submit queue, so that
+// contexts known to be flaky can be retried a limited number of times before giving up.
+package flake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+)
+
+// maxRecent is how many failures of each context are kept in its history.
+const maxRecent = 20
+
+// Config describes which status contexts are flaky.
+type Config struct {
+	// Budgets maps a flaky status context to how many times a PR may be retested
+	// because that context failed. Contexts which aren't listed are never retried.
+	Budgets map[string]int `json:"budgets,omitempty"`
+}
+
+// Decision is what the queue should do with a PR whose CI run failed.
+type Decision int
+
+const (
+	// Fail skips the PR, which stays out of the queue until its status is 'success' again.
+	Fail Decision = iota
+	// Retry tests the PR again right away.
+	Retry
+	// Exhausted skips the PR because its flaky contexts have used up their budget. It
+	// is returned once per head commit, so the failure can be reported on the PR.
+	Exhausted
+)
+
+// Failure is a single failure of a status context.
+type Failure struct {
+	PR        int       `json:"pr"`
+	SHA       string    `json:"sha"`
+	TargetURL string    `json:"targetURL,omitempty"`
+	Time      time.Time `json:"time"`
+	Retried   bool      `json:"retried"`
+}
+
+// History is the failure record of a status context.
+type History struct {
+	Context  string `json:"context"`
+	Budget   int    `json:"budget"`
+	Failures int    `json:"failures"`
+	Retries  int    `json:"retries"`
+	// Recent are the latest failures, oldest first.
+	Recent []Failure `json:"recent"`
+}
+
+// prState is how much of its budget a PR has used at its head commit.
+type prState struct {
+	sha      string
+	retries  map[string]int
+	reported bool
+}
+
+// Tracker records failed status contexts and decides whether to retry them.
+type Tracker struct {
+	budgets map[string]int
+
+	lock    sync.Mutex
+	prs     map[int]*prState
+	history map[string]*History
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// New creates a Tracker from config.
+func New(config *Config) *Tracker {
+	budgets := config.Budgets
+	if budgets == nil {
+		budgets = map[string]int{}
+	}
+	return &Tracker{
+		budgets: budgets,
+		prs:     map[int]*prState{},
+		history: map[string]*History{},
+		now:     time.Now,
+	}
+}
+
+// Record notes that the failed contexts failed on the head commit of pr, and decides
+// whether the PR should be retested. A PR is retried only if every failed context is
+// flaky and has budget left; the budget resets when new commits are pushed.
+func (t *Tracker) Record(pr *github.PullRequest, failed []github.RepoStatus) Decision {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	sha := ""
+	if pr.Head != nil && pr.Head.SHA != nil {
+		sha = *pr.Head.SHA
+	}
+	state := t.prs[*pr.Number]
+	if state == nil || state.sha != sha {
+		state = &prState{sha: sha, retries: map[string]int{}}
+		t.prs[*pr.Number] = state
+	}
+
+	retry := len(failed) > 0
+	exhausted := false
+	for _, status := range failed {
+		budget := t.budgets[context(status)]
+		if state.retries[context(status)] >= budget {
+			retry = false
+			exhausted = exhausted || budget > 0
+		}
+	}
+	for _, status := range failed {
+		name := context(status)
+		h := t.history[name]
+		if h == nil {
+			h = &History{Context: name, Budget: t.budgets[name]}
+			t.history[name] = h
+		}
+		failure := Failure{PR: *pr.Number, SHA: sha, Time: t.now(), Retried: retry}
+		if status.TargetURL != nil {
+			failure.TargetURL = *status.TargetURL
+		}
+		h.Failures++
+		h.Recent = append(h.Recent, failure)
+		if len(h.Recent) > maxRecent {
+			h.Recent = h.Recent[len(h.Recent)-maxRecent:]
+		}
+		if retry {
+			h.Retries++
+			state.retries[name]++
+		}
+	}
+
+	switch {
+	case retry:
+		glog.Infof("Retrying flaky contexts on PR %d: %v", *pr.Number, state.retries)
+		return Retry
+	case exhausted && !state.reported:
+		state.reported = true
+		return Exhausted
+	default:
+		return Fail
+	}
+}
+
+// Summary describes failed status contexts for a comment on a PR which has used up its
+// retry budget.
+func Summary(failed []github.RepoStatus) string {
+	var buf bytes.Buffer
+	buf.WriteString("Submit queue has run out of retries for flaky tests on this PR. The following contexts failed:\n")
+	for _, status := range failed {
+		if status.TargetURL != nil && len(*status.TargetURL) > 0 {
+			fmt.Fprintf(&buf, "- `%s`: %s\n", context(status), *status.TargetURL)
+		} else {
+			fmt.Fprintf(&buf, "- `%s`\n", context(status))
+		}
+	}
+	buf.WriteString("\nThe submit queue won't test this PR again on its own. Once the failures are fixed or explained, rerun the failed tests so that its status is 'success' and it rejoins the queue.")
+	return buf.String()
+}
+
+// ServeHTTP returns the failure history of every context which has failed, as JSON.
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	t.lock.Lock()
+	names := []string{}
+	for name := range t.history {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	history := []History{}
+	for _, name := range names {
+		history = append(history, *t.history[name])
+	}
+	data, err := json.Marshal(history)
+	t.lock.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func context(status github.RepoStatus) string {
+	if status.Context == nil {
+		return ""
+	}
+	return *status.Context
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func stringPtr(val string) *string { return &val }
+func intPtr(val int) *int          { return &val }
+
+func failure(context, url string) github.RepoStatus {
+	return github.RepoStatus{Context: stringPtr(context), State: stringPtr("failure"), TargetURL: stringPtr(url)}
+}
+
+func TestRecord(t *testing.T) {
+	tracker := New(&Config{Budgets: map[string]int{"e2e": 2, "unit": 1}})
+	tracker.now = func() time.Time { return time.Unix(0, 0) }
+	pr := func(sha string) *github.PullRequest {
+		return &github.PullRequest{Number: intPtr(1), Head: &github.PullRequestBranch{SHA: stringPtr(sha)}}
+	}
+	e2e := failure("e2e", "http://ci/e2e/1")
+	unit := failure("unit", "http://ci/unit/1")
+	lint := failure("lint", "http://ci/lint/1")
+
+	tests := []struct {
+		sha      string
+		failed   []github.RepoStatus
+		expected Decision
+	}{
+		{"a", nil, Fail},
+		{"a", []github.RepoStatus{lint}, Fail},
+		{"a", []github.RepoStatus{e2e, lint}, Fail},
+		{"a", []github.RepoStatus{e2e}, Retry},
+		{"a", []github.RepoStatus{e2e, unit}, Retry},
+		{"a", []github.RepoStatus{unit}, Exhausted},
+		// Only reported once per commit
+		{"a", []github.RepoStatus{e2e}, Fail},
+		// New commits reset the budget
+		{"b", []github.RepoStatus{unit}, Retry},
+		{"b", []github.RepoStatus{unit}, Exhausted},
+	}
+	for i, test := range tests {
+		if decision := tracker.Record(pr(test.sha), test.failed); decision != test.expected {
+			t.Errorf("case %d: expected %v, saw %v", i, test.expected, decision)
+		}
+	}
+
+	h := tracker.history["e2e"]
+	if h.Failures != 4 || h.Retries != 2 || len(h.Recent) != 4 {
+		t.Errorf("unexpected history: %+v", h)
+	}
+	if h.Recent[0].TargetURL != "http://ci/e2e/1" || h.Recent[0].Retried || !h.Recent[1].Retried {
+		t.Errorf("unexpected failures: %+v", h.Recent)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	summary := Summary([]github.RepoStatus{
+		failure("e2e", "http://ci/e2e/1"),
+		{Context: stringPtr("cla"), State: stringPtr("error")},
+	})
+	for _, line := range []string{"- `e2e`: http://ci/e2e/1\n", "- `cla`\n", "won't test this PR again on its own"} {
+		if !strings.Contains(summary, line) {
+			t.Errorf("expected %q in %q", line, summary)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	tracker := New(&Config{Budgets: map[string]int{"e2e": 1}})
+	pr := &github.PullRequest{Number: intPtr(3)}
+	tracker.Record(pr, []github.RepoStatus{failure("unit", ""), failure("e2e", "http://ci/e2e/3")})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/flakes", nil)
+	tracker.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected code: %d", w.Code)
+	}
+	history := []History{}
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history) != 2 || history[0].Context != "e2e" || history[0].Budget != 1 || history[1].Context != "unit" {
+		t.Errorf("unexpected history: %+v", history)
+	}
+	if history[0].Recent[0].PR != 3 || history[0].Recent[0].TargetURL != "http://ci/e2e/3" {
+		t.Errorf("unexpected failures: %+v", history[0].Recent)
+	}
+}
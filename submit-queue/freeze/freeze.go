@@ -0,0 +1,284 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package freeze decides when the submit queue may merge: operators can stop the queue
+// in an emergency, and merges can be restricted to windows of time or to PRs which are
+// approved for a frozen release branch.
+package freeze
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	sqgithub "k8s.io/contrib/submit-queue/github"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+)
+
+const dateLayout = "2006-01-02"
+
+// Period is a range of dates, inclusive, during which no PRs are merged.
+type Period struct {
+	// Start and End are dates in the form 2006-01-02.
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Config describes when the queue is frozen.
+type Config struct {
+	// BlockerLabel freezes the queue while any open issue has this label.
+	BlockerLabel string `json:"blockerLabel,omitempty"`
+	// File freezes the queue while it exists, its contents are the reason.
+	File string `json:"file,omitempty"`
+	// NoMergeDays are weekdays, such as "Saturday", on which no PRs are merged.
+	NoMergeDays []string `json:"noMergeDays,omitempty"`
+	// Freezes are periods during which no PRs are merged.
+	Freezes []Period `json:"freezes,omitempty"`
+	// TimeZone is the IANA time zone NoMergeDays and Freezes are in, UTC if empty.
+	TimeZone string `json:"timeZone,omitempty"`
+	// BranchFreezes maps a frozen branch to the label a PR needs to merge into it.
+	BranchFreezes map[string]string `json:"branchFreezes,omitempty"`
+}
+
+// period is a parsed Period, covering [start, end).
+type period struct {
+	start  time.Time
+	end    time.Time
+	reason string
+}
+
+// Freezer decides whether the queue may merge right now.
+type Freezer struct {
+	blockerLabel  string
+	file          string
+	noMergeDays   map[time.Weekday]bool
+	freezes       []period
+	location      *time.Location
+	branchFreezes map[string]string
+
+	lock sync.Mutex
+	// manual is the reason the queue was frozen over HTTP, or "" if it wasn't.
+	manual string
+	// reason is why the queue was frozen at the last check, or "" if it wasn't.
+	reason string
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// New creates a Freezer from config.
+func New(config *Config) (*Freezer, error) {
+	f := &Freezer{
+		blockerLabel:  config.BlockerLabel,
+		file:          config.File,
+		noMergeDays:   map[time.Weekday]bool{},
+		location:      time.UTC,
+		branchFreezes: config.BranchFreezes,
+		now:           time.Now,
+	}
+	if len(config.TimeZone) > 0 {
+		loc, err := time.LoadLocation(config.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		f.location = loc
+	}
+	for _, day := range config.NoMergeDays {
+		weekday, err := parseWeekday(day)
+		if err != nil {
+			return nil, err
+		}
+		f.noMergeDays[weekday] = true
+	}
+	for _, p := range config.Freezes {
+		start, err := time.ParseInLocation(dateLayout, p.Start, f.location)
+		if err != nil {
+			return nil, err
+		}
+		end, err := time.ParseInLocation(dateLayout, p.End, f.location)
+		if err != nil {
+			return nil, err
+		}
+		if end.Before(start) {
+			return nil, fmt.Errorf("freeze ends (%s) before it starts (%s)", p.End, p.Start)
+		}
+		f.freezes = append(f.freezes, period{start: start, end: end.AddDate(0, 0, 1), reason: p.Reason})
+	}
+	return f, nil
+}
+
+func parseWeekday(day string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(day, d.String()) || strings.EqualFold(day, d.String()[:3]) {
+			return d, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown day of the week: %q", day)
+}
+
+// windowReason returns why t is outside the merge windows, or "" if it isn't.
+func (f *Freezer) windowReason(t time.Time) string {
+	t = t.In(f.location)
+	if f.noMergeDays[t.Weekday()] {
+		return fmt.Sprintf("no merges on %s", t.Weekday())
+	}
+	for _, p := range f.freezes {
+		if !t.Before(p.start) && t.Before(p.end) {
+			reason := fmt.Sprintf("merge freeze from %s to %s", p.start.Format(dateLayout), p.end.AddDate(0, 0, -1).Format(dateLayout))
+			if len(p.reason) > 0 {
+				reason += ": " + p.reason
+			}
+			return reason
+		}
+	}
+	return ""
+}
+
+// fileReason returns the contents of the freeze file if it exists, or "" if it doesn't.
+func (f *Freezer) fileReason() (string, error) {
+	if len(f.file) == 0 {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(f.file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	reason := strings.TrimSpace(string(data))
+	if len(reason) == 0 {
+		reason = "no reason given"
+	}
+	return fmt.Sprintf("frozen by %s: %s", f.file, reason), nil
+}
+
+// blockerReason names the open issues labeled BlockerLabel, or returns "" if there are none.
+func (f *Freezer) blockerReason(client *github.Client, user, project string) (string, error) {
+	if len(f.blockerLabel) == 0 {
+		return "", nil
+	}
+	opts := &github.IssueListByRepoOptions{State: "open", Labels: []string{f.blockerLabel}}
+	issues, _, err := client.Issues.ListByRepo(user, project, opts)
+	if err != nil {
+		return "", err
+	}
+	blockers := []string{}
+	for _, issue := range issues {
+		blockers = append(blockers, fmt.Sprintf("#%d", *issue.Number))
+	}
+	if len(blockers) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%s issues are open: %s", f.blockerLabel, strings.Join(blockers, ", ")), nil
+}
+
+// Frozen returns true, with a reason, if the queue must not merge anything now.
+func (f *Freezer) Frozen(client *github.Client, user, project string) (bool, string, error) {
+	f.lock.Lock()
+	reason := f.manual
+	f.lock.Unlock()
+	if len(reason) > 0 {
+		reason = "frozen by an operator: " + reason
+	}
+	if len(reason) == 0 {
+		reason = f.windowReason(f.now())
+	}
+	var err error
+	if len(reason) == 0 {
+		reason, err = f.fileReason()
+	}
+	if len(reason) == 0 && err == nil {
+		reason, err = f.blockerReason(client, user, project)
+	}
+	if err != nil {
+		return false, "", err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if reason != f.reason {
+		if len(reason) > 0 {
+			glog.Warningf("Submit queue is frozen: %s", reason)
+		} else {
+			glog.Infof("Submit queue is no longer frozen")
+		}
+	}
+	f.reason = reason
+	return len(reason) > 0, reason, nil
+}
+
+// AllowsPR returns true if the PR may merge into its branch. If the branch is frozen,
+// the PR must carry the branch's label; otherwise the reason it may not merge is returned.
+func (f *Freezer) AllowsPR(pr *github.PullRequest, issue *github.Issue) (bool, string) {
+	if pr.Base == nil || pr.Base.Ref == nil {
+		return true, ""
+	}
+	label, frozen := f.branchFreezes[*pr.Base.Ref]
+	if !frozen || sqgithub.HasLabel(issue.Labels, label) {
+		return true, ""
+	}
+	return false, fmt.Sprintf("%s is frozen, PRs need the %q label", *pr.Base.Ref, label)
+}
+
+// freezeStatus is served by ServeHTTP.
+type freezeStatus struct {
+	Frozen bool   `json:"frozen"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ServeHTTP lets operators see and change the freeze. GET returns whether the queue
+// was frozen at the last check and why, POST with a "reason" parameter freezes the
+// queue and DELETE lifts a freeze made by POST.
+func (f *Freezer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch r.Method {
+	case "GET":
+	case "POST":
+		reason := r.FormValue("reason")
+		if len(reason) == 0 {
+			http.Error(w, "a reason is required", http.StatusBadRequest)
+			return
+		}
+		glog.Warningf("Submit queue frozen by %v: %s", r.RemoteAddr, reason)
+		f.manual = reason
+		f.reason = "frozen by an operator: " + reason
+	case "DELETE":
+		glog.Infof("Submit queue unfrozen by %v", r.RemoteAddr)
+		if len(f.manual) > 0 {
+			f.reason = ""
+		}
+		f.manual = ""
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := json.Marshal(freezeStatus{Frozen: len(f.reason) > 0, Reason: f.reason})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
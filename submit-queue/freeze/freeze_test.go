@@ -0,0 +1,207 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package freeze
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	github_test "k8s.io/contrib/submit-queue/github/testing"
+
+	"github.com/google/go-github/github"
+)
+
+func stringPtr(val string) *string { return &val }
+func intPtr(val int) *int          { return &val }
+
+func TestWindowReason(t *testing.T) {
+	f, err := New(&Config{
+		NoMergeDays: []string{"Saturday", "sun"},
+		Freezes:     []Period{{Start: "2015-10-28", End: "2015-10-30", Reason: "1.1 release"}},
+		TimeZone:    "America/Los_Angeles",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		time     string
+		expected string
+	}{
+		// Tuesday
+		{"2015-10-27T12:00:00Z", ""},
+		// Saturday 01:00 UTC is still Friday in Los Angeles
+		{"2015-10-24T01:00:00Z", ""},
+		{"2015-10-24T08:00:00Z", "no merges on Saturday"},
+		{"2015-10-25T20:00:00Z", "no merges on Sunday"},
+		{"2015-10-28T07:00:00Z", "merge freeze from 2015-10-28 to 2015-10-30: 1.1 release"},
+		{"2015-10-31T06:59:00Z", "merge freeze from 2015-10-28 to 2015-10-30: 1.1 release"},
+		// Saturday morning in Los Angeles after the freeze ends
+		{"2015-10-31T07:00:00Z", "no merges on Saturday"},
+	}
+	for _, test := range tests {
+		now, err := time.Parse(time.RFC3339, test.time)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reason := f.windowReason(now); reason != test.expected {
+			t.Errorf("%s: expected %q, saw %q", test.time, test.expected, reason)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	configs := []Config{
+		{NoMergeDays: []string{"Caturday"}},
+		{TimeZone: "Mars/Olympus_Mons"},
+		{Freezes: []Period{{Start: "2015-10-30", End: "2015-10-28"}}},
+		{Freezes: []Period{{Start: "tomorrow", End: "2015-10-28"}}},
+	}
+	for _, config := range configs {
+		if _, err := New(&config); err == nil {
+			t.Errorf("%v: expected error", config)
+		}
+	}
+}
+
+func TestFrozen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freeze")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "frozen")
+
+	tests := []struct {
+		blockers []github.Issue
+		file     string
+		manual   string
+		expected string
+	}{
+		{expected: ""},
+		{blockers: []github.Issue{{Number: intPtr(5)}, {Number: intPtr(7)}}, expected: "merge-blocker issues are open: #5, #7"},
+		{file: "outage\n", expected: "frozen by " + file + ": outage"},
+		{file: "", expected: "frozen by " + file + ": no reason given"},
+		{manual: "testing", file: "outage", expected: "frozen by an operator: testing"},
+	}
+	for i, test := range tests {
+		client, server, mux := github_test.InitTest()
+		mux.HandleFunc("/repos/o/r/issues", func(w http.ResponseWriter, r *http.Request) {
+			if labels := r.URL.Query().Get("labels"); labels != "merge-blocker" {
+				t.Errorf("Unexpected labels: %s", labels)
+			}
+			data, err := json.Marshal(test.blockers)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			w.Write(data)
+		})
+		os.Remove(file)
+		if i >= 2 {
+			if err := ioutil.WriteFile(file, []byte(test.file), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		f, err := New(&Config{BlockerLabel: "merge-blocker", File: file})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f.manual = test.manual
+		frozen, reason, err := f.Frozen(client, "o", "r")
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if reason != test.expected || frozen != (len(test.expected) > 0) {
+			t.Errorf("case %d: expected %q, saw %v %q", i, test.expected, frozen, reason)
+		}
+		server.Close()
+	}
+}
+
+func TestAllowsPR(t *testing.T) {
+	f, err := New(&Config{BranchFreezes: map[string]string{"release-1.1": "cherrypick-approved"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		branch  string
+		labels  []string
+		allowed bool
+	}{
+		{branch: "master", allowed: true},
+		{branch: "release-1.1", allowed: false},
+		{branch: "release-1.1", labels: []string{"lgtm"}, allowed: false},
+		{branch: "release-1.1", labels: []string{"lgtm", "cherrypick-approved"}, allowed: true},
+	}
+	for _, test := range tests {
+		issue := &github.Issue{}
+		for _, label := range test.labels {
+			issue.Labels = append(issue.Labels, github.Label{Name: stringPtr(label)})
+		}
+		pr := &github.PullRequest{Base: &github.PullRequestBranch{Ref: stringPtr(test.branch)}}
+		if allowed, reason := f.AllowsPR(pr, issue); allowed != test.allowed {
+			t.Errorf("%s %v: expected %v, saw %v (%s)", test.branch, test.labels, test.allowed, allowed, reason)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	f, err := New(&Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		method   string
+		reason   string
+		code     int
+		expected freezeStatus
+	}{
+		{method: "GET", code: http.StatusOK, expected: freezeStatus{}},
+		{method: "POST", code: http.StatusBadRequest},
+		{method: "POST", reason: "outage", code: http.StatusOK, expected: freezeStatus{Frozen: true, Reason: "frozen by an operator: outage"}},
+		{method: "GET", code: http.StatusOK, expected: freezeStatus{Frozen: true, Reason: "frozen by an operator: outage"}},
+		{method: "DELETE", code: http.StatusOK, expected: freezeStatus{}},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, "/freeze", strings.NewReader("reason="+test.reason))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("case %d: expected code %d, saw %d", i, test.code, w.Code)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		status := freezeStatus{}
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if status != test.expected {
+			t.Errorf("case %d: expected %v, saw %v", i, test.expected, status)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+)
+
+// HasLabel returns true if a label called name is in labels.
+func HasLabel(labels []github.Label, name string) bool {
+	return hasLabel(labels, name)
+}
+
+// AddLabels adds labels to a PR, unless dryRun is set in which case it only logs. The
+// action and reason are recorded in the audit log.
+func AddLabels(client *github.Client, user, project string, prNumber int, labels []string, reason string, dryRun bool) error {
+	detail := strings.Join(labels, ",")
+	if dryRun {
+		glog.Infof("(dry-run) would add labels %v to PR %d", labels, prNumber)
+		audit(user, project, prNumber, ActionAddLabels, detail, reason, true, nil, nil)
+		return nil
+	}
+	glog.Infof("Adding labels %v to PR %d", labels, prNumber)
+	_, resp, err := client.Issues.AddLabelsToIssue(user, project, prNumber, labels)
+	audit(user, project, prNumber, ActionAddLabels, detail, reason, false, resp, err)
+	return err
+}
+
+// RemoveLabel removes a label from a PR, unless dryRun is set in which case it only logs.
+// The action and reason are recorded in the audit log.
+func RemoveLabel(client *github.Client, user, project string, prNumber int, label, reason string, dryRun bool) error {
+	if dryRun {
+		glog.Infof("(dry-run) would remove label %q from PR %d", label, prNumber)
+		audit(user, project, prNumber, ActionRemoveLabel, label, reason, true, nil, nil)
+		return nil
+	}
+	glog.Infof("Removing label %q from PR %d", label, prNumber)
+	resp, err := client.Issues.RemoveLabelForIssue(user, project, prNumber, label)
+	audit(user, project, prNumber, ActionRemoveLabel, label, reason, false, resp, err)
+	return err
+}
+
+// WriteComment comments on a PR, unless dryRun is set in which case it only logs. The
+// action and reason are recorded in the audit log.
+func WriteComment(client *github.Client, user, project string, prNumber int, body, reason string, dryRun bool) error {
+	if dryRun {
+		glog.Infof("(dry-run) would comment on PR %d: %s", prNumber, body)
+		audit(user, project, prNumber, ActionComment, body, reason, true, nil, nil)
+		return nil
+	}
+	glog.V(2).Infof("Commenting on PR %d: %s", prNumber, body)
+	_, resp, err := client.Issues.CreateComment(user, project, prNumber, &github.IssueComment{Body: &body})
+	audit(user, project, prNumber, ActionComment, body, reason, false, resp, err)
+	return err
+}
+
+// Merge methods accepted by MergePR.
+const (
+	MergeMethodMerge  = "merge"
+	MergeMethodSquash = "squash"
+	MergeMethodRebase = "rebase"
+)
+
+// mergeRequest is the body of a request to merge a PR. go-github doesn't yet support
+// anything but the commit message.
+type mergeRequest struct {
+	CommitMessage string `json:"commit_message,omitempty"`
+	SHA           string `json:"sha,omitempty"`
+	MergeMethod   string `json:"merge_method,omitempty"`
+}
+
+// MergePR merges a PR with method, one of the MergeMethod constants. If sha is set the
+// merge fails unless it is still the head of the PR. The merge and reason are recorded
+// in the audit log.
+func MergePR(client *github.Client, user, project string, prNumber int, method, message, sha, reason string) (*github.PullRequestMergeResult, error) {
+	glog.Infof("Merging PR %d with method %q", prNumber, method)
+	u := fmt.Sprintf("repos/%v/%v/pulls/%d/merge", user, project, prNumber)
+	req, err := client.NewRequest("PUT", u, &mergeRequest{CommitMessage: message, SHA: sha, MergeMethod: method})
+	if err != nil {
+		return nil, err
+	}
+	// Merge methods other than 'merge' are a preview feature
+	req.Header.Set("Accept", "application/vnd.github.polaris-preview+json")
+	result := &github.PullRequestMergeResult{}
+	resp, err := client.Do(req, result)
+	if err == nil && (result.Merged == nil || !*result.Merged) {
+		err = fmt.Errorf("github did not merge PR %d", prNumber)
+		if result.Message != nil {
+			err = fmt.Errorf("github did not merge PR %d: %s", prNumber, *result.Message)
+		}
+	}
+	audit(user, project, prNumber, ActionMerge, method, reason, false, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionComment     = "comment"
+	ActionAddLabels   = "add-labels"
+	ActionRemoveLabel = "remove-label"
+	ActionMerge       = "merge"
+)
+
+// AuditRecord is a single action the bot took, or would have taken, on a PR.
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Repo   string    `json:"repo"`
+	PR     int       `json:"pr"`
+	Action string    `json:"action"`
+	// Detail is the comment body, the labels or the merge method.
+	Detail string `json:"detail,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	DryRun bool   `json:"dryRun"`
+	// Code is the HTTP status of github's response, 0 if there was none.
+	Code  int    `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// AuditLog writes one JSON object per line for every action.
+type AuditLog struct {
+	lock sync.Mutex
+	w    io.Writer
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewAuditLog creates an AuditLog which writes to w.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w, now: time.Now}
+}
+
+// OpenAuditLog creates an AuditLog which appends to file.
+func OpenAuditLog(file string) (*AuditLog, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditLog(f), nil
+}
+
+// Record writes record to the log, filling in its time.
+func (a *AuditLog) Record(record AuditRecord) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	record.Time = a.now()
+	data, err := json.Marshal(record)
+	if err != nil {
+		glog.Errorf("Failed to encode audit record %+v: %v", record, err)
+		return
+	}
+	if _, err := a.w.Write(append(data, '\n')); err != nil {
+		glog.Errorf("Failed to write audit record: %v", err)
+	}
+}
+
+// auditLog records the actions in actions.go, if it is set.
+var auditLog *AuditLog
+
+// SetAuditLog sends a record of every action to log. It must be called before
+// any action is taken.
+func SetAuditLog(log *AuditLog) {
+	auditLog = log
+}
+
+// audit records an action if there is an audit log.
+func audit(user, project string, prNumber int, action, detail, reason string, dryRun bool, resp *github.Response, err error) {
+	if auditLog == nil {
+		return
+	}
+	record := AuditRecord{
+		Repo:   user + "/" + project,
+		PR:     prNumber,
+		Action: action,
+		Detail: detail,
+		Reason: reason,
+		DryRun: dryRun,
+	}
+	if resp != nil && resp.Response != nil {
+		record.Code = resp.StatusCode
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	auditLog.Record(record)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestAuditLog(t *testing.T) {
+	client, server, mux := initTest()
+	defer server.Close()
+	mux.HandleFunc("/repos/o/r/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/labels/lgtm", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	})
+
+	var buf bytes.Buffer
+	log := NewAuditLog(&buf)
+	log.now = func() time.Time { return time.Unix(0, 0).UTC() }
+	SetAuditLog(log)
+	defer SetAuditLog(nil)
+
+	if err := WriteComment(client, "o", "r", 1, "hello", "testing", false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := AddLabels(client, "o", "r", 1, []string{"a", "b"}, "testing", true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := RemoveLabel(client, "o", "r", 1, "lgtm", "testing", false); err == nil {
+		t.Errorf("expected error")
+	}
+
+	expected := []AuditRecord{
+		{Time: time.Unix(0, 0).UTC(), Repo: "o/r", PR: 1, Action: ActionComment, Detail: "hello", Reason: "testing", Code: http.StatusCreated},
+		{Time: time.Unix(0, 0).UTC(), Repo: "o/r", PR: 1, Action: ActionAddLabels, Detail: "a,b", Reason: "testing", DryRun: true},
+		{Time: time.Unix(0, 0).UTC(), Repo: "o/r", PR: 1, Action: ActionRemoveLabel, Detail: "lgtm", Reason: "testing", Code: http.StatusNotFound},
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d records, saw %q", len(expected), lines)
+	}
+	for i, line := range lines {
+		record := AuditRecord{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if i == 2 && len(record.Error) == 0 {
+			t.Errorf("expected an error in %q", line)
+		}
+		record.Error = ""
+		if record != expected[i] {
+			t.Errorf("expected %+v, saw %+v", expected[i], record)
+		}
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	testClient, server, mux := initTest()
+	defer server.Close()
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Server Error"}`, http.StatusBadGateway)
+	})
+	client := github.NewClient(instrument(nil))
+	client.BaseURL = testClient.BaseURL
+
+	count := func() float64 {
+		m := &dto.Metric{}
+		if err := apiErrors.WithLabelValues("502").Write(m); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return m.GetCounter().GetValue()
+	}
+	before := count()
+	if _, _, err := client.PullRequests.Get("o", "r", 1); err == nil {
+		t.Errorf("expected error")
+	}
+	if after := count(); after != before+1 {
+		t.Errorf("expected %v errors, saw %v", before+1, after)
+	}
+}
+
+func TestAPIErrorsMissingContents(t *testing.T) {
+	testClient, server, mux := initTest()
+	defer server.Close()
+	mux.HandleFunc("/repos/o/r/contents/pkg/OWNERS", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	})
+	client := github.NewClient(instrument(nil))
+	client.BaseURL = testClient.BaseURL
+
+	count := func() float64 {
+		m := &dto.Metric{}
+		if err := apiErrors.WithLabelValues("404").Write(m); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return m.GetCounter().GetValue()
+	}
+	before := count()
+	if _, _, _, err := client.Repositories.GetContents("o", "r", "pkg/OWNERS", nil); err == nil {
+		t.Errorf("expected error")
+	}
+	if after := count(); after != before {
+		t.Errorf("expected a missing file not to count, saw %v errors", after-before)
+	}
+	if _, _, err := client.PullRequests.Get("o", "r", 1); err == nil {
+		t.Errorf("expected error")
+	}
+	if after := count(); after != before+1 {
+		t.Errorf("expected %v errors, saw %v", before+1, after)
+	}
+}
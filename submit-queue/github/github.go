@@ -18,22 +18,48 @@ package github
 
 import (
 	"fmt"
+	"net/http"
 	"time"
 
 	"k8s.io/kubernetes/pkg/util"
 
 	"github.com/golang/glog"
 	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 )
 
+// pollInterval is how long the wait loops sleep between checks of github.
+var pollInterval = 30 * time.Second
+
+// defaultMergeabilityTimeout is used if FilterConfig.MergeabilityTimeout is unset.
+const defaultMergeabilityTimeout = 10 * time.Second
+
+// sleep pauses for d, or until ctx is done in which case it returns ctx.Err().
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// MakeClient creates a github client which authenticates with token, if it is set, and
+// counts failed requests in the submitqueue_github_api_errors_total metric.
 func MakeClient(token string) *github.Client {
+	return MakeClientWithTransport(token, nil)
+}
+
+// MakeClientWithTransport is MakeClient with requests sent through transport, or
+// http.DefaultTransport if it is nil.
+func MakeClientWithTransport(token string, transport http.RoundTripper) *github.Client {
+	client := &http.Client{Transport: transport}
 	if len(token) > 0 {
 		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-		tc := oauth2.NewClient(oauth2.NoContext, ts)
-		return github.NewClient(tc)
+		client = &http.Client{Transport: &oauth2.Transport{Source: ts, Base: transport}}
 	}
-	return github.NewClient(nil)
+	return github.NewClient(instrument(client))
 }
 
 func hasLabel(labels []github.Label, name string) bool {
@@ -77,13 +103,76 @@ func fetchAllPRs(client *github.Client, user, project string) ([]github.PullRequ
 	return result, nil
 }
 
-type PRFunction func(*github.Client, *github.PullRequest, *github.Issue) error
+type PRFunction func(context.Context, *github.Client, *github.PullRequest, *github.Issue) error
 
 type FilterConfig struct {
 	MinPRNumber            int
 	UserWhitelist          []string
 	WhitelistOverride      string
 	RequiredStatusContexts []string
+	// MergeabilityTimeout is how long to wait for github to compute whether a PR is mergeable.
+	MergeabilityTimeout time.Duration
+	// RequireOwnersApproval replaces the UserWhitelist check with approval by the OWNERS
+	// of every file the PR changes.
+	RequireOwnersApproval bool
+	// ApprovalLabel, if set, approves a PR on behalf of the user who applied it.
+	ApprovalLabel string
+	// BranchContexts maps a target branch to the status contexts required to merge into
+	// it, in place of RequiredStatusContexts.
+	BranchContexts map[string][]string
+	// OptionalContexts may fail without blocking a merge.
+	OptionalContexts []string
+	// AllCommits requires every commit in a PR to be passing, not only the head commit.
+	AllCommits bool
+	// Skipped, if set, is called with the reason whenever a PR fails a check.
+	Skipped func(prNumber int, reason string)
+	// DryRun stops the checks from commenting on PRs.
+	DryRun bool
+}
+
+// skip reports that a PR failed a check.
+func (config *FilterConfig) skip(prNumber int, reason string) {
+	if config.Skipped != nil {
+		config.Skipped(prNumber, reason)
+	}
+}
+
+// statusOptions returns the status requirements for merging pr.
+func (config *FilterConfig) statusOptions(pr *github.PullRequest) *StatusOptions {
+	required := config.RequiredStatusContexts
+	if pr.Base != nil && pr.Base.Ref != nil {
+		if contexts, ok := config.BranchContexts[*pr.Base.Ref]; ok {
+			required = contexts
+		}
+	}
+	return &StatusOptions{
+		Required:   required,
+		Optional:   config.OptionalContexts,
+		AllCommits: config.AllCommits,
+	}
+}
+
+// waitForMergeable polls github until it knows whether the PR is mergeable, or the
+// config's MergeabilityTimeout expires.
+func waitForMergeable(ctx context.Context, client *github.Client, user, project string, pr *github.PullRequest, config *FilterConfig) (*github.PullRequest, error) {
+	timeout := config.MergeabilityTimeout
+	if timeout == 0 {
+		timeout = defaultMergeabilityTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for pr.Mergeable == nil {
+		glog.Infof("Waiting for mergeability on %s %d", *pr.Title, *pr.Number)
+		if err := sleep(ctx, timeout/5); err != nil {
+			return pr, err
+		}
+		update, _, err := client.PullRequests.Get(user, project, *pr.Number)
+		if err != nil {
+			return pr, err
+		}
+		pr = update
+	}
+	return pr, nil
 }
 
 func lastModifiedTime(client *github.Client, user, project string, pr *github.PullRequest) (*time.Time, error) {
@@ -122,13 +211,44 @@ func validateLGTMAfterPush(client *github.Client, user, project string, pr *gith
 	return lastModifiedTime.Before(*lgtmTime), nil
 }
 
+// ForEachPRDo runs fn over every open PR in the project, with the full PR and its issue.
+// Errors from fn are logged and the remaining PRs are still visited. If ctx is cancelled,
+// the remaining PRs are skipped and ctx.Err() is returned.
+func ForEachPRDo(ctx context.Context, client *github.Client, user, project string, fn PRFunction) error {
+	prs, err := fetchAllPRs(client, user, project)
+	if err != nil {
+		return err
+	}
+	for ix := range prs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		pr, _, err := client.PullRequests.Get(user, project, *prs[ix].Number)
+		if err != nil {
+			glog.Errorf("Error getting pull request: %v", err)
+			continue
+		}
+		issue, _, err := client.Issues.Get(user, project, *pr.Number)
+		if err != nil {
+			glog.Errorf("Failed to get issue for PR: %v", err)
+			continue
+		}
+		if err := fn(ctx, client, pr, issue); err != nil {
+			glog.Errorf("Failed to run function on PR %d: %v", *pr.Number, err)
+		}
+	}
+	return nil
+}
+
 // For each PR in the project that matches:
 //   * pr.Number > minPRNumber
 //   * is mergeable
 //   * has labels "cla: yes", "lgtm"
+//   * the author is whitelisted, or if RequireOwnersApproval is set every file is approved by an owner
 //   * combinedStatus = 'success' (e.g. all hooks have finished success in github)
 // Run the specified function
-func ForEachCandidatePRDo(client *github.Client, user, project string, fn PRFunction, once bool, config *FilterConfig) error {
+// If ctx is cancelled, the remaining PRs are skipped and ctx.Err() is returned.
+func ForEachCandidatePRDo(ctx context.Context, client *github.Client, user, project string, fn PRFunction, once bool, config *FilterConfig) error {
 	// Get all PRs
 	prs, err := fetchAllPRs(client, user, project)
 	if err != nil {
@@ -138,139 +258,234 @@ func ForEachCandidatePRDo(client *github.Client, user, project string, fn PRFunc
 	userSet := util.StringSet{}
 	userSet.Insert(config.UserWhitelist...)
 
+	// Until the pass ends, the gauge keeps the length found by the last pass, unless this
+	// pass has found more candidates already.
+	candidates := 0
+	defer func() {
+		lastQueueLength = candidates
+		queueLength.Set(float64(candidates))
+	}()
 	for ix := range prs {
-		if prs[ix].User == nil || prs[ix].User.Login == nil {
-			glog.V(2).Infof("Skipping PR %d with no user info %v.", *prs[ix].Number, *prs[ix].User)
-			continue
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-		if *prs[ix].Number < config.MinPRNumber {
-			glog.V(6).Infof("Dropping %d < %d", *prs[ix].Number, config.MinPRNumber)
+		pr, issue, ok := isCandidate(ctx, client, user, project, &prs[ix], userSet, config)
+		if !ok {
 			continue
 		}
-		pr, _, err := client.PullRequests.Get(user, project, *prs[ix].Number)
-		if err != nil {
-			glog.Errorf("Error getting pull request: %v", err)
-			continue
+		candidates++
+		if candidates > lastQueueLength {
+			queueLength.Set(float64(candidates))
 		}
-		glog.V(2).Infof("----==== %d ====----", *pr.Number)
-
-		// Labels are actually stored in the Issues API, not the Pull Request API
-		issue, _, err := client.Issues.Get(user, project, *pr.Number)
-		if err != nil {
-			glog.Errorf("Failed to get issue for PR: %v", err)
-			continue
-		}
-
-		glog.V(8).Infof("%v", issue.Labels)
-		if !hasLabels(issue.Labels, []string{"lgtm", "cla: yes"}) {
+		if err := fn(ctx, client, pr, issue); err != nil {
+			glog.Errorf("Failed to run user function: %v", err)
 			continue
 		}
-		if !hasLabel(issue.Labels, config.WhitelistOverride) && !userSet.Has(*prs[ix].User.Login) {
-			glog.V(4).Infof("Dropping %d since %s isn't in whitelist and %s isn't present", *prs[ix].Number, *prs[ix].User.Login, config.WhitelistOverride)
-			continue
+		if once {
+			return nil
 		}
+	}
+	return nil
+}
 
-		lastModifiedTime, err := lastModifiedTime(client, user, project, pr)
-		if err != nil {
-			glog.Errorf("Failed to get last modified time, skipping PR: %d", *pr.Number)
-			continue
-		}
-		if ok, err := validateLGTMAfterPush(client, user, project, pr, lastModifiedTime); err != nil {
-			glog.Errorf("Error validating LGTM: %v, Skipping: %d", err, *pr.Number)
-			continue
+// isCandidate fetches the current state of a listed PR and checks that it may
+// be merged. A PR which is not a candidate is recorded with config.skip.
+func isCandidate(ctx context.Context, client *github.Client, user, project string, listed *github.PullRequest, userSet util.StringSet, config *FilterConfig) (*github.PullRequest, *github.Issue, bool) {
+	if listed.User == nil || listed.User.Login == nil {
+		glog.V(2).Infof("Skipping PR %d with no user info %v.", *listed.Number, *listed.User)
+		return nil, nil, false
+	}
+	if *listed.Number < config.MinPRNumber {
+		glog.V(6).Infof("Dropping %d < %d", *listed.Number, config.MinPRNumber)
+		config.skip(*listed.Number, fmt.Sprintf("below --min-pr-number %d", config.MinPRNumber))
+		return nil, nil, false
+	}
+	pr, _, err := client.PullRequests.Get(user, project, *listed.Number)
+	if err != nil {
+		glog.Errorf("Error getting pull request: %v", err)
+		config.skip(*listed.Number, fmt.Sprintf("error getting PR: %v", err))
+		return nil, nil, false
+	}
+	glog.V(2).Infof("----==== %d ====----", *pr.Number)
+
+	// Labels are actually stored in the Issues API, not the Pull Request API
+	issue, _, err := client.Issues.Get(user, project, *pr.Number)
+	if err != nil {
+		glog.Errorf("Failed to get issue for PR: %v", err)
+		config.skip(*pr.Number, fmt.Sprintf("error getting issue: %v", err))
+		return nil, nil, false
+	}
+
+	glog.V(8).Infof("%v", issue.Labels)
+	if !hasLabels(issue.Labels, []string{"lgtm", "cla: yes"}) {
+		config.skip(*pr.Number, `missing the "lgtm" or "cla: yes" label`)
+		return nil, nil, false
+	}
+	if config.RequireOwnersApproval {
+		if ok, err := ValidateOwnersApproval(client, user, project, pr, config.ApprovalLabel, config.DryRun); err != nil {
+			glog.Errorf("Error validating OWNERS approval: %v, Skipping: %d", err, *pr.Number)
+			config.skip(*pr.Number, fmt.Sprintf("error validating OWNERS approval: %v", err))
+			return nil, nil, false
 		} else if !ok {
-			glog.Errorf("PR pushed after LGTM, attempting to remove LGTM and skipping")
-			staleLGTMBody := "LGTM was before last commit, removing LGTM"
-			if _, _, err := client.Issues.CreateComment(user, project, *pr.Number, &github.IssueComment{Body: &staleLGTMBody}); err != nil {
-				glog.Warningf("Failed to create remove label comment: %v", err)
-			}
-			if _, err := client.Issues.RemoveLabelForIssue(user, project, *pr.Number, "lgtm"); err != nil {
-				glog.Warningf("Failed to remove 'lgtm' label for stale lgtm on %d", *pr.Number)
-			}
-			continue
+			glog.V(4).Infof("Dropping %d since it isn't approved by OWNERS", *pr.Number)
+			config.skip(*pr.Number, "not approved by OWNERS")
+			return nil, nil, false
 		}
+	} else if !hasLabel(issue.Labels, config.WhitelistOverride) && !userSet.Has(*listed.User.Login) {
+		glog.V(4).Infof("Dropping %d since %s isn't in whitelist and %s isn't present", *listed.Number, *listed.User.Login, config.WhitelistOverride)
+		config.skip(*pr.Number, fmt.Sprintf("%s isn't in the whitelist and %q isn't present", *listed.User.Login, config.WhitelistOverride))
+		return nil, nil, false
+	}
 
-		// This is annoying, github appears to only temporarily cache mergeability, if it is nil, wait
-		// for an async refresh and retry.
-		if pr.Mergeable == nil {
-			glog.Infof("Waiting for mergeability on %s %d", *pr.Title, *pr.Number)
-			// TODO: determine what a good empirical setting for this is.
-			time.Sleep(10 * time.Second)
-			pr, _, err = client.PullRequests.Get(user, project, *prs[ix].Number)
+	lastModifiedTime, err := lastModifiedTime(client, user, project, pr)
+	if err != nil {
+		glog.Errorf("Failed to get last modified time, skipping PR: %d", *pr.Number)
+		config.skip(*pr.Number, fmt.Sprintf("error getting last modified time: %v", err))
+		return nil, nil, false
+	}
+	if ok, err := validateLGTMAfterPush(client, user, project, pr, lastModifiedTime); err != nil {
+		glog.Errorf("Error validating LGTM: %v, Skipping: %d", err, *pr.Number)
+		config.skip(*pr.Number, fmt.Sprintf("error validating LGTM: %v", err))
+		return nil, nil, false
+	} else if !ok {
+		glog.Errorf("PR pushed after LGTM, attempting to remove LGTM and skipping")
+		staleLGTMBody := "LGTM was before last commit, removing LGTM"
+		if err := WriteComment(client, user, project, *pr.Number, staleLGTMBody, "stale LGTM", false); err != nil {
+			glog.Warningf("Failed to create remove label comment: %v", err)
 		}
-		if pr.Mergeable == nil {
-			glog.Errorf("No mergeability information for %s %d, Skipping.", *pr.Title, *pr.Number)
-			continue
-		}
-		if !*pr.Mergeable {
-			continue
+		if err := RemoveLabel(client, user, project, *pr.Number, "lgtm", "stale LGTM", false); err != nil {
+			glog.Warningf("Failed to remove 'lgtm' label for stale lgtm on %d", *pr.Number)
 		}
+		config.skip(*pr.Number, "pushed after LGTM")
+		return nil, nil, false
+	}
 
-		// Validate the status information for this PR
-		ok, err := ValidateStatus(client, user, project, *pr.Number, config.RequiredStatusContexts, false)
+	// This is annoying, github appears to only temporarily cache mergeability, if it is nil, wait
+	// for an async refresh and retry.
+	if pr, err = waitForMergeable(ctx, client, user, project, pr, config); err != nil {
+		glog.Errorf("No mergeability information for %s %d, Skipping: %v", *pr.Title, *pr.Number, err)
+		config.skip(*pr.Number, "no mergeability information")
+		return nil, nil, false
+	}
+	if !*pr.Mergeable {
+		config.skip(*pr.Number, "not mergeable")
+		return nil, nil, false
+	}
+
+	// Validate the status information for this PR
+	ok, err := ValidateStatus(ctx, client, user, project, *pr.Number, config.statusOptions(pr), false)
+	if err != nil {
+		glog.Errorf("Error validating PR status: %v", err)
+		config.skip(*pr.Number, fmt.Sprintf("error validating status: %v", err))
+		return nil, nil, false
+	}
+	if !ok {
+		config.skip(*pr.Number, "status is not 'success'")
+		return nil, nil, false
+	}
+	return pr, issue, true
+}
+
+// StatusOptions controls how the status of a PR is computed.
+type StatusOptions struct {
+	// Required are the status contexts which must be present for the PR to be complete.
+	Required []string
+	// Optional are status contexts whose failure is logged but doesn't fail the PR.
+	Optional []string
+	// AllCommits evaluates every commit in the PR rather than only its head commit.
+	AllCommits bool
+}
+
+// getCommitStatus returns the combined status of the head commit of a PR, or of every
+// commit in the PR if allCommits is set.
+func getCommitStatus(client *github.Client, user, project string, prNumber int, allCommits bool) ([]*github.CombinedStatus, error) {
+	shas := []string{}
+	if allCommits {
+		commits, _, err := client.PullRequests.ListCommits(user, project, prNumber, &github.ListOptions{})
 		if err != nil {
-			glog.Errorf("Error validating PR status: %v", err)
-			continue
+			return nil, err
 		}
-		if !ok {
-			continue
+		for ix := range commits {
+			shas = append(shas, *commits[ix].SHA)
 		}
-		if err := fn(client, pr, issue); err != nil {
-			glog.Errorf("Failed to run user function: %v", err)
-			continue
+	} else {
+		pr, _, err := client.PullRequests.Get(user, project, prNumber)
+		if err != nil {
+			return nil, err
 		}
-		if once {
-			break
+		if pr.Head == nil || pr.Head.SHA == nil {
+			return nil, fmt.Errorf("PR %d has no head commit", prNumber)
 		}
+		shas = append(shas, *pr.Head.SHA)
 	}
-	return nil
+	commitStatus := make([]*github.CombinedStatus, len(shas))
+	for ix, sha := range shas {
+		statusList, _, err := client.Repositories.GetCombinedStatus(user, project, sha, &github.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		commitStatus[ix] = statusList
+	}
+	return commitStatus, nil
 }
 
-func getCommitStatus(client *github.Client, user, project string, prNumber int) ([]*github.CombinedStatus, error) {
-	commits, _, err := client.PullRequests.ListCommits(user, project, prNumber, &github.ListOptions{})
+// FailedStatuses returns the statuses of a commit which are 'failure' or 'error'.
+func FailedStatuses(client *github.Client, user, project, sha string) ([]github.RepoStatus, error) {
+	combined, _, err := client.Repositories.GetCombinedStatus(user, project, sha, &github.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
-	commitStatus := make([]*github.CombinedStatus, len(commits))
-	for ix := range commits {
-		commit := &commits[ix]
-		statusList, _, err := client.Repositories.GetCombinedStatus(user, project, *commit.SHA, &github.ListOptions{})
-		if err != nil {
-			return nil, err
+	failed := []github.RepoStatus{}
+	for _, status := range combined.Statuses {
+		if status.State != nil && (*status.State == "failure" || *status.State == "error") {
+			failed = append(failed, status)
 		}
-		commitStatus[ix] = statusList
 	}
-	return commitStatus, nil
+	return failed, nil
 }
 
-// Gets the current status of a PR by introspecting the status of the commits in the PR.
-// The rules are:
-//    * If any member of the 'requiredContexts' list is missing, it is 'incomplete'
+// Gets the current status of a PR by introspecting the status of its head commit, or of
+// every commit in the PR if opts.AllCommits is set. A nil opts checks the head commit
+// with no required contexts. The rules are:
+//    * If any member of the 'opts.Required' list is missing, it is 'incomplete'
 //    * If any commit is 'pending', the PR is 'pending'
 //    * If any commit is 'error', the PR is in 'error'
 //    * If any commit is 'failure', the PR is 'failure'
 //    * Otherwise the PR is 'success'
-func GetStatus(client *github.Client, user, project string, prNumber int, requiredContexts []string) (string, error) {
-	statusList, err := getCommitStatus(client, user, project, prNumber)
+// Contexts in 'opts.Optional' which aren't 'success' are logged and otherwise ignored.
+func GetStatus(client *github.Client, user, project string, prNumber int, opts *StatusOptions) (string, error) {
+	if opts == nil {
+		opts = &StatusOptions{}
+	}
+	statusList, err := getCommitStatus(client, user, project, prNumber, opts.AllCommits)
 	if err != nil {
 		return "", err
 	}
-	return computeStatus(statusList, requiredContexts), nil
+	return computeStatus(statusList, opts.Required, opts.Optional), nil
 }
 
-func computeStatus(statusList []*github.CombinedStatus, requiredContexts []string) string {
+func computeStatus(statusList []*github.CombinedStatus, requiredContexts, optionalContexts []string) string {
 	states := util.StringSet{}
 	providers := util.StringSet{}
+	optional := util.NewStringSet(optionalContexts...)
 	for ix := range statusList {
 		status := statusList[ix]
 		glog.V(8).Infof("Checking commit: %s", *status.SHA)
 		glog.V(8).Infof("Checking commit: %v", status)
-		states.Insert(*status.State)
-
+		state := *status.State
+		ignored := false
 		for _, subStatus := range status.Statuses {
 			glog.V(8).Infof("Found status from: %v", subStatus)
 			providers.Insert(*subStatus.Context)
+			if optional.Has(*subStatus.Context) && subStatus.State != nil && *subStatus.State != "success" {
+				glog.Warningf("Optional context %s is %s on commit %s", *subStatus.Context, *subStatus.State, *status.SHA)
+				ignored = true
+			}
 		}
+		if ignored {
+			state = stateWithout(status.Statuses, optional)
+		}
+		states.Insert(state)
 	}
 	for _, provider := range requiredContexts {
 		if !providers.Has(provider) {
@@ -291,12 +506,34 @@ func computeStatus(statusList []*github.CombinedStatus, requiredContexts []strin
 	}
 }
 
-// Make sure that the combined status for all commits in a PR is 'success'
+// stateWithout combines statuses the way github does, except that contexts in ignore
+// are left out.
+func stateWithout(statuses []github.RepoStatus, ignore util.StringSet) string {
+	states := util.StringSet{}
+	for _, status := range statuses {
+		if status.State != nil && !ignore.Has(*status.Context) {
+			states.Insert(*status.State)
+		}
+	}
+	switch {
+	case states.Has("pending"):
+		return "pending"
+	case states.Has("error"):
+		return "error"
+	case states.Has("failure"):
+		return "failure"
+	default:
+		return "success"
+	}
+}
+
+// Make sure that the status of a PR, as computed by GetStatus, is 'success'
 // if 'waitForPending' is true, this function will wait until the PR is no longer pending (all checks have run)
-func ValidateStatus(client *github.Client, user, project string, prNumber int, requiredContexts []string, waitOnPending bool) (bool, error) {
+// or ctx is done, in which case ctx.Err() is returned.
+func ValidateStatus(ctx context.Context, client *github.Client, user, project string, prNumber int, opts *StatusOptions, waitOnPending bool) (bool, error) {
 	pending := true
 	for pending {
-		status, err := GetStatus(client, user, project, prNumber, requiredContexts)
+		status, err := GetStatus(client, user, project, prNumber, opts)
 		if err != nil {
 			return false, err
 		}
@@ -308,8 +545,10 @@ func ValidateStatus(client *github.Client, user, project string, prNumber int, r
 				return false, nil
 			}
 			pending = true
-			glog.V(4).Info("PR is pending, waiting for 30 seconds")
-			time.Sleep(30 * time.Second)
+			glog.V(4).Infof("PR is pending, waiting for %v", pollInterval)
+			if err := sleep(ctx, pollInterval); err != nil {
+				return false, err
+			}
 		case "success":
 			return true, nil
 		case "incomplete":
@@ -323,17 +562,19 @@ func ValidateStatus(client *github.Client, user, project string, prNumber int, r
 
 // Wait for a PR to move into Pending.  This is useful because the request to test a PR again
 // is asynchronous with the PR actually moving into a pending state
-// TODO: add a timeout
-func WaitForPending(client *github.Client, user, project string, prNumber int) error {
+// Returns ctx.Err() if ctx is done before the PR goes pending.
+func WaitForPending(ctx context.Context, client *github.Client, user, project string, prNumber int) error {
 	for {
-		status, err := GetStatus(client, user, project, prNumber, []string{})
+		status, err := GetStatus(client, user, project, prNumber, nil)
 		if err != nil {
 			return err
 		}
 		if status == "pending" {
 			return nil
 		}
-		glog.V(4).Info("PR is not pending, waiting for 30 seconds")
-		time.Sleep(30 * time.Second)
+		glog.V(4).Infof("PR is not pending, waiting for %v", pollInterval)
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
 	}
 }
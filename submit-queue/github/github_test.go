@@ -21,17 +21,23 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"net/url"
+	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	github_test "k8s.io/contrib/submit-queue/github/testing"
+
 	"github.com/google/go-github/github"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/context"
 )
 
 func stringPtr(val string) *string     { return &val }
 func timePtr(val time.Time) *time.Time { return &val }
 func intPtr(val int) *int              { return &val }
+func boolPtr(val bool) *bool           { return &val }
 
 func TestHasLabel(t *testing.T) {
 	tests := []struct {
@@ -131,17 +137,7 @@ func TestHasLabels(t *testing.T) {
 }
 
 func initTest() (*github.Client, *httptest.Server, *http.ServeMux) {
-	// test server
-	mux := http.NewServeMux()
-	server := httptest.NewServer(mux)
-
-	// github client configured to use test server
-	client := github.NewClient(nil)
-	url, _ := url.Parse(server.URL)
-	client.BaseURL = url
-	client.UploadURL = url
-
-	return client, server, mux
+	return github_test.InitTest()
 }
 
 func TestFetchAllPRs(t *testing.T) {
@@ -385,13 +381,111 @@ func TestComputeStatus(t *testing.T) {
 		if test.requiredContexts == nil {
 			test.requiredContexts = []string{}
 		}
-		status := computeStatus(test.statusList, test.requiredContexts)
+		status := computeStatus(test.statusList, test.requiredContexts, nil)
 		if test.expected != status {
 			t.Errorf("expected: %s, saw %s", test.expected, status)
 		}
 	}
 }
 
+func TestComputeStatusOptional(t *testing.T) {
+	status := func(state string, contexts ...string) *github.CombinedStatus {
+		combined := &github.CombinedStatus{State: stringPtr(state), SHA: stringPtr("abcdef")}
+		for i := 0; i < len(contexts); i += 2 {
+			combined.Statuses = append(combined.Statuses, github.RepoStatus{Context: stringPtr(contexts[i]), State: stringPtr(contexts[i+1])})
+		}
+		return combined
+	}
+	tests := []struct {
+		status   *github.CombinedStatus
+		optional []string
+		expected string
+	}{
+		{status: status("failure", "e2e", "success", "lint", "failure"), expected: "failure"},
+		{status: status("failure", "e2e", "success", "lint", "failure"), optional: []string{"lint"}, expected: "success"},
+		{status: status("pending", "e2e", "success", "lint", "pending"), optional: []string{"lint"}, expected: "success"},
+		{status: status("failure", "e2e", "failure", "lint", "failure"), optional: []string{"lint"}, expected: "failure"},
+		{status: status("pending", "e2e", "pending", "lint", "error"), optional: []string{"lint"}, expected: "pending"},
+	}
+	for i, test := range tests {
+		result := computeStatus([]*github.CombinedStatus{test.status}, []string{"e2e", "lint"}, test.optional)
+		if result != test.expected {
+			t.Errorf("case %d: expected %s, saw %s", i, test.expected, result)
+		}
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	client, server, mux := initTest()
+	defer server.Close()
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(github.PullRequest{Number: intPtr(1), Head: &github.PullRequestBranch{SHA: stringPtr("new")}})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		w.Write(data)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/commits", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal([]github.RepositoryCommit{{SHA: stringPtr("old")}, {SHA: stringPtr("new")}})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		w.Write(data)
+	})
+	for sha, state := range map[string]string{"old": "failure", "new": "success"} {
+		combined := github.CombinedStatus{State: stringPtr(state), SHA: stringPtr(sha)}
+		mux.HandleFunc("/repos/o/r/commits/"+sha+"/status", func(w http.ResponseWriter, r *http.Request) {
+			data, err := json.Marshal(combined)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			w.Write(data)
+		})
+	}
+
+	tests := []struct {
+		opts     *StatusOptions
+		expected string
+	}{
+		{opts: nil, expected: "success"},
+		{opts: &StatusOptions{}, expected: "success"},
+		{opts: &StatusOptions{AllCommits: true}, expected: "failure"},
+	}
+	for _, test := range tests {
+		status, err := GetStatus(client, "o", "r", 1, test.opts)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if status != test.expected {
+			t.Errorf("%+v: expected %s, saw %s", test.opts, test.expected, status)
+		}
+	}
+}
+
+func TestStatusOptions(t *testing.T) {
+	config := &FilterConfig{
+		RequiredStatusContexts: []string{"cla", "e2e"},
+		BranchContexts:         map[string][]string{"release-1.1": {"cla", "e2e-release"}},
+		OptionalContexts:       []string{"lint"},
+	}
+	tests := []struct {
+		branch   string
+		expected []string
+	}{
+		{branch: "master", expected: []string{"cla", "e2e"}},
+		{branch: "release-1.1", expected: []string{"cla", "e2e-release"}},
+	}
+	for _, test := range tests {
+		opts := config.statusOptions(&github.PullRequest{Base: &github.PullRequestBranch{Ref: stringPtr(test.branch)}})
+		if !reflect.DeepEqual(opts.Required, test.expected) {
+			t.Errorf("%s: expected %v, saw %v", test.branch, test.expected, opts.Required)
+		}
+		if !reflect.DeepEqual(opts.Optional, config.OptionalContexts) || opts.AllCommits {
+			t.Errorf("%s: unexpected options: %+v", test.branch, opts)
+		}
+	}
+}
+
 func TestValidateLGTMAfterPush(t *testing.T) {
 	tests := []struct {
 		issueEvents  []github.IssueEvent
@@ -622,3 +716,223 @@ func TestGetLastModified(t *testing.T) {
 		server.Close()
 	}
 }
+
+// serveStatus makes PR 1 in o/r a single commit whose combined status is state.
+func serveStatus(t *testing.T, mux *http.ServeMux, state string) {
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(github.PullRequest{Number: intPtr(1), Head: &github.PullRequestBranch{SHA: stringPtr("abcdef")}})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		w.Write(data)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/commits", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal([]github.RepositoryCommit{{SHA: stringPtr("abcdef")}})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		w.Write(data)
+	})
+	mux.HandleFunc("/repos/o/r/commits/abcdef/status", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(github.CombinedStatus{State: stringPtr(state), SHA: stringPtr("abcdef")})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		w.Write(data)
+	})
+}
+
+func TestWaitTimeouts(t *testing.T) {
+	pollInterval = time.Millisecond
+	defer func() { pollInterval = 30 * time.Second }()
+
+	tests := []struct {
+		state       string
+		pendingErr  error
+		validateErr error
+		validated   bool
+	}{
+		{state: "pending", pendingErr: nil, validateErr: context.DeadlineExceeded},
+		{state: "success", pendingErr: context.DeadlineExceeded, validated: true},
+		{state: "failure", pendingErr: context.DeadlineExceeded, validated: false},
+	}
+	for _, test := range tests {
+		client, server, mux := initTest()
+		serveStatus(t, mux, test.state)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if err := WaitForPending(ctx, client, "o", "r", 1); err != test.pendingErr {
+			t.Errorf("%s: expected %v from WaitForPending, saw %v", test.state, test.pendingErr, err)
+		}
+		cancel()
+
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		ok, err := ValidateStatus(ctx, client, "o", "r", 1, nil, true)
+		if err != test.validateErr {
+			t.Errorf("%s: expected %v from ValidateStatus, saw %v", test.state, test.validateErr, err)
+		}
+		if ok != test.validated {
+			t.Errorf("%s: expected %v from ValidateStatus, saw %v", test.state, test.validated, ok)
+		}
+		cancel()
+		server.Close()
+	}
+}
+
+func TestWaitForMergeable(t *testing.T) {
+	tests := []struct {
+		mergeable *bool
+		expectErr bool
+	}{
+		{mergeable: boolPtr(true)},
+		{mergeable: boolPtr(false)},
+		{mergeable: nil, expectErr: true},
+	}
+	for _, test := range tests {
+		client, server, mux := initTest()
+		mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+			data, err := json.Marshal(github.PullRequest{Number: intPtr(1), Title: stringPtr("t"), Mergeable: test.mergeable})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			w.Write(data)
+		})
+		pr := &github.PullRequest{Number: intPtr(1), Title: stringPtr("t")}
+		config := &FilterConfig{MergeabilityTimeout: 50 * time.Millisecond}
+		pr, err := waitForMergeable(context.Background(), client, "o", "r", pr, config)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("expected error")
+			}
+		} else if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		} else if *pr.Mergeable != *test.mergeable {
+			t.Errorf("expected: %v, saw: %v", *test.mergeable, *pr.Mergeable)
+		}
+		server.Close()
+	}
+}
+
+func TestForEachCandidatePRDo(t *testing.T) {
+	gauge := func() float64 {
+		m := &dto.Metric{}
+		if err := queueLength.Write(m); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		return m.GetGauge().GetValue()
+	}
+	tests := []struct {
+		name string
+		once bool
+		// dropLGTM removes the lgtm label of PR 2 while PR 1 is processed.
+		dropLGTM bool
+		expected []int
+		// length is the queue length once the pass is done
+		length float64
+	}{
+		{name: "all", expected: []int{1, 2}, length: 2},
+		{name: "once", once: true, expected: []int{1}, length: 1},
+		{name: "changed", dropLGTM: true, expected: []int{1}, length: 1},
+	}
+	for _, test := range tests {
+		client, server, mux := initTest()
+		var lock sync.Mutex
+		lgtm := map[int]bool{1: true, 2: true}
+		mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+			data, err := json.Marshal([]github.PullRequest{
+				{Number: intPtr(1), User: &github.User{Login: stringPtr("u")}},
+				{Number: intPtr(2), User: &github.User{Login: stringPtr("u")}},
+			})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			w.Write(data)
+		})
+		for _, n := range []int{1, 2} {
+			n := n
+			sha := fmt.Sprintf("sha%d", n)
+			mux.HandleFunc(fmt.Sprintf("/repos/o/r/pulls/%d", n), func(w http.ResponseWriter, r *http.Request) {
+				data, err := json.Marshal(github.PullRequest{
+					Number:    intPtr(n),
+					Title:     stringPtr("t"),
+					User:      &github.User{Login: stringPtr("u")},
+					Head:      &github.PullRequestBranch{SHA: stringPtr(sha)},
+					Mergeable: boolPtr(true),
+				})
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				w.Write(data)
+			})
+			mux.HandleFunc(fmt.Sprintf("/repos/o/r/issues/%d", n), func(w http.ResponseWriter, r *http.Request) {
+				labels := []github.Label{{Name: stringPtr("cla: yes")}}
+				lock.Lock()
+				if lgtm[n] {
+					labels = append(labels, github.Label{Name: stringPtr("lgtm")})
+				}
+				lock.Unlock()
+				data, err := json.Marshal(github.Issue{Number: intPtr(n), Labels: labels})
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				w.Write(data)
+			})
+			mux.HandleFunc(fmt.Sprintf("/repos/o/r/pulls/%d/commits", n), func(w http.ResponseWriter, r *http.Request) {
+				data, err := json.Marshal([]github.RepositoryCommit{{
+					SHA:    stringPtr(sha),
+					Commit: &github.Commit{Committer: &github.CommitAuthor{Date: timePtr(time.Unix(10, 0))}},
+				}})
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				w.Write(data)
+			})
+			mux.HandleFunc(fmt.Sprintf("/repos/o/r/issues/%d/events", n), func(w http.ResponseWriter, r *http.Request) {
+				data, err := json.Marshal([]github.IssueEvent{{
+					Event:     stringPtr("labeled"),
+					Label:     &github.Label{Name: stringPtr("lgtm")},
+					CreatedAt: timePtr(time.Unix(11, 0)),
+				}})
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				w.Write(data)
+			})
+			mux.HandleFunc(fmt.Sprintf("/repos/o/r/commits/%s/status", sha), func(w http.ResponseWriter, r *http.Request) {
+				data, err := json.Marshal(github.CombinedStatus{State: stringPtr("success"), SHA: stringPtr(sha)})
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				w.Write(data)
+			})
+		}
+
+		seen := []int{}
+		fn := func(ctx context.Context, client *github.Client, pr *github.PullRequest, issue *github.Issue) error {
+			// the gauge counts the candidates found so far
+			if length := gauge(); length != float64(len(seen)+1) {
+				t.Errorf("%s: expected a queue length of %d while processing PR %d, saw %v", test.name, len(seen)+1, *pr.Number, length)
+			}
+			seen = append(seen, *pr.Number)
+			if test.dropLGTM {
+				lock.Lock()
+				lgtm[2] = false
+				lock.Unlock()
+			}
+			return nil
+		}
+		config := &FilterConfig{UserWhitelist: []string{"u"}}
+		lastQueueLength = 0
+		queueLength.Set(0)
+		if err := ForEachCandidatePRDo(context.Background(), client, "o", "r", fn, test.once, config); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(seen, test.expected) {
+			t.Errorf("%s: expected %v, saw %v", test.name, test.expected, seen)
+		}
+		if length := gauge(); length != test.length {
+			t.Errorf("%s: expected a queue length of %v, saw %v", test.name, test.length, length)
+		}
+		server.Close()
+	}
+}
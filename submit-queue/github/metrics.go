@@ -0,0 +1,76 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queueLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "submitqueue_queue_length",
+		Help: "Number of PRs which passed every check of the submit queue on its last pass, or so far on the current pass if that is more.",
+	})
+	// lastQueueLength is the number of candidates found by the last pass.
+	lastQueueLength int
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "submitqueue_github_api_errors_total",
+		Help: "Number of github API requests which failed, by HTTP status code or 'transport'.",
+	}, []string{"code"})
+)
+
+func init() {
+	prometheus.MustRegister(queueLength)
+	prometheus.MustRegister(apiErrors)
+}
+
+// instrumentedTransport counts github API requests which fail. A missing file is expected
+// when looking for OWNERS files, so a 404 from the contents API isn't counted.
+type instrumentedTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	switch {
+	case err != nil:
+		apiErrors.WithLabelValues("transport").Inc()
+	case resp.StatusCode == http.StatusNotFound && strings.Contains(req.URL.Path, "/contents/"):
+	case resp.StatusCode >= 400:
+		apiErrors.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	return resp, err
+}
+
+// instrument wraps the transport of client, or http.DefaultTransport if it has none,
+// to count failed requests. It returns a new client.
+func instrument(client *http.Client) *http.Client {
+	transport := http.DefaultTransport
+	if client != nil && client.Transport != nil {
+		transport = client.Transport
+	}
+	result := &http.Client{}
+	if client != nil {
+		*result = *client
+	}
+	result.Transport = &instrumentedTransport{transport: transport}
+	return result
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/util"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+)
+
+const (
+	ownersFile      = "OWNERS"
+	approveCommand  = "/approve"
+	approvalSummary = "This PR needs approval from an owner of each of the following OWNERS files (comment `/approve`):"
+)
+
+// fetchAllFiles returns the names of all the files changed by a PR.
+func fetchAllFiles(client *github.Client, user, project string, prNumber int) ([]string, error) {
+	page := 1
+	var result []string
+	for {
+		files, response, err := client.PullRequests.ListFiles(user, project, prNumber, &github.ListOptions{PerPage: 100, Page: page})
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.Filename != nil {
+				result = append(result, *file.Filename)
+			}
+		}
+		if response.LastPage == 0 || response.LastPage == page {
+			break
+		}
+		page++
+	}
+	return result, nil
+}
+
+// fetchAllComments returns all the comments on a PR.
+func fetchAllComments(client *github.Client, user, project string, prNumber int) ([]github.IssueComment, error) {
+	page := 1
+	var result []github.IssueComment
+	for {
+		opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100, Page: page}}
+		comments, response, err := client.Issues.ListComments(user, project, prNumber, opts)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, comments...)
+		if response.LastPage == 0 || response.LastPage == page {
+			break
+		}
+		page++
+	}
+	return result, nil
+}
+
+// fetchAllEvents returns all the events of a PR.
+func fetchAllEvents(client *github.Client, user, project string, prNumber int) ([]github.IssueEvent, error) {
+	page := 1
+	var result []github.IssueEvent
+	for {
+		events, response, err := client.Issues.ListIssueEvents(user, project, prNumber, &github.ListOptions{PerPage: 100, Page: page})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, events...)
+		if response.LastPage == 0 || response.LastPage == page {
+			break
+		}
+		page++
+	}
+	return result, nil
+}
+
+// parseOwners reads the github logins out of an OWNERS file. The file holds one login
+// per line, '#' starts a comment. Lines may also be YAML list items ("- login"), and
+// YAML keys ("assignees:") are ignored.
+func parseOwners(data string) []string {
+	owners := []string{}
+	for _, line := range strings.Split(data, "\n") {
+		if ix := strings.Index(line, "#"); ix >= 0 {
+			line = line[:ix]
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-"))
+		if len(line) == 0 || strings.HasSuffix(line, ":") {
+			continue
+		}
+		owners = append(owners, line)
+	}
+	return owners
+}
+
+// ownersResolver finds the OWNERS file governing a path at a given ref, caching
+// what it has fetched.
+type ownersResolver struct {
+	client  *github.Client
+	user    string
+	project string
+	ref     string
+	// owners maps a directory to the owners listed in its OWNERS file, or nil if it has none.
+	owners map[string][]string
+}
+
+func newOwnersResolver(client *github.Client, user, project, ref string) *ownersResolver {
+	return &ownersResolver{client: client, user: user, project: project, ref: ref, owners: map[string][]string{}}
+}
+
+// ownersOf returns the owners listed in the OWNERS file of dir, or nil if there is none.
+func (o *ownersResolver) ownersOf(dir string) ([]string, error) {
+	if owners, found := o.owners[dir]; found {
+		return owners, nil
+	}
+	file, _, resp, err := o.client.Repositories.GetContents(o.user, o.project, path.Join(dir, ownersFile), &github.RepositoryContentGetOptions{Ref: o.ref})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			o.owners[dir] = nil
+			return nil, nil
+		}
+		return nil, err
+	}
+	if file == nil {
+		o.owners[dir] = nil
+		return nil, nil
+	}
+	data, err := file.Decode()
+	if err != nil {
+		return nil, err
+	}
+	owners := parseOwners(string(data))
+	o.owners[dir] = owners
+	return owners, nil
+}
+
+// nearest returns the directory holding the OWNERS file closest to file and its owners.
+// If no directory up to the root has an OWNERS file, it returns an error.
+func (o *ownersResolver) nearest(file string) (string, []string, error) {
+	dir := path.Dir(file)
+	for {
+		if dir == "." || dir == "/" {
+			dir = ""
+		}
+		owners, err := o.ownersOf(dir)
+		if err != nil {
+			return "", nil, err
+		}
+		if owners != nil {
+			return dir, owners, nil
+		}
+		if dir == "" {
+			return "", nil, fmt.Errorf("no %s file covers %s", ownersFile, file)
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// approvers returns the logins which approved the PR, either by commenting "/approve"
+// on a line of its own or by applying approvalLabel. Approvals given before since, the
+// last push to the PR, do not count.
+func approvers(client *github.Client, user, project string, prNumber int, comments []github.IssueComment, approvalLabel string, since *time.Time) (util.StringSet, error) {
+	stale := func(created *time.Time) bool {
+		return since != nil && (created == nil || created.Before(*since))
+	}
+	result := util.StringSet{}
+	for _, comment := range comments {
+		if comment.User == nil || comment.User.Login == nil || comment.Body == nil || stale(comment.CreatedAt) {
+			continue
+		}
+		for _, line := range strings.Split(*comment.Body, "\n") {
+			if strings.TrimSpace(line) == approveCommand {
+				result.Insert(*comment.User.Login)
+			}
+		}
+	}
+	if len(approvalLabel) == 0 {
+		return result, nil
+	}
+	events, err := fetchAllEvents(client, user, project, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	// removing the label withdraws the approvals of everyone who applied it
+	labelers := util.StringSet{}
+	for _, event := range events {
+		if event.Event == nil || event.Label == nil || event.Label.Name == nil || *event.Label.Name != approvalLabel {
+			continue
+		}
+		switch *event.Event {
+		case "unlabeled":
+			labelers = util.StringSet{}
+		case "labeled":
+			if !stale(event.CreatedAt) && event.Actor != nil && event.Actor.Login != nil {
+				labelers.Insert(*event.Actor.Login)
+			}
+		}
+	}
+	result.Insert(labelers.List()...)
+	return result, nil
+}
+
+// missingApprovals maps each OWNERS directory which lacks an approval to its owners.
+type missingApprovals map[string][]string
+
+// summary describes the missing approvals, for posting on the PR.
+func (m missingApprovals) summary() string {
+	dirs := []string{}
+	for dir := range m {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	lines := []string{approvalSummary, ""}
+	for _, dir := range dirs {
+		owners := []string{}
+		for _, owner := range m[dir] {
+			owners = append(owners, "@"+owner)
+		}
+		lines = append(lines, fmt.Sprintf("- `%s`: %s", path.Join(dir, ownersFile), strings.Join(owners, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkOwnersApproval returns the OWNERS files which cover files in the PR but which
+// have no approval from one of their owners. An empty result means the PR is approved.
+func checkOwnersApproval(client *github.Client, user, project string, pr *github.PullRequest, comments []github.IssueComment, approvalLabel string) (missingApprovals, error) {
+	ref := ""
+	if pr.Base != nil && pr.Base.Ref != nil {
+		ref = *pr.Base.Ref
+	}
+	files, err := fetchAllFiles(client, user, project, *pr.Number)
+	if err != nil {
+		return nil, err
+	}
+	lastModified, err := lastModifiedTime(client, user, project, pr)
+	if err != nil {
+		return nil, err
+	}
+	approved, err := approvers(client, user, project, *pr.Number, comments, approvalLabel, lastModified)
+	if err != nil {
+		return nil, err
+	}
+	resolver := newOwnersResolver(client, user, project, ref)
+	missing := missingApprovals{}
+	for _, file := range files {
+		dir, owners, err := resolver.nearest(file)
+		if err != nil {
+			return nil, err
+		}
+		if !approved.HasAny(owners...) {
+			missing[dir] = owners
+		}
+	}
+	return missing, nil
+}
+
+// ValidateOwnersApproval returns true if every file in the PR is approved by an owner.
+// Otherwise it comments on the PR listing the OWNERS files which still need approval,
+// unless an identical comment is already there or dryRun is set.
+func ValidateOwnersApproval(client *github.Client, user, project string, pr *github.PullRequest, approvalLabel string, dryRun bool) (bool, error) {
+	comments, err := fetchAllComments(client, user, project, *pr.Number)
+	if err != nil {
+		return false, err
+	}
+	missing, err := checkOwnersApproval(client, user, project, pr, comments, approvalLabel)
+	if err != nil {
+		return false, err
+	}
+	if len(missing) == 0 {
+		return true, nil
+	}
+	summary := missing.summary()
+	glog.V(4).Infof("PR %d is missing approvals: %v", *pr.Number, missing)
+	for _, comment := range comments {
+		if comment.Body != nil && *comment.Body == summary {
+			return false, nil
+		}
+	}
+	return false, WriteComment(client, user, project, *pr.Number, summary, "missing OWNERS approval", dryRun)
+}
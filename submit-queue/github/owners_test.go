@@ -0,0 +1,216 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestParseOwners(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected []string
+	}{
+		{"alice\nbob\n", []string{"alice", "bob"}},
+		{"# owners\nalice # lead\n\n  bob  \n", []string{"alice", "bob"}},
+		{"assignees:\n  - alice\n  - bob\n", []string{"alice", "bob"}},
+		{"", []string{}},
+	}
+	for _, test := range tests {
+		if owners := parseOwners(test.data); !reflect.DeepEqual(owners, test.expected) {
+			t.Errorf("%q: expected %v, saw %v", test.data, test.expected, owners)
+		}
+	}
+}
+
+func TestCheckOwnersApproval(t *testing.T) {
+	ownersFiles := map[string]string{
+		"OWNERS":          "root\n",
+		"pkg/OWNERS":      "alice\nbob\n",
+		"pkg/util/OWNERS": "carol\n",
+	}
+	tests := []struct {
+		files    []string
+		comments []github.IssueComment
+		events   []github.IssueEvent
+		// pushed is the time of the last push, if any
+		pushed  *time.Time
+		missing missingApprovals
+	}{
+		{
+			files:   []string{"README.md"},
+			missing: missingApprovals{"": {"root"}},
+		},
+		{
+			files: []string{"pkg/api/types.go", "pkg/util/set.go"},
+			comments: []github.IssueComment{
+				{User: &github.User{Login: stringPtr("bob")}, Body: stringPtr("looks good\n/approve\n")},
+			},
+			missing: missingApprovals{"pkg/util": {"carol"}},
+		},
+		{
+			files: []string{"pkg/api/types.go", "pkg/util/set.go"},
+			comments: []github.IssueComment{
+				{User: &github.User{Login: stringPtr("alice")}, Body: stringPtr("/approve")},
+				{User: &github.User{Login: stringPtr("carol")}, Body: stringPtr("/approve")},
+			},
+			missing: missingApprovals{},
+		},
+		{
+			files: []string{"pkg/util/set.go"},
+			comments: []github.IssueComment{
+				{User: &github.User{Login: stringPtr("carol")}, Body: stringPtr("I won't /approve this")},
+			},
+			events: []github.IssueEvent{
+				{Event: stringPtr("labeled"), Label: &github.Label{Name: stringPtr("approved")}, Actor: &github.User{Login: stringPtr("alice")}},
+			},
+			missing: missingApprovals{"pkg/util": {"carol"}},
+		},
+		{
+			files: []string{"pkg/util/set.go"},
+			events: []github.IssueEvent{
+				{Event: stringPtr("labeled"), Label: &github.Label{Name: stringPtr("approved")}, Actor: &github.User{Login: stringPtr("carol")}},
+			},
+			missing: missingApprovals{},
+		},
+		{
+			files: []string{"pkg/util/set.go"},
+			events: []github.IssueEvent{
+				{Event: stringPtr("labeled"), Label: &github.Label{Name: stringPtr("lgtm")}, Actor: &github.User{Login: stringPtr("alice")}},
+				{Event: stringPtr("labeled"), Label: &github.Label{Name: stringPtr("lgtm")}, Actor: &github.User{Login: stringPtr("bob")}},
+				{Event: stringPtr("labeled"), Label: &github.Label{Name: stringPtr("approved")}, Actor: &github.User{Login: stringPtr("carol")}},
+			},
+			missing: missingApprovals{},
+		},
+		{
+			files: []string{"pkg/api/types.go", "pkg/util/set.go"},
+			comments: []github.IssueComment{
+				{User: &github.User{Login: stringPtr("alice")}, Body: stringPtr("/approve"), CreatedAt: timePtr(time.Unix(100, 0))},
+				{User: &github.User{Login: stringPtr("carol")}, Body: stringPtr("/approve"), CreatedAt: timePtr(time.Unix(300, 0))},
+			},
+			events: []github.IssueEvent{
+				{Event: stringPtr("labeled"), Label: &github.Label{Name: stringPtr("approved")}, Actor: &github.User{Login: stringPtr("bob")}, CreatedAt: timePtr(time.Unix(150, 0))},
+			},
+			pushed:  timePtr(time.Unix(200, 0)),
+			missing: missingApprovals{"pkg": {"alice", "bob"}},
+		},
+		{
+			files: []string{"pkg/util/set.go"},
+			events: []github.IssueEvent{
+				{Event: stringPtr("labeled"), Label: &github.Label{Name: stringPtr("approved")}, Actor: &github.User{Login: stringPtr("carol")}},
+				{Event: stringPtr("unlabeled"), Label: &github.Label{Name: stringPtr("approved")}, Actor: &github.User{Login: stringPtr("bob")}},
+			},
+			missing: missingApprovals{"pkg/util": {"carol"}},
+		},
+		{
+			files: []string{"pkg/util/set.go"},
+			events: []github.IssueEvent{
+				{Event: stringPtr("labeled"), Label: &github.Label{Name: stringPtr("approved")}, Actor: &github.User{Login: stringPtr("alice")}},
+				{Event: stringPtr("unlabeled"), Label: &github.Label{Name: stringPtr("approved")}, Actor: &github.User{Login: stringPtr("alice")}},
+				{Event: stringPtr("labeled"), Label: &github.Label{Name: stringPtr("approved")}, Actor: &github.User{Login: stringPtr("carol")}},
+			},
+			missing: missingApprovals{},
+		},
+	}
+	for i, test := range tests {
+		client, server, mux := initTest()
+		mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+			files := []github.CommitFile{}
+			for _, file := range test.files {
+				files = append(files, github.CommitFile{Filename: stringPtr(file)})
+			}
+			data, err := json.Marshal(files)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			w.Write(data)
+		})
+		// events are served one per page
+		mux.HandleFunc("/repos/o/r/issues/1/events", func(w http.ResponseWriter, r *http.Request) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			events := []github.IssueEvent{}
+			if page >= 1 && page <= len(test.events) {
+				events = test.events[page-1 : page]
+			}
+			if len(test.events) > 1 {
+				w.Header().Set("Link", fmt.Sprintf(`<%s/repos/o/r/issues/1/events?page=%d>; rel="last"`, server.URL, len(test.events)))
+			}
+			data, err := json.Marshal(events)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			w.Write(data)
+		})
+		mux.HandleFunc("/repos/o/r/pulls/1/commits", func(w http.ResponseWriter, r *http.Request) {
+			commits := []github.RepositoryCommit{}
+			if test.pushed != nil {
+				commits = append(commits, github.RepositoryCommit{Commit: &github.Commit{Committer: &github.CommitAuthor{Date: test.pushed}}})
+			}
+			data, err := json.Marshal(commits)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			w.Write(data)
+		})
+		mux.HandleFunc("/repos/o/r/contents/", func(w http.ResponseWriter, r *http.Request) {
+			if ref := r.URL.Query().Get("ref"); ref != "master" {
+				t.Errorf("Unexpected ref: %s", ref)
+			}
+			owners, found := ownersFiles[strings.TrimPrefix(r.URL.Path, "/repos/o/r/contents/")]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message": "Not Found"}`))
+				return
+			}
+			data, err := json.Marshal(github.RepositoryContent{
+				Encoding: stringPtr("base64"),
+				Content:  stringPtr(base64.StdEncoding.EncodeToString([]byte(owners))),
+			})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			w.Write(data)
+		})
+		pr := &github.PullRequest{Number: intPtr(1), Base: &github.PullRequestBranch{Ref: stringPtr("master")}}
+		missing, err := checkOwnersApproval(client, "o", "r", pr, test.comments, "approved")
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(missing, test.missing) {
+			t.Errorf("case %d: expected %v, saw %v", i, test.missing, missing)
+		}
+		server.Close()
+	}
+}
+
+func TestMissingApprovalsSummary(t *testing.T) {
+	missing := missingApprovals{"pkg": {"alice", "bob"}, "": {"root"}}
+	expected := approvalSummary + "\n\n- `OWNERS`: @root\n- `pkg/OWNERS`: @alice, @bob"
+	if summary := missing.summary(); summary != expected {
+		t.Errorf("expected %q, saw %q", expected, summary)
+	}
+}
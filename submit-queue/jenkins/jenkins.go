@@ -17,15 +17,36 @@ limitations under the License.
 package jenkins
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 )
 
+// defaultTimeout bounds each request if JenkinsClient.Timeout is unset.
+const defaultTimeout = 30 * time.Second
+
 type JenkinsClient struct {
 	Host string
+	// User and Token, if set, authenticate every request with HTTP basic auth. Token
+	// may be the user's API token or password.
+	User  string
+	Token string
+	// Timeout bounds each request.
+	Timeout time.Duration
+
+	lock   sync.Mutex
+	client *http.Client
+	// crumb is the CSRF protection header, fetched the first time it is needed.
+	crumb *Crumb
 }
 
 type Queue struct {
@@ -43,40 +64,167 @@ type Job struct {
 	Result    string `json:"result"`
 	ID        string `json:"id"`
 	Timestamp int    `json:"timestamp"`
+	Number    int    `json:"number"`
+	URL       string `json:"url"`
+	Building  bool   `json:"building"`
+}
+
+// Crumb is the header Jenkins requires on POSTs when CSRF protection is enabled.
+type Crumb struct {
+	Crumb             string `json:"crumb"`
+	CrumbRequestField string `json:"crumbRequestField"`
+}
+
+// TestReport is the JUnit summary Jenkins keeps for a build.
+type TestReport struct {
+	FailCount int         `json:"failCount"`
+	PassCount int         `json:"passCount"`
+	SkipCount int         `json:"skipCount"`
+	Suites    []TestSuite `json:"suites"`
+}
+
+type TestSuite struct {
+	Name  string     `json:"name"`
+	Cases []TestCase `json:"cases"`
+}
+
+type TestCase struct {
+	ClassName    string `json:"className"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	ErrorDetails string `json:"errorDetails"`
 }
 
-func (j *JenkinsClient) request(path string) ([]byte, error) {
-	url := j.Host + path
-	glog.V(3).Infof("Hitting: %s", url)
-	res, err := http.Get(url)
+// Failed returns true if the test case failed in this build.
+func (t *TestCase) Failed() bool {
+	return t.Status == "FAILED" || t.Status == "REGRESSION"
+}
+
+// statusError is returned when Jenkins responds with something other than 2xx.
+type statusError struct {
+	url    string
+	status int
+}
+
+func (s *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", s.status, s.url)
+}
+
+func (j *JenkinsClient) httpClient() *http.Client {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.client == nil {
+		timeout := j.Timeout
+		if timeout == 0 {
+			timeout = defaultTimeout
+		}
+		j.client = &http.Client{Timeout: timeout}
+	}
+	return j.client
+}
+
+func (j *JenkinsClient) do(method, url string, body io.Reader, header http.Header) ([]byte, error) {
+	glog.V(3).Infof("Hitting: %s %s", method, url)
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if len(j.User) > 0 || len(j.Token) > 0 {
+		req.SetBasicAuth(j.User, j.Token)
+	}
+	res, err := j.httpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
-	return ioutil.ReadAll(res.Body)
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, &statusError{url: url, status: res.StatusCode}
+	}
+	return data, nil
 }
 
-func (j *JenkinsClient) GetJob(name string) (*Queue, error) {
-	data, err := j.request("/job/" + name + "/api/json")
+func (j *JenkinsClient) getJSON(url string, obj interface{}) error {
+	data, err := j.do("GET", url, nil, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	glog.V(8).Infof("Got data: %s", string(data))
+	return json.Unmarshal(data, obj)
+}
+
+// getCrumb returns the CSRF crumb, or nil if CSRF protection is disabled.
+func (j *JenkinsClient) getCrumb() (*Crumb, error) {
+	j.lock.Lock()
+	crumb := j.crumb
+	j.lock.Unlock()
+	if crumb != nil {
+		return crumb, nil
+	}
+	crumb = &Crumb{}
+	if err := j.getJSON(j.Host+"/crumbIssuer/api/json", crumb); err != nil {
+		if statusErr, ok := err.(*statusError); ok && statusErr.status == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	j.lock.Lock()
+	j.crumb = crumb
+	j.lock.Unlock()
+	return crumb, nil
+}
+
+// post sends params to path. If Jenkins rejects the crumb, for example because it
+// restarted since the crumb was fetched, a new crumb is fetched and the post retried once.
+func (j *JenkinsClient) post(path string, params url.Values) error {
+	for attempt := 1; ; attempt++ {
+		header := http.Header{}
+		crumb, err := j.getCrumb()
+		if err != nil {
+			return err
+		}
+		if crumb != nil {
+			header.Set(crumb.CrumbRequestField, crumb.Crumb)
+		}
+		header.Set("Content-Type", "application/x-www-form-urlencoded")
+		_, err = j.do("POST", j.Host+path, bytes.NewBufferString(params.Encode()), header)
+		if statusErr, ok := err.(*statusError); ok && statusErr.status == http.StatusForbidden && crumb != nil && attempt == 1 {
+			glog.V(2).Infof("Jenkins rejected the crumb, fetching a new one")
+			j.lock.Lock()
+			j.crumb = nil
+			j.lock.Unlock()
+			continue
+		}
+		return err
+	}
+}
+
+func (j *JenkinsClient) GetJob(name string) (*Queue, error) {
 	q := &Queue{}
-	if err := json.Unmarshal(data, q); err != nil {
+	if err := j.getJSON(j.Host+"/job/"+name+"/api/json", q); err != nil {
 		return nil, err
 	}
 	return q, nil
 }
 
 func (j *JenkinsClient) GetLastCompletedBuild(name string) (*Job, error) {
-	data, err := j.request("/job/" + name + "/lastCompletedBuild/api/json")
-	if err != nil {
+	job := &Job{}
+	if err := j.getJSON(j.Host+"/job/"+name+"/lastCompletedBuild/api/json", job); err != nil {
 		return nil, err
 	}
-	glog.V(8).Infof("Got data: %s", string(data))
+	return job, nil
+}
+
+// GetBuild returns a single build of a job.
+func (j *JenkinsClient) GetBuild(name string, number int) (*Job, error) {
 	job := &Job{}
-	if err := json.Unmarshal(data, job); err != nil {
+	if err := j.getJSON(fmt.Sprintf("%s/job/%s/%d/api/json", j.Host, name, number), job); err != nil {
 		return nil, err
 	}
 	return job, nil
@@ -89,3 +237,112 @@ func (j *JenkinsClient) IsBuildStable(name string) (bool, error) {
 	}
 	return q.Result == "SUCCESS", nil
 }
+
+// FailureRate returns the fraction of the last n completed builds of a job which
+// did not succeed. Builds still running are ignored.
+func (j *JenkinsClient) FailureRate(name string, n int) (float64, error) {
+	q, err := j.GetJob(name)
+	if err != nil {
+		return 0, err
+	}
+	completed, failed := 0, 0
+	for _, build := range q.Builds {
+		if completed >= n {
+			break
+		}
+		job, err := j.GetBuild(name, build.Number)
+		if err != nil {
+			return 0, err
+		}
+		if job.Building {
+			continue
+		}
+		completed++
+		if job.Result != "SUCCESS" {
+			failed++
+		}
+	}
+	if completed == 0 {
+		return 0, fmt.Errorf("no completed builds of %s", name)
+	}
+	return float64(failed) / float64(completed), nil
+}
+
+// IsBuildStableOver returns true if no more than threshold (a fraction between 0
+// and 1) of the last n completed builds of a job failed.
+func (j *JenkinsClient) IsBuildStableOver(name string, n int, threshold float64) (bool, error) {
+	rate, err := j.FailureRate(name, n)
+	if err != nil {
+		return false, err
+	}
+	glog.V(2).Infof("%s failed %.0f%% of the last %d builds", name, rate*100, n)
+	return rate <= threshold, nil
+}
+
+// Build starts a build of a job. If params is non-empty, the job must be parameterized.
+func (j *JenkinsClient) Build(name string, params url.Values) error {
+	if len(params) == 0 {
+		return j.post("/job/"+name+"/build", params)
+	}
+	return j.post("/job/"+name+"/buildWithParameters", params)
+}
+
+// GetTestReport returns the test report of the build at buildURL, for example the
+// target URL of a github status posted by Jenkins.
+func (j *JenkinsClient) GetTestReport(buildURL string) (*TestReport, error) {
+	// the request carries the credentials of this server
+	if !j.OnServer(buildURL) {
+		return nil, fmt.Errorf("%s is not on %s", buildURL, j.Host)
+	}
+	report := &TestReport{}
+	if err := j.getJSON(strings.TrimSuffix(buildURL, "/")+"/testReport/api/json", report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// OnServer returns true if rawurl has the scheme and host of Host, and a path under
+// its path.
+func (j *JenkinsClient) OnServer(rawurl string) bool {
+	host, err := url.Parse(j.Host)
+	if err != nil {
+		return false
+	}
+	target, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(target.Scheme, host.Scheme) || !strings.EqualFold(target.Host, host.Host) || target.User != nil {
+		return false
+	}
+	prefix := strings.TrimSuffix(host.Path, "/")
+	return target.Path == prefix || strings.HasPrefix(target.Path, prefix+"/")
+}
+
+// maxReportedFailures limits how many failed tests FailureSummary lists.
+const maxReportedFailures = 10
+
+// FailureSummary describes the failed tests in a report, in markdown.
+func FailureSummary(buildURL string, report *TestReport) string {
+	lines := []string{fmt.Sprintf("%d tests failed in [%s](%s):", report.FailCount, buildURL, buildURL), ""}
+	count := 0
+	for _, suite := range report.Suites {
+		for _, test := range suite.Cases {
+			if !test.Failed() {
+				continue
+			}
+			count++
+			if count > maxReportedFailures {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("- `%s.%s`", test.ClassName, test.Name))
+			if details := strings.TrimSpace(test.ErrorDetails); len(details) > 0 {
+				lines = append(lines, fmt.Sprintf("  ```\n  %s\n  ```", strings.Replace(details, "\n", "\n  ", -1)))
+			}
+		}
+	}
+	if count > maxReportedFailures {
+		lines = append(lines, fmt.Sprintf("- ... and %d more", count-maxReportedFailures))
+	}
+	return strings.Join(lines, "\n")
+}
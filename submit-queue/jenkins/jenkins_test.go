@@ -0,0 +1,219 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func serveJSON(t *testing.T, mux *http.ServeMux, path string, obj interface{}) {
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if user, token, ok := r.BasicAuth(); !ok || user != "bot" || token != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, err := json.Marshal(obj)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		w.Write(data)
+	})
+}
+
+func TestFailureRate(t *testing.T) {
+	results := []string{"", "SUCCESS", "FAILURE", "SUCCESS", "SUCCESS", "FAILURE"}
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	queue := &Queue{}
+	for i := range results {
+		number := len(results) - i
+		queue.Builds = append(queue.Builds, Build{Number: number})
+		serveJSON(t, mux, fmt.Sprintf("/job/e2e/%d/api/json", number), &Job{Number: number, Result: results[i], Building: results[i] == ""})
+	}
+	serveJSON(t, mux, "/job/e2e/api/json", queue)
+
+	client := &JenkinsClient{Host: server.URL, User: "bot", Token: "secret"}
+	tests := []struct {
+		builds    int
+		threshold float64
+		rate      float64
+		stable    bool
+	}{
+		{builds: 1, rate: 0, stable: true},
+		{builds: 2, rate: 0.5, stable: false},
+		{builds: 2, threshold: 0.5, rate: 0.5, stable: true},
+		{builds: 5, threshold: 0.3, rate: 0.4, stable: false},
+		{builds: 50, threshold: 0.4, rate: 0.4, stable: true},
+	}
+	for _, test := range tests {
+		rate, err := client.FailureRate("e2e", test.builds)
+		if err != nil {
+			t.Errorf("%d builds: unexpected error: %v", test.builds, err)
+		}
+		if rate != test.rate {
+			t.Errorf("%d builds: expected rate %v, saw %v", test.builds, test.rate, rate)
+		}
+		stable, err := client.IsBuildStableOver("e2e", test.builds, test.threshold)
+		if err != nil {
+			t.Errorf("%d builds: unexpected error: %v", test.builds, err)
+		}
+		if stable != test.stable {
+			t.Errorf("%d builds: expected stable %v, saw %v", test.builds, test.stable, stable)
+		}
+	}
+
+	unauthenticated := &JenkinsClient{Host: server.URL}
+	if _, err := unauthenticated.FailureRate("e2e", 1); err == nil {
+		t.Errorf("expected error without credentials")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		crumb  bool
+		params url.Values
+		path   string
+	}{
+		{crumb: true, params: url.Values{"PULL_NUMBER": {"12"}}, path: "/job/pr/buildWithParameters"},
+		{crumb: false, params: url.Values{"PULL_NUMBER": {"12"}}, path: "/job/pr/buildWithParameters"},
+		{crumb: true, path: "/job/pr/build"},
+	}
+	for _, test := range tests {
+		mux := http.NewServeMux()
+		server := httptest.NewServer(mux)
+		if test.crumb {
+			serveJSON(t, mux, "/crumbIssuer/api/json", &Crumb{Crumb: "abc", CrumbRequestField: "Jenkins-Crumb"})
+		}
+		built := false
+		mux.HandleFunc("/job/pr/", func(w http.ResponseWriter, r *http.Request) {
+			built = true
+			if r.Method != "POST" {
+				t.Errorf("Unexpected method: %s", r.Method)
+			}
+			if r.URL.Path != test.path {
+				t.Errorf("Unexpected path: %s", r.URL.Path)
+			}
+			if test.crumb && r.Header.Get("Jenkins-Crumb") != "abc" {
+				t.Errorf("Missing crumb")
+			}
+			if r.FormValue("PULL_NUMBER") != test.params.Get("PULL_NUMBER") {
+				t.Errorf("Unexpected PULL_NUMBER: %s", r.FormValue("PULL_NUMBER"))
+			}
+			w.WriteHeader(http.StatusCreated)
+		})
+		client := &JenkinsClient{Host: server.URL, User: "bot", Token: "secret"}
+		if err := client.Build("pr", test.params); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !built {
+			t.Errorf("build was not started")
+		}
+		server.Close()
+	}
+}
+
+func TestBuildStaleCrumb(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// Jenkins restarts and issues a new crumb after the first build
+	crumb := "abc"
+	mux.HandleFunc("/crumbIssuer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(&Crumb{Crumb: crumb, CrumbRequestField: "Jenkins-Crumb"})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		w.Write(data)
+	})
+	builds := 0
+	mux.HandleFunc("/job/pr/build", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Jenkins-Crumb") != crumb {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		builds++
+		w.WriteHeader(http.StatusCreated)
+	})
+	client := &JenkinsClient{Host: server.URL}
+	if err := client.Build("pr", nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	crumb = "def"
+	if err := client.Build("pr", nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if builds != 2 {
+		t.Errorf("expected 2 builds, saw %d", builds)
+	}
+}
+
+func TestFailureSummary(t *testing.T) {
+	report := &TestReport{
+		FailCount: 2,
+		Suites: []TestSuite{
+			{
+				Cases: []TestCase{
+					{ClassName: "Kubernetes e2e", Name: "Pods should run", Status: "PASSED"},
+					{ClassName: "Kubernetes e2e", Name: "Services should serve", Status: "FAILED", ErrorDetails: "timed out\nafter 5m"},
+					{ClassName: "Kubernetes e2e", Name: "DNS should resolve", Status: "REGRESSION"},
+				},
+			},
+		},
+	}
+	summary := FailureSummary("http://jenkins/job/pr/3/", report)
+	for _, expected := range []string{"2 tests failed", "`Kubernetes e2e.Services should serve`", "  timed out\n  after 5m", "`Kubernetes e2e.DNS should resolve`"} {
+		if !strings.Contains(summary, expected) {
+			t.Errorf("expected %q in summary:\n%s", expected, summary)
+		}
+	}
+	if strings.Contains(summary, "Pods should run") {
+		t.Errorf("passing test in summary:\n%s", summary)
+	}
+}
+
+func TestOnServer(t *testing.T) {
+	tests := []struct {
+		host     string
+		url      string
+		expected bool
+	}{
+		{"https://jenkins.example.com", "https://jenkins.example.com/job/pr/3/", true},
+		{"https://jenkins.example.com/", "https://JENKINS.example.com/job/pr/3/", true},
+		{"https://jenkins.example.com", "https://jenkins.example.com.evil/job/pr/3/", false},
+		{"https://jenkins.example.com", "https://jenkins.example.com@evil/job/pr/3/", false},
+		{"https://jenkins.example.com", "https://user@jenkins.example.com/job/pr/3/", false},
+		{"https://jenkins.example.com", "http://jenkins.example.com/job/pr/3/", false},
+		{"https://jenkins.example.com", "https://jenkins.example.com:8443/job/pr/3/", false},
+		{"https://example.com/jenkins", "https://example.com/jenkins/job/pr/3/", true},
+		{"https://example.com/jenkins", "https://example.com/jenkins-evil/job/pr/3/", false},
+		{"https://jenkins.example.com", "://bad", false},
+	}
+	for _, test := range tests {
+		client := &JenkinsClient{Host: test.host}
+		if onServer := client.OnServer(test.url); onServer != test.expected {
+			t.Errorf("%s on %s: expected %v, saw %v", test.url, test.host, test.expected, onServer)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package merge merges PRs for the submit queue, choosing how to merge each PR and
+// what its commit message says, and keeps a history of the merges it made.
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	sqgithub "k8s.io/contrib/submit-queue/github"
+
+	"github.com/google/go-github/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// defaultTemplate is the commit message used if Config.Template is empty.
+	defaultTemplate = "Auto commit by PR queue bot"
+	// maxHistory is how many merges are kept in the history.
+	maxHistory = 100
+)
+
+var (
+	merges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "submitqueue_merges_total",
+		Help: "Number of PRs merged by the submit queue, by merge method.",
+	}, []string{"method"})
+	lgtmToMerge = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "submitqueue_lgtm_to_merge_seconds",
+		Help:    "Time from the last lgtm label on a PR until the submit queue merged it.",
+		Buckets: prometheus.ExponentialBuckets(600, 2, 10),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(merges)
+	prometheus.MustRegister(lgtmToMerge)
+}
+
+// releaseNoteRE matches a ```release-note block in the body of a PR.
+var releaseNoteRE = regexp.MustCompile("(?s)```release-note\\s*\\n(.*?)```")
+
+// Config describes how PRs are merged.
+type Config struct {
+	// Method is "merge", "squash" or "rebase". It defaults to "merge".
+	Method string `json:"method,omitempty"`
+	// LabelMethods maps a label to the method used for PRs which have it, in place
+	// of Method. If a PR has several of the labels, the first one on the PR wins.
+	LabelMethods map[string]string `json:"labelMethods,omitempty"`
+	// Template is a text/template for the commit message, which is executed with a
+	// Data. It defaults to a fixed message.
+	Template string `json:"template,omitempty"`
+}
+
+// Data is what a commit message template can refer to.
+type Data struct {
+	Title  string
+	Number int
+	Author string
+	// Reviewers are the users who applied the lgtm label.
+	Reviewers []string
+	// ReleaseNote is the contents of the ```release-note block in the PR body.
+	ReleaseNote string
+}
+
+// Record is the outcome of an attempt to merge a PR.
+type Record struct {
+	Number int       `json:"number"`
+	Title  string    `json:"title"`
+	Method string    `json:"method"`
+	Merged bool      `json:"merged"`
+	SHA    string    `json:"sha,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Merger merges PRs and records the results.
+type Merger struct {
+	method       string
+	labelMethods map[string]string
+	template     *template.Template
+
+	lock sync.Mutex
+	// history is newest last.
+	history []Record
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// New creates a Merger from config.
+func New(config *Config) (*Merger, error) {
+	m := &Merger{
+		method:       config.Method,
+		labelMethods: config.LabelMethods,
+		now:          time.Now,
+	}
+	if len(m.method) == 0 {
+		m.method = sqgithub.MergeMethodMerge
+	}
+	if err := validateMethod(m.method); err != nil {
+		return nil, err
+	}
+	for _, method := range m.labelMethods {
+		if err := validateMethod(method); err != nil {
+			return nil, err
+		}
+	}
+	text := config.Template
+	if len(text) == 0 {
+		text = defaultTemplate
+	}
+	tmpl, err := template.New("commit").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	m.template = tmpl
+	return m, nil
+}
+
+func validateMethod(method string) error {
+	switch method {
+	case sqgithub.MergeMethodMerge, sqgithub.MergeMethodSquash, sqgithub.MergeMethodRebase:
+		return nil
+	}
+	return fmt.Errorf("unknown merge method: %q", method)
+}
+
+// methodFor returns the merge method for a PR with the labels of issue.
+func (m *Merger) methodFor(issue *github.Issue) string {
+	for _, label := range issue.Labels {
+		if label.Name == nil {
+			continue
+		}
+		if method, ok := m.labelMethods[*label.Name]; ok {
+			return method
+		}
+	}
+	return m.method
+}
+
+// message returns the commit message for merging pr, which was approved by reviewers.
+func (m *Merger) message(pr *github.PullRequest, reviewers []string) (string, error) {
+	data := Data{Number: *pr.Number, Reviewers: reviewers}
+	if pr.Title != nil {
+		data.Title = *pr.Title
+	}
+	if pr.User != nil && pr.User.Login != nil {
+		data.Author = *pr.User.Login
+	}
+	if pr.Body != nil {
+		data.ReleaseNote = releaseNote(*pr.Body)
+	}
+	var buf bytes.Buffer
+	if err := m.template.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Merge merges pr and records the result in the history.
+func (m *Merger) Merge(client *github.Client, user, project string, pr *github.PullRequest, issue *github.Issue) error {
+	record := Record{Number: *pr.Number, Method: m.methodFor(issue)}
+	if pr.Title != nil {
+		record.Title = *pr.Title
+	}
+	err := m.merge(client, user, project, pr, &record)
+	if err != nil {
+		record.Error = err.Error()
+	}
+	record.Time = m.now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.history = append(m.history, record)
+	if len(m.history) > maxHistory {
+		m.history = m.history[len(m.history)-maxHistory:]
+	}
+	return err
+}
+
+func (m *Merger) merge(client *github.Client, user, project string, pr *github.PullRequest, record *Record) error {
+	reviewers, lgtmTime, err := lgtm(client, user, project, *pr.Number)
+	if err != nil {
+		return err
+	}
+	message, err := m.message(pr, reviewers)
+	if err != nil {
+		return err
+	}
+	sha := ""
+	if pr.Head != nil && pr.Head.SHA != nil {
+		sha = *pr.Head.SHA
+	}
+	result, err := sqgithub.MergePR(client, user, project, *pr.Number, record.Method, message, sha, "passed the submit queue")
+	if err != nil {
+		return err
+	}
+	if result.SHA != nil {
+		record.SHA = *result.SHA
+	}
+	record.Merged = true
+	merges.WithLabelValues(record.Method).Inc()
+	if lgtmTime != nil {
+		lgtmToMerge.Observe(m.now().Sub(*lgtmTime).Seconds())
+	}
+	return nil
+}
+
+// ServeHTTP returns the merge history as JSON, newest first.
+func (m *Merger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	m.lock.Lock()
+	history := make([]Record, 0, len(m.history))
+	for i := len(m.history) - 1; i >= 0; i-- {
+		history = append(history, m.history[i])
+	}
+	m.lock.Unlock()
+	data, err := json.Marshal(history)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// releaseNote returns the contents of the ```release-note block in body, if any.
+func releaseNote(body string) string {
+	match := releaseNoteRE.FindStringSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimSpace(match[1])
+}
+
+// lgtm returns the users who applied the lgtm label to a PR, in the order they applied
+// it, and when it was last applied.
+func lgtm(client *github.Client, user, project string, prNumber int) ([]string, *time.Time, error) {
+	events, _, err := client.Issues.ListIssueEvents(user, project, prNumber, &github.ListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := map[string]bool{}
+	reviewers := []string{}
+	var last *time.Time
+	for _, event := range events {
+		if event.Event == nil || *event.Event != "labeled" || event.Label == nil || event.Label.Name == nil || *event.Label.Name != "lgtm" {
+			continue
+		}
+		if event.CreatedAt != nil && (last == nil || event.CreatedAt.After(*last)) {
+			last = event.CreatedAt
+		}
+		if event.Actor == nil || event.Actor.Login == nil || seen[*event.Actor.Login] {
+			continue
+		}
+		seen[*event.Actor.Login] = true
+		reviewers = append(reviewers, *event.Actor.Login)
+	}
+	return reviewers, last, nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package merge
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	github_test "k8s.io/contrib/submit-queue/github/testing"
+
+	"github.com/google/go-github/github"
+)
+
+func stringPtr(val string) *string { return &val }
+func intPtr(val int) *int          { return &val }
+func boolPtr(val bool) *bool       { return &val }
+
+func labeled(label, login string) github.IssueEvent {
+	return github.IssueEvent{
+		Event: stringPtr("labeled"),
+		Label: &github.Label{Name: stringPtr(label)},
+		Actor: &github.User{Login: stringPtr(login)},
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		config    Config
+		expectErr bool
+	}{
+		{config: Config{}},
+		{config: Config{Method: "squash", LabelMethods: map[string]string{"rebase-me": "rebase"}}},
+		{config: Config{Method: "octopus"}, expectErr: true},
+		{config: Config{LabelMethods: map[string]string{"x": "fast-forward"}}, expectErr: true},
+		{config: Config{Template: "{{.Title"}, expectErr: true},
+	}
+	for _, test := range tests {
+		_, err := New(&test.config)
+		if test.expectErr != (err != nil) {
+			t.Errorf("%+v: expected error %v, saw %v", test.config, test.expectErr, err)
+		}
+	}
+}
+
+func TestMethodFor(t *testing.T) {
+	m, err := New(&Config{Method: "squash", LabelMethods: map[string]string{"merge-commit": "merge", "rebase": "rebase"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		labels   []string
+		expected string
+	}{
+		{labels: nil, expected: "squash"},
+		{labels: []string{"lgtm"}, expected: "squash"},
+		{labels: []string{"lgtm", "rebase"}, expected: "rebase"},
+		{labels: []string{"merge-commit", "rebase"}, expected: "merge"},
+	}
+	for _, test := range tests {
+		issue := &github.Issue{}
+		for _, label := range test.labels {
+			issue.Labels = append(issue.Labels, github.Label{Name: stringPtr(label)})
+		}
+		if method := m.methodFor(issue); method != test.expected {
+			t.Errorf("%v: expected %s, saw %s", test.labels, test.expected, method)
+		}
+	}
+}
+
+func TestReleaseNote(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{body: "Fixes #1", expected: ""},
+		{body: "Fixes #1\n```release-note\nAdded a flag.\n```\n", expected: "Added a flag."},
+		{body: "```release-note\r\n  Two\n  lines\n```", expected: "Two\n  lines"},
+	}
+	for _, test := range tests {
+		if note := releaseNote(test.body); note != test.expected {
+			t.Errorf("%q: expected %q, saw %q", test.body, test.expected, note)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	client, server, mux := github_test.InitTest()
+	defer server.Close()
+	mux.HandleFunc("/repos/o/r/issues/1/events", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal([]github.IssueEvent{labeled("lgtm", "alice"), labeled("size/S", "bot"), labeled("lgtm", "bob"), labeled("lgtm", "alice")})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		w.Write(data)
+	})
+	merged := false
+	mux.HandleFunc("/repos/o/r/pulls/1/merge", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("Unexpected method: %s", r.Method)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		req := mergeRequestBody{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		expected := mergeRequestBody{
+			CommitMessage: "Fix the thing (#1)\n\nby carol, reviewed by alice, bob\n\nThing is fixed.",
+			SHA:           "abcdef",
+			MergeMethod:   "squash",
+		}
+		if req != expected {
+			t.Errorf("expected %+v, saw %+v", expected, req)
+		}
+		data, err := json.Marshal(github.PullRequestMergeResult{SHA: stringPtr("123456"), Merged: boolPtr(!merged)})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		merged = true
+		w.Write(data)
+	})
+
+	m, err := New(&Config{
+		Method:   "squash",
+		Template: "{{.Title}} (#{{.Number}})\n\nby {{.Author}}, reviewed by {{range $i, $r := .Reviewers}}{{if $i}}, {{end}}{{$r}}{{end}}\n\n{{.ReleaseNote}}",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.now = func() time.Time { return time.Unix(0, 0) }
+	pr := &github.PullRequest{
+		Number: intPtr(1),
+		Title:  stringPtr("Fix the thing"),
+		Body:   stringPtr("```release-note\nThing is fixed.\n```"),
+		User:   &github.User{Login: stringPtr("carol")},
+		Head:   &github.PullRequestBranch{SHA: stringPtr("abcdef")},
+	}
+	if err := m.Merge(client, "o", "r", pr, &github.Issue{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// The second time github refuses
+	if err := m.Merge(client, "o", "r", pr, &github.Issue{}); err == nil {
+		t.Errorf("expected error")
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/history", nil)
+	m.ServeHTTP(w, req)
+	history := []Record{}
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	if history[0].Merged || len(history[0].Error) == 0 {
+		t.Errorf("unexpected record: %+v", history[0])
+	}
+	if !history[1].Merged || history[1].SHA != "123456" || history[1].Method != "squash" || history[1].Title != "Fix the thing" {
+		t.Errorf("unexpected record: %+v", history[1])
+	}
+}
+
+// mergeRequestBody is what github receives from sqgithub.MergePR.
+type mergeRequestBody struct {
+	CommitMessage string `json:"commit_message"`
+	SHA           string `json:"sha"`
+	MergeMethod   string `json:"merge_method"`
+}
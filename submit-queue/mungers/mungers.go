@@ -0,0 +1,132 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mungers holds automation which runs over every open PR on each pass of
+// the submit queue, such as labeling PRs by size.
+package mungers
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	sqgithub "k8s.io/contrib/submit-queue/github"
+
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// PRMunger is a piece of automation which is run on every open PR.
+type PRMunger interface {
+	// Name identifies the munger in --pr-mungers.
+	Name() string
+	// AddFlags registers any flags the munger needs.
+	AddFlags(fs *flag.FlagSet)
+	// MungePR does the munger's work on a single PR.
+	MungePR(config *Config, pr *github.PullRequest, issue *github.Issue) error
+}
+
+// Config is passed to every munger.
+type Config struct {
+	Client  *github.Client
+	Org     string
+	Project string
+	// DryRun mungers only log the changes they would make.
+	DryRun bool
+
+	// munger is the name of the munger running, recorded as the reason for its actions.
+	munger string
+}
+
+// reason explains the actions of the munger running, for the audit log.
+func (c *Config) reason() string {
+	return c.munger + " munger"
+}
+
+// AddLabels adds labels to a PR, respecting DryRun.
+func (c *Config) AddLabels(prNumber int, labels ...string) error {
+	return sqgithub.AddLabels(c.Client, c.Org, c.Project, prNumber, labels, c.reason(), c.DryRun)
+}
+
+// RemoveLabel removes a label from a PR, respecting DryRun.
+func (c *Config) RemoveLabel(prNumber int, label string) error {
+	return sqgithub.RemoveLabel(c.Client, c.Org, c.Project, prNumber, label, c.reason(), c.DryRun)
+}
+
+// WriteComment comments on a PR, respecting DryRun.
+func (c *Config) WriteComment(prNumber int, body string) error {
+	return sqgithub.WriteComment(c.Client, c.Org, c.Project, prNumber, body, c.reason(), c.DryRun)
+}
+
+var mungerMap = map[string]PRMunger{}
+
+// RegisterMunger makes a munger available to --pr-mungers. It is called from the
+// init() of each munger.
+func RegisterMunger(munger PRMunger) {
+	if _, found := mungerMap[munger.Name()]; found {
+		glog.Fatalf("a munger named %s is already registered", munger.Name())
+	}
+	mungerMap[munger.Name()] = munger
+}
+
+// RegisterFlags adds the flags of every registered munger to fs.
+func RegisterFlags(fs *flag.FlagSet) {
+	for _, munger := range mungerMap {
+		munger.AddFlags(fs)
+	}
+}
+
+// AvailableMungers returns the sorted names of all registered mungers.
+func AvailableMungers() []string {
+	names := []string{}
+	for name := range mungerMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetMungers returns the mungers with the given names, in the same order.
+func GetMungers(names []string) ([]PRMunger, error) {
+	mungers := []PRMunger{}
+	for _, name := range names {
+		munger, found := mungerMap[name]
+		if !found {
+			return nil, fmt.Errorf("unknown munger %q, available mungers are %v", name, AvailableMungers())
+		}
+		mungers = append(mungers, munger)
+	}
+	return mungers, nil
+}
+
+// MungePullRequests runs each munger over every open PR.
+func MungePullRequests(ctx context.Context, config *Config, mungers []PRMunger) error {
+	if len(mungers) == 0 {
+		return nil
+	}
+	return sqgithub.ForEachPRDo(ctx, config.Client, config.Org, config.Project, func(ctx context.Context, client *github.Client, pr *github.PullRequest, issue *github.Issue) error {
+		for _, munger := range mungers {
+			glog.V(4).Infof("Running %s on PR %d", munger.Name(), *pr.Number)
+			mungerConfig := *config
+			mungerConfig.munger = munger.Name()
+			if err := munger.MungePR(&mungerConfig, pr, issue); err != nil {
+				glog.Errorf("Munger %s failed on PR %d: %v", munger.Name(), *pr.Number, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mungers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	github_test "k8s.io/contrib/submit-queue/github/testing"
+
+	"github.com/google/go-github/github"
+)
+
+func stringPtr(val string) *string     { return &val }
+func intPtr(val int) *int              { return &val }
+func boolPtr(val bool) *bool           { return &val }
+func timePtr(val time.Time) *time.Time { return &val }
+
+func labels(names ...string) []github.Label {
+	result := []github.Label{}
+	for _, name := range names {
+		result = append(result, github.Label{Name: stringPtr(name)})
+	}
+	return result
+}
+
+// actions records the label and comment requests a munger makes against PR 1 in o/r.
+type actions struct {
+	added    []string
+	removed  []string
+	comments []string
+}
+
+func runMunger(t *testing.T, munger PRMunger, pr *github.PullRequest, issue *github.Issue, dryRun bool) *actions {
+	client, server, mux := github_test.InitTest()
+	defer server.Close()
+
+	result := &actions{}
+	mux.HandleFunc("/repos/o/r/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Unexpected method: %s", r.Method)
+		}
+		added := []string{}
+		if err := json.NewDecoder(r.Body).Decode(&added); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		result.added = append(result.added, added...)
+		w.Write([]byte("[]"))
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/labels/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("Unexpected method: %s", r.Method)
+		}
+		result.removed = append(result.removed, strings.TrimPrefix(r.URL.Path, "/repos/o/r/issues/1/labels/"))
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Unexpected method: %s", r.Method)
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		comment := github.IssueComment{}
+		if err := json.Unmarshal(data, &comment); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		result.comments = append(result.comments, *comment.Body)
+		w.Write([]byte("{}"))
+	})
+
+	config := &Config{Client: client, Org: "o", Project: "r", DryRun: dryRun}
+	if err := munger.MungePR(config, pr, issue); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	return result
+}
+
+func TestSizeLabel(t *testing.T) {
+	tests := []struct {
+		lines    int
+		expected string
+	}{
+		{0, "size/XS"},
+		{9, "size/XS"},
+		{10, "size/S"},
+		{99, "size/M"},
+		{100, "size/L"},
+		{999, "size/XL"},
+		{1000, "size/XXL"},
+		{50000, "size/XXL"},
+	}
+	for _, test := range tests {
+		if label := sizeLabel(test.lines); label != test.expected {
+			t.Errorf("%d lines: expected %s, saw %s", test.lines, test.expected, label)
+		}
+	}
+}
+
+func TestSizeMunger(t *testing.T) {
+	tests := []struct {
+		additions int
+		deletions int
+		labels    []github.Label
+		dryRun    bool
+		added     []string
+		removed   []string
+	}{
+		{additions: 5, deletions: 1, labels: labels("lgtm"), added: []string{"size/XS"}},
+		{additions: 5, deletions: 1, labels: labels("size/XS")},
+		{additions: 50, deletions: 60, labels: labels("size/XS", "lgtm"), added: []string{"size/L"}, removed: []string{"size/XS"}},
+		{additions: 50, deletions: 60, labels: labels("size/XS"), dryRun: true},
+	}
+	for i, test := range tests {
+		pr := &github.PullRequest{Number: intPtr(1), Additions: intPtr(test.additions), Deletions: intPtr(test.deletions)}
+		result := runMunger(t, SizeMunger{}, pr, &github.Issue{Labels: test.labels}, test.dryRun)
+		if !reflect.DeepEqual(result.added, test.added) {
+			t.Errorf("case %d: expected added %v, saw %v", i, test.added, result.added)
+		}
+		if !reflect.DeepEqual(result.removed, test.removed) {
+			t.Errorf("case %d: expected removed %v, saw %v", i, test.removed, result.removed)
+		}
+	}
+}
+
+func TestNeedsRebaseMunger(t *testing.T) {
+	tests := []struct {
+		mergeable *bool
+		labels    []github.Label
+		added     []string
+		removed   []string
+	}{
+		{mergeable: nil, labels: labels()},
+		{mergeable: boolPtr(true), labels: labels()},
+		{mergeable: boolPtr(false), labels: labels(), added: []string{"needs-rebase"}},
+		{mergeable: boolPtr(false), labels: labels("needs-rebase")},
+		{mergeable: boolPtr(true), labels: labels("needs-rebase"), removed: []string{"needs-rebase"}},
+	}
+	for i, test := range tests {
+		pr := &github.PullRequest{Number: intPtr(1), Mergeable: test.mergeable}
+		result := runMunger(t, NeedsRebaseMunger{}, pr, &github.Issue{Labels: test.labels}, false)
+		if !reflect.DeepEqual(result.added, test.added) {
+			t.Errorf("case %d: expected added %v, saw %v", i, test.added, result.added)
+		}
+		if !reflect.DeepEqual(result.removed, test.removed) {
+			t.Errorf("case %d: expected removed %v, saw %v", i, test.removed, result.removed)
+		}
+	}
+}
+
+func TestStalePRMunger(t *testing.T) {
+	now := time.Unix(100*24*3600, 0)
+	tests := []struct {
+		updated time.Time
+		dryRun  bool
+		pinged  bool
+	}{
+		{updated: now.Add(-time.Hour)},
+		{updated: now.Add(-31 * 24 * time.Hour), pinged: true},
+		{updated: now.Add(-31 * 24 * time.Hour), dryRun: true},
+	}
+	for i, test := range tests {
+		munger := &StalePRMunger{days: intPtr(30), now: func() time.Time { return now }}
+		pr := &github.PullRequest{Number: intPtr(1), User: &github.User{Login: stringPtr("author")}}
+		result := runMunger(t, munger, pr, &github.Issue{UpdatedAt: timePtr(test.updated)}, test.dryRun)
+		if pinged := len(result.comments) == 1 && strings.HasPrefix(result.comments[0], "@author"); pinged != test.pinged {
+			t.Errorf("case %d: expected pinged %v, saw comments %v", i, test.pinged, result.comments)
+		}
+	}
+}
+
+func TestGetMungers(t *testing.T) {
+	if _, err := GetMungers([]string{"size", "needs-rebase", "stale-pr"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := GetMungers([]string{"size", "no-such-munger"}); err == nil {
+		t.Errorf("expected error")
+	}
+}
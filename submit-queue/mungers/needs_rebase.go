@@ -0,0 +1,53 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mungers
+
+import (
+	"flag"
+
+	sqgithub "k8s.io/contrib/submit-queue/github"
+
+	"github.com/google/go-github/github"
+)
+
+const needsRebaseLabel = "needs-rebase"
+
+// NeedsRebaseMunger labels PRs which no longer merge cleanly, and unlabels them once they do.
+type NeedsRebaseMunger struct{}
+
+func init() {
+	RegisterMunger(NeedsRebaseMunger{})
+}
+
+func (NeedsRebaseMunger) Name() string { return "needs-rebase" }
+
+func (NeedsRebaseMunger) AddFlags(fs *flag.FlagSet) {}
+
+func (NeedsRebaseMunger) MungePR(config *Config, pr *github.PullRequest, issue *github.Issue) error {
+	// github hasn't computed mergeability yet, try again on the next pass.
+	if pr.Mergeable == nil {
+		return nil
+	}
+	hasLabel := sqgithub.HasLabel(issue.Labels, needsRebaseLabel)
+	switch {
+	case *pr.Mergeable && hasLabel:
+		return config.RemoveLabel(*pr.Number, needsRebaseLabel)
+	case !*pr.Mergeable && !hasLabel:
+		return config.AddLabels(*pr.Number, needsRebaseLabel)
+	}
+	return nil
+}
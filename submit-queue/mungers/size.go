@@ -0,0 +1,82 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mungers
+
+import (
+	"flag"
+	"strings"
+
+	sqgithub "k8s.io/contrib/submit-queue/github"
+
+	"github.com/google/go-github/github"
+)
+
+const sizeLabelPrefix = "size/"
+
+// sizes are the size labels, with the smallest number of changed lines which earns each.
+var sizes = []struct {
+	label string
+	lines int
+}{
+	{"XS", 0},
+	{"S", 10},
+	{"M", 30},
+	{"L", 100},
+	{"XL", 500},
+	{"XXL", 1000},
+}
+
+// SizeMunger labels each PR size/XS through size/XXL by the number of lines it changes.
+type SizeMunger struct{}
+
+func init() {
+	RegisterMunger(SizeMunger{})
+}
+
+func (SizeMunger) Name() string { return "size" }
+
+func (SizeMunger) AddFlags(fs *flag.FlagSet) {}
+
+// sizeLabel returns the size label for a PR which changes the given number of lines.
+func sizeLabel(lines int) string {
+	label := sizes[0].label
+	for _, size := range sizes {
+		if lines >= size.lines {
+			label = size.label
+		}
+	}
+	return sizeLabelPrefix + label
+}
+
+func (SizeMunger) MungePR(config *Config, pr *github.PullRequest, issue *github.Issue) error {
+	if pr.Additions == nil || pr.Deletions == nil {
+		return nil
+	}
+	want := sizeLabel(*pr.Additions + *pr.Deletions)
+	for _, label := range issue.Labels {
+		if label.Name == nil || !strings.HasPrefix(*label.Name, sizeLabelPrefix) || *label.Name == want {
+			continue
+		}
+		if err := config.RemoveLabel(*pr.Number, *label.Name); err != nil {
+			return err
+		}
+	}
+	if sqgithub.HasLabel(issue.Labels, want) {
+		return nil
+	}
+	return config.AddLabels(*pr.Number, want)
+}
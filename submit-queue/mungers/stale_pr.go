@@ -0,0 +1,56 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mungers
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// StalePRMunger pings the author of a PR which has had no activity for a while.
+type StalePRMunger struct {
+	// days without activity before the author is pinged.
+	days *int
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func init() {
+	RegisterMunger(&StalePRMunger{days: new(int), now: time.Now})
+}
+
+func (s *StalePRMunger) Name() string { return "stale-pr" }
+
+func (s *StalePRMunger) AddFlags(fs *flag.FlagSet) {
+	fs.IntVar(s.days, "stale-pr-days", 30, "Number of days without activity after which the stale-pr munger pings the author")
+}
+
+func (s *StalePRMunger) MungePR(config *Config, pr *github.PullRequest, issue *github.Issue) error {
+	if issue.UpdatedAt == nil || pr.User == nil || pr.User.Login == nil {
+		return nil
+	}
+	stale := time.Duration(*s.days) * 24 * time.Hour
+	if s.now().Sub(*issue.UpdatedAt) < stale {
+		return nil
+	}
+	// The comment counts as activity, so the author isn't pinged again for another period.
+	body := fmt.Sprintf("@%s this PR has had no activity for %d days. Please rebase or update it, or close it if it is no longer needed.", *pr.User.Login, *s.days)
+	return config.WriteComment(*pr.Number, body)
+}
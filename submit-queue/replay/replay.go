@@ -0,0 +1,280 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package replay records the github responses the submit queue sees, and replays them
+// from a local server so that changes to the queue's policy can be tried offline.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// Response is a recorded github response.
+type Response struct {
+	Code int `json:"code"`
+	// Link is the pagination header.
+	Link string `json:"link,omitempty"`
+	Body string `json:"body"`
+}
+
+// Snapshot maps "<path>?<query>" of each GET request to its responses, in the order
+// they were made, so that a URL which was polled is replayed as it changed.
+type Snapshot map[string][]*Response
+
+// LoadSnapshot reads a Snapshot written by Recorder.Save.
+func LoadSnapshot(file string) (Snapshot, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := Snapshot{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func requestKey(r *http.Request) string {
+	return r.URL.Path + "?" + r.URL.RawQuery
+}
+
+// Recorder is an http.RoundTripper which keeps the responses to GET requests.
+type Recorder struct {
+	transport http.RoundTripper
+
+	lock     sync.Mutex
+	snapshot Snapshot
+}
+
+// NewRecorder creates a Recorder which sends requests through transport, or
+// http.DefaultTransport if it is nil.
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{transport: transport, snapshot: Snapshot{}}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil || req.Method != "GET" {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	key := requestKey(req)
+	r.snapshot[key] = append(r.snapshot[key], &Response{
+		Code: resp.StatusCode,
+		Link: resp.Header.Get("Link"),
+		Body: string(body),
+	})
+	return resp, nil
+}
+
+// Reset drops the responses recorded so far, so that a snapshot holds one pass.
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.snapshot = Snapshot{}
+}
+
+// Save writes the responses recorded so far to file.
+func (r *Recorder) Save(file string) error {
+	r.lock.Lock()
+	data, err := json.MarshalIndent(r.snapshot, "", "  ")
+	r.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// Action is a request which would have changed github.
+type Action struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// Simulator is an http.Handler which answers GET requests from a Snapshot, and records
+// and pretends to succeed at every other request. The responses to a request are
+// replayed in order, and the last is repeated once they run out.
+type Simulator struct {
+	snapshot Snapshot
+
+	lock    sync.Mutex
+	actions []Action
+	// served counts the requests answered for each key.
+	served map[string]int
+}
+
+// NewSimulator creates a Simulator which replays snapshot.
+func NewSimulator(snapshot Snapshot) *Simulator {
+	return &Simulator{snapshot: snapshot, served: map[string]int{}}
+}
+
+// next returns the response to replay for key, or nil if none was recorded.
+func (s *Simulator) next(key string) *Response {
+	responses := s.snapshot[key]
+	if len(responses) == 0 {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n := s.served[key]
+	s.served[key]++
+	if n >= len(responses) {
+		n = len(responses) - 1
+	}
+	return responses[n]
+}
+
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == "GET" {
+		resp := s.next(requestKey(r))
+		if resp == nil {
+			glog.Warningf("No recorded response for %s", requestKey(r))
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		if len(resp.Link) > 0 {
+			w.Header().Set("Link", resp.Link)
+		}
+		w.WriteHeader(resp.Code)
+		io.WriteString(w, resp.Body)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.lock.Lock()
+	s.actions = append(s.actions, Action{Method: r.Method, Path: r.URL.Path, Body: string(body)})
+	s.lock.Unlock()
+	if mergeRE.MatchString(r.URL.Path) {
+		io.WriteString(w, `{"merged": true, "sha": "simulated"}`)
+		return
+	}
+	io.WriteString(w, "{}")
+}
+
+// Actions returns the requests which would have changed github, in order.
+func (s *Simulator) Actions() []Action {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Action{}, s.actions...)
+}
+
+var (
+	commentRE = regexp.MustCompile(`^/repos/[^/]+/[^/]+/issues/(\d+)/comments$`)
+	labelRE   = regexp.MustCompile(`^/repos/[^/]+/[^/]+/issues/(\d+)/labels(/.*)?$`)
+	mergeRE   = regexp.MustCompile(`^/repos/[^/]+/[^/]+/pulls/(\d+)/merge$`)
+)
+
+// Outcome is what the queue did, or would have done, with a PR.
+type Outcome struct {
+	PR int
+	// Result is "merge", "skip", "comment" or "label".
+	Result string
+	Reason string
+}
+
+// Report collects the outcomes of a simulated pass.
+type Report struct {
+	lock     sync.Mutex
+	outcomes []Outcome
+}
+
+// Skip records that a PR was skipped. It can be used as github.FilterConfig.Skipped.
+func (r *Report) Skip(prNumber int, reason string) {
+	r.add(Outcome{PR: prNumber, Result: "skip", Reason: reason})
+}
+
+// Merge records that a PR would have been merged.
+func (r *Report) Merge(prNumber int, reason string) {
+	r.add(Outcome{PR: prNumber, Result: "merge", Reason: reason})
+}
+
+// AddActions records the comments and label changes among actions.
+func (r *Report) AddActions(actions []Action) {
+	for _, action := range actions {
+		if match := commentRE.FindStringSubmatch(action.Path); match != nil {
+			comment := struct {
+				Body string `json:"body"`
+			}{}
+			json.Unmarshal([]byte(action.Body), &comment)
+			r.add(Outcome{PR: atoi(match[1]), Result: "comment", Reason: comment.Body})
+		} else if match := labelRE.FindStringSubmatch(action.Path); match != nil {
+			r.add(Outcome{PR: atoi(match[1]), Result: "label", Reason: action.Method + " " + action.Path + " " + action.Body})
+		}
+	}
+}
+
+func (r *Report) add(outcome Outcome) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.outcomes = append(r.outcomes, outcome)
+}
+
+// Outcomes returns the outcomes sorted by PR, in the order they happened for each PR.
+func (r *Report) Outcomes() []Outcome {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := append([]Outcome{}, r.outcomes...)
+	sort.Stable(byPR(result))
+	return result
+}
+
+// Write prints one line per outcome to w.
+func (r *Report) Write(w io.Writer) error {
+	for _, outcome := range r.Outcomes() {
+		if _, err := fmt.Fprintf(w, "#%d\t%s\t%s\n", outcome.PR, outcome.Result, outcome.Reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type byPR []Outcome
+
+func (o byPR) Len() int           { return len(o) }
+func (o byPR) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o byPR) Less(i, j int) bool { return o[i].PR < o[j].PR }
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
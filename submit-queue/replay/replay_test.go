@@ -0,0 +1,184 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replay
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, client *http.Client, url string) (int, string, string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return resp.StatusCode, resp.Header.Get("Link"), string(body)
+}
+
+func TestRecordAndSimulate(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `<https://api.github.com/repos/o/r/pulls?page=2>; rel="last"`)
+		w.Write([]byte(`[{"number": 1}]`))
+	})
+	mux.HandleFunc("/repos/o/r/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	})
+	live := httptest.NewServer(mux)
+	defer live.Close()
+
+	recorder := NewRecorder(nil)
+	client := &http.Client{Transport: recorder}
+	if code, _, body := get(t, client, live.URL+"/repos/o/r/pulls?page=1"); code != http.StatusOK || body != `[{"number": 1}]` {
+		t.Errorf("unexpected response: %d %s", code, body)
+	}
+	get(t, client, live.URL+"/repos/o/r/issues/1")
+
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+	if err := recorder.Save(file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	snapshot, err := LoadSnapshot(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	simulator := NewSimulator(snapshot)
+	server := httptest.NewServer(simulator)
+	defer server.Close()
+	code, link, body := get(t, http.DefaultClient, server.URL+"/repos/o/r/pulls?page=1")
+	if code != http.StatusOK || body != `[{"number": 1}]` || !strings.Contains(link, `rel="last"`) {
+		t.Errorf("unexpected response: %d %s %s", code, link, body)
+	}
+	if code, _, _ := get(t, http.DefaultClient, server.URL+"/repos/o/r/issues/1"); code != http.StatusNotFound {
+		t.Errorf("expected recorded 404, saw %d", code)
+	}
+	if code, _, _ := get(t, http.DefaultClient, server.URL+"/repos/o/r/pulls?page=2"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for a request which wasn't recorded, saw %d", code)
+	}
+
+	posts := []struct {
+		path string
+		body string
+	}{
+		{"/repos/o/r/issues/2/comments", `{"body": "LGTM was before last commit, removing LGTM"}`},
+		{"/repos/o/r/pulls/1/merge", `{"merge_method": "merge"}`},
+	}
+	for _, post := range posts {
+		resp, err := http.Post(server.URL+post.path, "application/json", strings.NewReader(post.body))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: unexpected code %d", post.path, resp.StatusCode)
+		}
+	}
+	if actions := simulator.Actions(); len(actions) != 2 || actions[0].Path != posts[0].path || actions[1].Method != "POST" {
+		t.Errorf("unexpected actions: %+v", actions)
+	}
+
+	report := &Report{}
+	report.Merge(3, "passed every check")
+	report.Skip(2, "pushed after LGTM")
+	report.AddActions(simulator.Actions())
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "#2\tskip\tpushed after LGTM\n" +
+		"#2\tcomment\tLGTM was before last commit, removing LGTM\n" +
+		"#3\tmerge\tpassed every check\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, saw %q", expected, buf.String())
+	}
+}
+
+func TestRecorderReset(t *testing.T) {
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer live.Close()
+
+	recorder := NewRecorder(nil)
+	client := &http.Client{Transport: recorder}
+	get(t, client, live.URL+"/repos/o/r/issues/1")
+	recorder.Reset()
+	get(t, client, live.URL+"/repos/o/r/issues/2")
+
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+	if err := recorder.Save(file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	snapshot, err := LoadSnapshot(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := snapshot["/repos/o/r/issues/1?"]; ok {
+		t.Errorf("expected the response from before the reset to be dropped")
+	}
+	if _, ok := snapshot["/repos/o/r/issues/2?"]; !ok || len(snapshot) != 1 {
+		t.Errorf("expected only the response from after the reset, saw %v", snapshot)
+	}
+}
+
+func TestReplayInOrder(t *testing.T) {
+	states := []string{`{"state": "pending"}`, `{"state": "success"}`}
+	polls := 0
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(states[polls]))
+		polls++
+	}))
+	defer live.Close()
+
+	recorder := NewRecorder(nil)
+	client := &http.Client{Transport: recorder}
+	for range states {
+		get(t, client, live.URL+"/repos/o/r/commits/abc/status")
+	}
+
+	simulator := NewSimulator(recorder.snapshot)
+	server := httptest.NewServer(simulator)
+	defer server.Close()
+	// the polls are replayed as they were seen, then the last response is repeated
+	for _, expected := range append(states, states[1]) {
+		if _, _, body := get(t, http.DefaultClient, server.URL+"/repos/o/r/commits/abc/status"); body != expected {
+			t.Errorf("expected %s, saw %s", expected, body)
+		}
+	}
+}
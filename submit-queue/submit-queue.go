@@ -18,22 +18,43 @@ package main
 
 // A simple binary for merging PR that match a criteria
 // Usage:
-//   submit-queue -token=<github-access-token> -user-whitelist=<file> --jenkins-host=http://some.host [-min-pr-number=<number>] [-dry-run] [-once]
+//   submit-queue -token=<github-access-token> -user-whitelist=<file> [--jenkins-host=http://some.host | --config=<file>] [-min-pr-number=<number>] [-dry-run] [-once]
 //
 // Details:
 /*
 Usage of ./submit-queue:
+  -address="localhost:8080": The address to serve /freeze, /flakes, /history and /metrics on, empty to disable. POST and DELETE on /freeze are not authenticated, so only listen beyond localhost on a trusted network
+  -all-commits=false: If true, require every commit in a PR to be passing rather than only the head commit
   -alsologtostderr=false: log to standard error as well as files
+  -audit-log="": Path to a file to append a JSON record of every action the bot takes to
+  -ci-timeout=2h0m0s: How long to wait for the CI result of a PR before moving on to the next one
+  -config="": Path to a JSON file with per repository settings, keyed by "<org>/<project>"
   -dry-run=false: If true, don't actually merge anything
+  -freeze-file="": Path to a file which, while it exists, freezes the queue with its contents as the reason
   -jenkins-job="kubernetes-e2e-gce,kubernetes-e2e-gke-ci,kubernetes-build": Comma separated list of jobs in Jenkins to use for stability testing
+  -jenkins-token-file="": Path to a file holding the API token of --jenkins-user
+  -jenkins-user="": The Jenkins user to authenticate as
   -log_backtrace_at=:0: when logging hits line file:N, emit a stack trace
   -log_dir="": If non-empty, write log files in this directory
   -logtostderr=false: log to standard error instead of files
+  -merge-blocker-label="merge-blocker": Github label which freezes the queue while any open issue has it
+  -merge-method="merge": How PRs are merged: merge, squash or rebase
+  -mergeability-timeout=10s: How long to wait for github to determine if a PR is mergeable
   -min-pr-number=0: The minimum PR to start with [default: 0]
   -once=false: If true, only merge one PR, don't run forever
+  -optional-contexts="": Comma separated list of status contexts whose failure is logged but doesn't block a merge
+  -org="kubernetes": The github organization to merge into
+  -owners-approval=false: If true, require approval from the OWNERS of every changed file instead of a whitelisted author
+  -owners-approval-label="approved": Github label which approves a PR on behalf of the owner who applied it
+  -pending-timeout=15m0s: How long to wait for the CI system to start testing a PR
+  -pr-mungers="": Comma separated list of mungers to run over every open PR on each pass (size,needs-rebase,stale-pr)
+  -project="kubernetes": The github project to merge into
+  -record="": Path to save the github responses of each pass to, for --simulate
+  -simulate="": Path to responses saved by --record. If set, run one pass against them offline and print what the queue would do
+  -stale-pr-days=30: Number of days without activity after which the stale-pr munger pings the author
   -stderrthreshold=0: logs at or above this threshold go to stderr
   -token="": The OAuth Token to use for requests.
-  -user-whitelist="": Path to a whitelist file that contains users to auto-merge.  Required.
+  -user-whitelist="": Path to a whitelist file that contains users to auto-merge.  Required unless --owners-approval is set.
   -v=0: log level for V logs
   -vmodule=: comma-separated list of pattern=N settings for file-filtered logging
 */
@@ -42,14 +63,29 @@ import (
 	"bufio"
 	"errors"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
+	"k8s.io/contrib/submit-queue/ci"
+	"k8s.io/contrib/submit-queue/flake"
+	"k8s.io/contrib/submit-queue/freeze"
 	"k8s.io/contrib/submit-queue/github"
-	"k8s.io/contrib/submit-queue/jenkins"
+	"k8s.io/contrib/submit-queue/merge"
+	"k8s.io/contrib/submit-queue/mungers"
+	"k8s.io/contrib/submit-queue/replay"
 
 	"github.com/golang/glog"
 	github_api "github.com/google/go-github/github"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -59,64 +95,215 @@ var (
 	oneOff            = flag.Bool("once", false, "If true, only merge one PR, don't run forever")
 	jobs              = flag.String("jenkins-jobs", "kubernetes-e2e-gce,kubernetes-e2e-gke-ci,kubernetes-build", "Comma separated list of jobs in Jenkins to use for stability testing")
 	jenkinsHost       = flag.String("jenkins-host", "", "The URL for the jenkins job to watch")
-	userWhitelist     = flag.String("user-whitelist", "", "Path to a whitelist file that contains users to auto-merge.  Required.")
+	jenkinsUser       = flag.String("jenkins-user", "", "The Jenkins user to authenticate as")
+	jenkinsTokenFile  = flag.String("jenkins-token-file", "", "Path to a file holding the API token of --jenkins-user")
+	userWhitelist     = flag.String("user-whitelist", "", "Path to a whitelist file that contains users to auto-merge.  Required unless --owners-approval is set.")
 	requiredContexts  = flag.String("required-contexts", "cla/google,Shippable,continuous-integration/travis-ci/pr,Jenkins GCE e2e", "Comma separate list of status contexts required for a PR to be considered ok to merge")
+	optionalContexts  = flag.String("optional-contexts", "", "Comma separated list of status contexts whose failure is logged but doesn't block a merge")
+	allCommits        = flag.Bool("all-commits", false, "If true, require every commit in a PR to be passing rather than only the head commit")
 	whitelistOverride = flag.String("whitelist-override-label", "ok-to-merge", "Github label, if present on a PR it will be merged even if the author isn't in the whitelist")
-)
+	configFile        = flag.String("config", "", "Path to a JSON file with per repository settings, keyed by \"<org>/<project>\"")
+	org               = flag.String("org", "kubernetes", "The github organization to merge into")
+	project           = flag.String("project", "kubernetes", "The github project to merge into")
+	pendingTimeout    = flag.Duration("pending-timeout", 15*time.Minute, "How long to wait for the CI system to start testing a PR")
+	ciTimeout         = flag.Duration("ci-timeout", 2*time.Hour, "How long to wait for the CI result of a PR before moving on to the next one")
+	mergeTimeout      = flag.Duration("mergeability-timeout", 10*time.Second, "How long to wait for github to determine if a PR is mergeable")
+	ownersApproval    = flag.Bool("owners-approval", false, "If true, require approval from the OWNERS of every changed file instead of a whitelisted author")
+	approvalLabel     = flag.String("owners-approval-label", "approved", "Github label which approves a PR on behalf of the owner who applied it")
+	blockerLabel      = flag.String("merge-blocker-label", "merge-blocker", "Github label which freezes the queue while any open issue has it")
+	freezeFile        = flag.String("freeze-file", "", "Path to a file which, while it exists, freezes the queue with its contents as the reason")
+	address           = flag.String("address", "localhost:8080", "The address to serve /freeze, /flakes, /history and /metrics on, empty to disable. POST and DELETE on /freeze are not authenticated, so only listen beyond localhost on a trusted network")
+	auditLogFile      = flag.String("audit-log", "", "Path to a file to append a JSON record of every action the bot takes to")
+	recordFile        = flag.String("record", "", "Path to save the github responses of each pass to, for --simulate")
+	simulateFile      = flag.String("simulate", "", "Path to responses saved by --record. If set, run one pass against them offline and print what the queue would do")
+	mergeMethod       = flag.String("merge-method", "merge", "How PRs are merged: merge, squash or rebase")
+	prMungers         = flag.String("pr-mungers", "", "Comma separated list of mungers to run over every open PR on each pass (size,needs-rebase,stale-pr)")
 
-const (
-	org     = "kubernetes"
-	project = "kubernetes"
+	// ciProvider gates merges, it is chosen by the repository's config.
+	ciProvider ci.Provider
+	// freezer stops merges when the queue is frozen.
+	freezer *freeze.Freezer
+	// flakes decides whether to retry PRs which failed on flaky status contexts.
+	flakes *flake.Tracker
+	// merger merges PRs and keeps the merge history.
+	merger *merge.Merger
 )
 
+// frozenRetryInterval is how long to wait before checking a frozen queue again.
+const frozenRetryInterval = time.Minute
+
+// timedOut explains on the PR why the queue gave up on it, and returns an error so the
+// queue moves on to the next candidate.
+func timedOut(client *github_api.Client, pr *github_api.PullRequest, reason string) error {
+	body := fmt.Sprintf("Submit queue timed out: %s. Skipping this PR for now, it will be retried on a later pass.", reason)
+	if err := github.WriteComment(client, *org, *project, *pr.Number, body, "timed out", *dryrun); err != nil {
+		glog.Warningf("Failed to create timeout comment: %v", err)
+	}
+	return fmt.Errorf("timed out on PR %d: %s", *pr.Number, reason)
+}
+
 // This is called on a potentially mergeable PR
-func runE2ETests(client *github_api.Client, pr *github_api.PullRequest, issue *github_api.Issue) error {
-	// Test if the build is stable in Jenkins
-	jenkinsClient := &jenkins.JenkinsClient{Host: *jenkinsHost}
-	builds := strings.Split(*jobs, ",")
-	for _, build := range builds {
-		stable, err := jenkinsClient.IsBuildStable(build)
-		glog.V(2).Infof("Checking build stability for %s", build)
+func runE2ETests(ctx context.Context, client *github_api.Client, pr *github_api.PullRequest, issue *github_api.Issue) error {
+	if ok, reason := freezer.AllowsPR(pr, issue); !ok {
+		glog.Infof("Skipping PR %d: %s", *pr.Number, reason)
+		return nil
+	}
+	// Test if the build is stable
+	stable, err := ciProvider.IsStable()
+	if err != nil {
+		return err
+	}
+	if !stable {
+		return errors.New("Unstable build")
+	}
+	for {
+		// A frozen queue doesn't start CI runs either
+		if frozen, reason, err := freezer.Frozen(client, *org, *project); err != nil {
+			return err
+		} else if frozen {
+			return fmt.Errorf("not testing PR %d, the queue is frozen: %s", *pr.Number, reason)
+		}
+		// Ask for a fresh build
+		if err := ciProvider.Retest(client, *org, *project, pr); err != nil {
+			return err
+		}
+		ok, err := waitForCI(ctx, client, pr)
 		if err != nil {
 			return err
 		}
-		if !stable {
-			glog.Errorf("Build %s isn't stable, skipping!", build)
-			return errors.New("Unstable build")
+		if ok {
+			break
+		}
+		if retry, err := retryFlakes(client, pr); !retry {
+			return err
 		}
 	}
-	glog.V(2).Infof("Build is stable.")
-	// Ask for a fresh build
-	glog.V(4).Infof("Asking PR builder to build %d", *pr.Number)
-	body := "@k8s-bot test this [testing build queue, sorry for the noise]"
-	if _, _, err := client.Issues.CreateComment(org, project, *pr.Number, &github_api.IssueComment{Body: &body}); err != nil {
+	// The queue may have been frozen while the tests ran
+	if frozen, reason, err := freezer.Frozen(client, *org, *project); err != nil {
 		return err
+	} else if frozen {
+		return fmt.Errorf("not merging PR %d, the queue is frozen: %s", *pr.Number, reason)
+	}
+	glog.Infof("Merging PR: %d", *pr.Number)
+	if err := github.WriteComment(client, *org, *project, *pr.Number, "Automatic merge from SubmitQueue", "merging", *dryrun); err != nil {
+		glog.Warningf("Failed to create merge comment: %v", err)
+		return err
+	}
+	if *dryrun {
+		glog.Infof("Skipping actual merge because --dry-run is set")
+		return nil
+	}
+	return merger.Merge(client, *org, *project, pr, issue)
+}
+
+// waitForCI waits up to --ci-timeout for the CI result of a PR.
+func waitForCI(ctx context.Context, client *github_api.Client, pr *github_api.PullRequest) (bool, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, *ciTimeout)
+	defer cancel()
+	ok, err := ciProvider.WaitForResult(waitCtx, client, *org, *project, pr)
+	if err == context.DeadlineExceeded {
+		if waitCtx.Err() == nil {
+			return false, timedOut(client, pr, fmt.Sprintf("the CI run did not start within %v", *pendingTimeout))
+		}
+		return false, timedOut(client, pr, fmt.Sprintf("the CI run did not finish within %v", *ciTimeout))
+	}
+	return ok, err
+}
+
+// retryFlakes returns true if the failed CI run of a PR should be retried because only
+// flaky contexts failed. When the PR runs out of retries the failures are reported on it.
+func retryFlakes(client *github_api.Client, pr *github_api.PullRequest) (bool, error) {
+	failed := []github_api.RepoStatus{}
+	if pr.Head != nil && pr.Head.SHA != nil {
+		var err error
+		if failed, err = github.FailedStatuses(client, *org, *project, *pr.Head.SHA); err != nil {
+			return false, err
+		}
 	}
+	switch flakes.Record(pr, failed) {
+	case flake.Retry:
+		return true, nil
+	case flake.Exhausted:
+		glog.Infof("PR %d has run out of retries for flaky contexts", *pr.Number)
+		return false, github.WriteComment(client, *org, *project, *pr.Number, flake.Summary(failed), "out of retries for flaky contexts", *dryrun)
+	}
+	glog.Infof("Status after build is not 'success', skipping PR %d", *pr.Number)
+	return false, nil
+}
 
-	// Wait for the build to start
-	err := github.WaitForPending(client, org, project, *pr.Number)
+// filterConfig returns the checks a PR must pass to be tested and merged.
+func filterConfig(repoConfig *RepoConfig) (*github.FilterConfig, error) {
+	users := []string{}
+	if len(*userWhitelist) > 0 {
+		var err error
+		if users, err = loadWhitelist(*userWhitelist); err != nil {
+			return nil, err
+		}
+	}
+	requiredContexts := strings.Split(*requiredContexts, ",")
+	statusConfig := repoConfig.Status
+	if statusConfig == nil {
+		statusConfig = &StatusConfig{}
+	}
+	if statusConfig.OptionalContexts == nil && len(*optionalContexts) > 0 {
+		statusConfig.OptionalContexts = strings.Split(*optionalContexts, ",")
+	}
+	config := &github.FilterConfig{
+		MinPRNumber:            *minPRNumber,
+		UserWhitelist:          users,
+		RequiredStatusContexts: requiredContexts,
+		WhitelistOverride:      *whitelistOverride,
+		MergeabilityTimeout:    *mergeTimeout,
+		RequireOwnersApproval:  *ownersApproval,
+		ApprovalLabel:          *approvalLabel,
+		BranchContexts:         statusConfig.BranchContexts,
+		OptionalContexts:       statusConfig.OptionalContexts,
+		AllCommits:             *allCommits || statusConfig.AllCommits,
+		DryRun:                 *dryrun,
+	}
+	return config, nil
+}
 
-	// Wait for the status to go back to 'success'
-	ok, err := github.ValidateStatus(client, org, project, *pr.Number, []string{}, true)
+// serveSimulator serves simulator on a local port and returns a github client which
+// talks to it.
+func serveSimulator(simulator *replay.Simulator) (*github_api.Client, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if !ok {
-		glog.Infof("Status after build is not 'success', skipping PR %d", *pr.Number)
-		return nil
+	go http.Serve(listener, simulator)
+	client := github.MakeClient("")
+	if client.BaseURL, err = url.Parse("http://" + listener.Addr().String() + "/"); err != nil {
+		return nil, err
 	}
-	if !*dryrun {
-		glog.Infof("Merging PR: %d", *pr.Number)
-		mergeBody := "Automatic merge from SubmitQueue"
-		if _, _, err := client.Issues.CreateComment(org, project, *pr.Number, &github_api.IssueComment{Body: &mergeBody}); err != nil {
-			glog.Warningf("Failed to create merge comment: %v", err)
-			return err
+	return client, nil
+}
+
+// simulate runs one pass over the PRs in the simulator's snapshot and prints which
+// would be merged, skipped or commented on, and why. CI isn't simulated, so every PR
+// which passes the checks and isn't held back by a freeze is reported as merged.
+func simulate(client *github_api.Client, config *github.FilterConfig, simulator *replay.Simulator) error {
+	report := &replay.Report{}
+	config.Skipped = report.Skip
+	frozen, frozenReason, err := freezer.Frozen(client, *org, *project)
+	if err != nil {
+		return err
+	}
+	err = github.ForEachCandidatePRDo(context.Background(), client, *org, *project, func(ctx context.Context, client *github_api.Client, pr *github_api.PullRequest, issue *github_api.Issue) error {
+		if frozen {
+			report.Skip(*pr.Number, "the queue is frozen: "+frozenReason)
+		} else if ok, reason := freezer.AllowsPR(pr, issue); !ok {
+			report.Skip(*pr.Number, reason)
+		} else {
+			report.Merge(*pr.Number, "passed every check")
 		}
-		_, _, err := client.PullRequests.Merge(org, project, *pr.Number, "Auto commit by PR queue bot")
+		return nil
+	}, false, config)
+	if err != nil {
 		return err
 	}
-	glog.Infof("Skipping actual merge because --dry-run is set")
-	return nil
+	report.AddActions(simulator.Actions())
+	return report.Write(os.Stdout)
 }
 
 func loadWhitelist(file string) ([]string, error) {
@@ -134,28 +321,179 @@ func loadWhitelist(file string) ([]string, error) {
 }
 
 func main() {
+	mungers.RegisterFlags(flag.CommandLine)
 	flag.Parse()
-	if len(*userWhitelist) == 0 {
+	if len(*userWhitelist) == 0 && !*ownersApproval {
 		glog.Fatalf("--user-whitelist is required.")
 	}
-	if len(*jenkinsHost) == 0 {
-		glog.Fatalf("--jenkins-host is required.")
+	var client *github_api.Client
+	var recorder *replay.Recorder
+	var simulator *replay.Simulator
+	switch {
+	case len(*simulateFile) > 0:
+		snapshot, err := replay.LoadSnapshot(*simulateFile)
+		if err != nil {
+			glog.Fatalf("error loading snapshot: %v", err)
+		}
+		simulator = replay.NewSimulator(snapshot)
+		if client, err = serveSimulator(simulator); err != nil {
+			glog.Fatalf("error starting simulator: %v", err)
+		}
+	case len(*recordFile) > 0:
+		recorder = replay.NewRecorder(nil)
+		client = github.MakeClientWithTransport(*token, recorder)
+	default:
+		client = github.MakeClient(*token)
+	}
+	// Simulated actions don't belong in the audit log
+	if len(*auditLogFile) > 0 && simulator == nil {
+		auditLog, err := github.OpenAuditLog(*auditLogFile)
+		if err != nil {
+			glog.Fatalf("error opening audit log: %v", err)
+		}
+		github.SetAuditLog(auditLog)
 	}
-	client := github.MakeClient(*token)
 
-	users, err := loadWhitelist(*userWhitelist)
+	ciConfig := &ci.Config{
+		Type:        ci.JenkinsType,
+		JenkinsHost: *jenkinsHost,
+		JenkinsUser: *jenkinsUser,
+		Jobs:        strings.Split(*jobs, ","),
+	}
+	repoConfig := &RepoConfig{}
+	if len(*configFile) > 0 {
+		config, err := loadConfig(*configFile)
+		if err != nil {
+			glog.Fatalf("error loading config: %v", err)
+		}
+		if c := config.repoConfig(*org, *project); c != nil {
+			repoConfig = c
+		}
+	}
+	config, err := filterConfig(repoConfig)
 	if err != nil {
 		glog.Fatalf("error loading user whitelist: %v", err)
 	}
-	requiredContexts := strings.Split(*requiredContexts, ",")
-	config := &github.FilterConfig{
-		MinPRNumber:            *minPRNumber,
-		UserWhitelist:          users,
-		RequiredStatusContexts: requiredContexts,
-		WhitelistOverride:      *whitelistOverride,
+	freezeConfig := repoConfig.Freeze
+	if freezeConfig == nil {
+		freezeConfig = &freeze.Config{}
+	}
+	if len(freezeConfig.BlockerLabel) == 0 {
+		freezeConfig.BlockerLabel = *blockerLabel
+	}
+	if len(freezeConfig.File) == 0 {
+		freezeConfig.File = *freezeFile
+	}
+	if freezer, err = freeze.New(freezeConfig); err != nil {
+		glog.Fatalf("error loading freeze config: %v", err)
+	}
+	if simulator != nil {
+		if err := simulate(client, config, simulator); err != nil {
+			glog.Fatalf("error simulating: %v", err)
+		}
+		return
+	}
+
+	if repoConfig.CI != nil {
+		ciConfig = repoConfig.CI
+	}
+	ciConfig.PendingTimeout = *pendingTimeout
+	ciConfig.DryRun = *dryrun
+	if len(*jenkinsTokenFile) > 0 {
+		data, err := ioutil.ReadFile(*jenkinsTokenFile)
+		if err != nil {
+			glog.Fatalf("error reading jenkins token: %v", err)
+		}
+		ciConfig.JenkinsToken = strings.TrimSpace(string(data))
+	}
+	if ciConfig.Type == ci.JenkinsType && len(ciConfig.JenkinsHost) == 0 {
+		glog.Fatalf("--jenkins-host is required.")
+	}
+	provider, err := ci.New(ciConfig, client, *org, *project)
+	if err != nil {
+		glog.Fatalf("error creating CI provider: %v", err)
+	}
+	ciProvider = provider
+
+	flakeConfig := repoConfig.Flakes
+	if flakeConfig == nil {
+		flakeConfig = &flake.Config{}
+	}
+	flakes = flake.New(flakeConfig)
+	mergeConfig := repoConfig.Merge
+	if mergeConfig == nil {
+		mergeConfig = &merge.Config{}
+	}
+	if len(mergeConfig.Method) == 0 {
+		mergeConfig.Method = *mergeMethod
+	}
+	if merger, err = merge.New(mergeConfig); err != nil {
+		glog.Fatalf("error loading merge config: %v", err)
 	}
+	if len(*address) > 0 {
+		http.Handle("/freeze", freezer)
+		http.Handle("/flakes", flakes)
+		http.Handle("/history", merger)
+		http.Handle("/metrics", prometheus.Handler())
+		go func() {
+			glog.Fatal(http.ListenAndServe(*address, nil))
+		}()
+	}
+
+	var activeMungers []mungers.PRMunger
+	if len(*prMungers) > 0 {
+		activeMungers, err = mungers.GetMungers(strings.Split(*prMungers, ","))
+		if err != nil {
+			glog.Fatalf("error loading mungers: %v", err)
+		}
+	}
+	mungerConfig := &mungers.Config{
+		Client:  client,
+		Org:     *org,
+		Project: *project,
+		DryRun:  *dryrun,
+	}
+
+	// Cancel any wait in progress on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		glog.Infof("Shutting down")
+		cancel()
+	}()
+
 	for !*oneOff {
-		if err := github.ForEachCandidatePRDo(client, org, project, runE2ETests, *oneOff, config); err != nil {
+		if recorder != nil {
+			recorder.Reset()
+		}
+		if err := mungers.MungePullRequests(ctx, mungerConfig, activeMungers); err != nil && err != context.Canceled {
+			glog.Errorf("Error munging PRs: %v", err)
+		}
+		// If the freeze can't be checked, wait as if the queue were frozen
+		frozen, _, err := freezer.Frozen(client, *org, *project)
+		if err != nil {
+			glog.Errorf("Error checking whether the queue is frozen: %v", err)
+		}
+		if frozen || err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(frozenRetryInterval):
+			}
+			continue
+		}
+		err = github.ForEachCandidatePRDo(ctx, client, *org, *project, runE2ETests, *oneOff, config)
+		if recorder != nil {
+			if err := recorder.Save(*recordFile); err != nil {
+				glog.Errorf("Error saving snapshot: %v", err)
+			}
+		}
+		if err == context.Canceled {
+			return
+		}
+		if err != nil {
 			glog.Fatalf("Error getting candidate PRs: %v", err)
 		}
 	}